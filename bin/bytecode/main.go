@@ -53,8 +53,11 @@ func runFile(vm *bytecode.VM, path string) {
 		os.Exit(74)
 	}
 
-	if err := vm.Interpret(string(sourceBytes)); err != nil {
-		fmt.Fprintf(os.Stderr, "Error interpreting file: %v\n", err)
+	// compile and runtime errors have already been reported by the vm
+	err = vm.Interpret(string(sourceBytes))
+	if errors.Is(err, bytecode.ErrCompileError) {
+		os.Exit(65)
+	} else if err != nil {
 		os.Exit(70)
 	}
 }
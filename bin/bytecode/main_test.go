@@ -10,7 +10,7 @@ func TestInterpret(t *testing.T) {
 	vm := bytecode.NewVM()
 	defer vm.Free()
 
-	source := `1 + 1`
+	source := `print 1 + 1;`
 
 	err := vm.Interpret(source)
 	if err != nil {
@@ -121,6 +121,57 @@ func main() {
 				{"Name", "*token.Token"},
 			},
 		},
+		{
+			"Interpolation",
+			[]Field{
+				// Start is the string's first INTERPOLATION token
+				{"Start", "*token.Token"},
+				// Parts are the string's text and expressions in order,
+				// each made a string as print would and joined
+				{"Parts", "[]Expr"},
+			},
+		},
+		{
+			"Lambda",
+			[]Field{
+				{"Keyword", "*token.Token"},
+				// Function is named for where the lambda appears, like
+				// "anonymous@line 3"
+				{"Function", "*Function"},
+			},
+		},
+		{
+			"List",
+			[]Field{
+				{"Bracket", "*token.Token"},
+				{"Elements", "[]Expr"},
+			},
+		},
+		{
+			"Map",
+			[]Field{
+				{"Brace", "*token.Token"},
+				{"Keys", "[]Expr"},
+				{"Values", "[]Expr"},
+			},
+		},
+		{
+			"Index",
+			[]Field{
+				{"Object", "Expr"},
+				{"Bracket", "*token.Token"},
+				{"Index", "Expr"},
+			},
+		},
+		{
+			"SetIndex",
+			[]Field{
+				{"Object", "Expr"},
+				{"Bracket", "*token.Token"},
+				{"Index", "Expr"},
+				{"Value", "Expr"},
+			},
+		},
 	}
 
 	exprAst := AST{
@@ -139,14 +190,42 @@ func main() {
 				{"Statements", "[]Stmt"},
 			},
 		},
+		{
+			"Break",
+			[]Field{
+				{"Keyword", "*token.Token"},
+			},
+		},
 		{
 			"Class",
 			[]Field{
 				{"Name", "*token.Token"},
 				{"Methods", "[]*Function"},
+				// ClassMethods are called on the class itself, which
+				// they see as 'this'
+				{"ClassMethods", "[]*Function"},
+				// Getters run when their property is read and take no
+				// parameters; Setters run when it is assigned and take
+				// the value
+				{"Getters", "[]*Function"},
+				{"Setters", "[]*Function"},
 				{"Superclass", "*ExprVar"},
 			},
 		},
+		{
+			"Continue",
+			[]Field{
+				{"Keyword", "*token.Token"},
+			},
+		},
+		{
+			"Export",
+			[]Field{
+				{"Keyword", "*token.Token"},
+				// Declaration is a StmtVar, Function or Class
+				{"Declaration", "Stmt"},
+			},
+		},
 		{
 			"Expression",
 			[]Field{
@@ -169,9 +248,22 @@ func main() {
 				{"ElseBranch", "Stmt"},
 			},
 		},
+		{
+			"Import",
+			[]Field{
+				{"Keyword", "*token.Token"},
+				{"Path", "*token.Token"},
+				// Name binds the whole module, and Names bind exports of
+				// the same names; both are nil for an import run only for
+				// its effects
+				{"Name", "*token.Token"},
+				{"Names", "[]*token.Token"},
+			},
+		},
 		{
 			"Print",
 			[]Field{
+				{"Keyword", "*token.Token"},
 				{"Expression", "Expr"},
 			},
 		},
@@ -189,11 +281,34 @@ func main() {
 				{"Initializer", "Expr"},
 			},
 		},
+		{
+			"Throw",
+			[]Field{
+				{"Keyword", "*token.Token"},
+				{"Value", "Expr"},
+			},
+		},
+		{
+			"Try",
+			[]Field{
+				{"Keyword", "*token.Token"},
+				{"Body", "[]Stmt"},
+				// CatchName and CatchBody are nil without a catch clause,
+				// and FinallyBody is nil without a finally clause
+				{"CatchName", "*token.Token"},
+				{"CatchBody", "[]Stmt"},
+				{"FinallyBody", "[]Stmt"},
+			},
+		},
 		{
 			"While",
 			[]Field{
+				{"Keyword", "*token.Token"},
 				{"Condition", "Expr"},
 				{"Body", "Stmt"},
+				// Increment runs after the body, even when the body
+				// continues; it is only set for desugared for loops
+				{"Increment", "Expr"},
 			},
 		},
 	}
@@ -203,7 +318,7 @@ func main() {
 		LowerTypeName:  "stmt",
 		Types:          stmtTypes,
 		Imports:        []string{"github.com/mkeesey/craftinginterpreters/pkg/token"},
-		VisitorHasType: false, // only side effects
+		VisitorHasType: true,
 	}
 	defineAst(os.Args[1], stmtAst)
 }
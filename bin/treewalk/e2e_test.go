@@ -1,6 +1,10 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -43,10 +47,843 @@ func TestScanParse(t *testing.T) {
 			require.NoError(t, err)
 			require.False(t, reporter.HasFailed())
 
-			expr = expr //TODO
+			_ = expr //TODO
 			// visitor := ast.PrintVisitor{}
 			// output := visitor.Print(expr)
 			// require.Equal(t, testcase.expected, output)
 		})
 	}
 }
+
+var backends = []struct {
+	name     string
+	closures bool
+}{
+	{name: "treewalk", closures: false},
+	{name: "closures", closures: true},
+}
+
+// runBackend runs source through a fresh interpreter, returning what it
+// printed and the error run returned.
+func runBackend(t *testing.T, closures bool, source string) (string, error) {
+	t.Helper()
+	reporter.Reset()
+	defer reporter.Reset()
+
+	var out bytes.Buffer
+	interp := newInterpreter(reporter, closures)
+	interp.SetOutput(&out)
+	err := run(interp, "", strings.NewReader(source))
+	return out.String(), err
+}
+
+func TestBackends(t *testing.T) {
+	type testcase struct {
+		name    string
+		input   string
+		output  string
+		runtime bool
+		compile bool
+	}
+
+	testcases := []testcase{
+		{
+			name:   "arithmetic",
+			input:  `print 1 + 2 * 3; print (1 + 2) * 3; print 10 / 4; print -(3 - 5); print !nil;`,
+			output: "7\n9\n2.5\n2\ntrue\n",
+		},
+		{
+			name:   "strings",
+			input:  `var a = "tac"; print a + "os"; print "a" == "a"; print "a" != "b";`,
+			output: "tacos\ntrue\ntrue\n",
+		},
+		{
+			name:   "logical",
+			input:  `print nil or "yes"; print false and "no"; print 1 and 2;`,
+			output: "yes\nfalse\n2\n",
+		},
+		{
+			name: "scopes",
+			input: `
+var a = "global a";
+var b = "global b";
+{
+  var a = "outer a";
+  {
+    var a = "inner a";
+    print a;
+    print b;
+  }
+  print a;
+}
+print a;`,
+			output: "inner a\nglobal b\nouter a\nglobal a\n",
+		},
+		{
+			name: "control flow",
+			input: `
+var sum = 0;
+for (var i = 0; i < 5; i = i + 1) {
+  if (i == 3) sum = sum + 100; else sum = sum + i;
+}
+print sum;
+var n = 3;
+while (n > 0) n = n - 1;
+print n;`,
+			output: "107\n0\n",
+		},
+		{
+			name: "recursion",
+			input: `
+fun fib(n) {
+  if (n < 2) return n;
+  return fib(n - 1) + fib(n - 2);
+}
+print fib(15);`,
+			output: "610\n",
+		},
+		{
+			name: "closures",
+			input: `
+fun makeCounter() {
+  var i = 0;
+  fun count() {
+    i = i + 1;
+    return i;
+  }
+  return count;
+}
+var a = makeCounter();
+var b = makeCounter();
+a();
+print a();
+print b();`,
+			output: "2\n1\n",
+		},
+		{
+			name: "closures capture each loop iteration",
+			input: `
+var first;
+var second;
+for (var i = 0; i < 2; i = i + 1) {
+  var j = i;
+  fun show() { print j; }
+  if (i == 0) first = show; else second = show;
+}
+first();
+second();`,
+			output: "0\n1\n",
+		},
+		{
+			name: "classes",
+			input: `
+class Point {
+  init(x, y) {
+    this.x = x;
+    this.y = y;
+  }
+  sum() { return this.x + this.y; }
+}
+var p = Point(1, 2);
+print p.sum();
+p.x = 10;
+var sum = p.sum;
+print sum();
+print p;
+print Point;
+print p.init(3, 4).x;`,
+			output: "3\n12\nPoint instance\nPoint\n3\n",
+		},
+		{
+			name: "inheritance",
+			input: `
+class A {
+  method() { return "A method"; }
+}
+class B < A {
+  method() { return "B then " + super.method(); }
+}
+class C < B {}
+print C().method();`,
+			output: "B then A method\n",
+		},
+		{
+			name: "local classes and functions",
+			input: `
+fun outer() {
+  class Inner {
+    get() { return "inner"; }
+  }
+  fun helper(x) { return x + 1; }
+  return Inner().get() + " " + "ok";
+}
+print outer();
+print clock;`,
+			output: "inner ok\n<native fn>\n",
+		},
+		{
+			name: "early return",
+			input: `
+fun find(n) {
+  var i = 0;
+  while (true) {
+    if (i == n) { return i; }
+    i = i + 1;
+  }
+}
+print find(4);
+fun nothing() { return; }
+print nothing();
+print find;`,
+			output: "4\nnil\n<fn find>\n",
+		},
+		{
+			name:    "runtime error stops the program",
+			input:   `print "before"; print "a" + 1; print "after";`,
+			output:  "before\n",
+			runtime: true,
+		},
+		{
+			name:    "undefined variable",
+			input:   `print missing;`,
+			runtime: true,
+		},
+		{
+			name:    "wrong arity",
+			input:   `fun f(a) {} f(1, 2);`,
+			runtime: true,
+		},
+		{
+			name:    "undefined property",
+			input:   `class A {} A().missing;`,
+			runtime: true,
+		},
+		{
+			name: "lists",
+			input: `
+var xs = [3, 1, 2,];
+print xs;
+print xs[0] + xs[2];
+xs[1] = "one";
+print xs;
+xs.append(4);
+xs.insert(0, 0);
+print xs.pop();
+print xs.remove(2);
+print xs.len();
+print xs;
+print [];
+print [[1, 2], [nil, true]];
+var ys = [1];
+ys.append(ys);
+print ys;
+print [1] == [1];`,
+			output: "[3, 1, 2]\n5\n[3, \"one\", 2]\n4\none\n3\n[0, 3, 2]\n[]\n[[1, 2], [nil, true]]\n[1, [...]]\nfalse\n",
+		},
+		{
+			name: "higher-order list methods",
+			input: `
+var xs = [5, 3, 8, 1];
+fun double(x) { return x * 2; }
+fun big(x) { return x > 2; }
+fun add(a, b) { return a + b; }
+fun greater(a, b) { return a > b; }
+print xs.map(double);
+print xs.filter(big);
+print xs.reduce(add, 0);
+print xs.slice(1);
+print xs.slice(1, 3);
+xs.sort();
+print xs;
+xs.sort(greater);
+print xs;
+var words = ["pear", "apple", "fig"];
+words.sort();
+print words;
+var sum = 0;
+for (var i = 0; i < xs.len(); i = i + 1) sum = sum + xs[i];
+print sum;`,
+			output: "[10, 6, 16, 2]\n[5, 3, 8]\n17\n[3, 8, 1]\n[3, 8]\n[1, 3, 5, 8]\n[8, 5, 3, 1]\n[\"apple\", \"fig\", \"pear\"]\n17\n",
+		},
+		{
+			name: "maps",
+			input: `
+var m = {"b": 2, "a": 1,};
+print m;
+print m["a"] + m["b"];
+m["c"] = 3;
+m["a"] = "one";
+print m;
+print m.has("c");
+print m.has("z");
+print m.delete("b");
+print m.delete("b");
+print m.keys();
+print m.values();
+print m.len();
+print {};
+var mixed = {1: "number", "1": "string", true: "bool", nil: "nil"};
+print mixed[1];
+print mixed["1"];
+print mixed[true];
+print mixed[nil];
+mixed[2 - 1] = "still number";
+print mixed[1];
+var nested = {"list": [1, {"x": nil}]};
+print nested;
+nested["self"] = nested;
+print nested;
+print {"a": 1} == {"a": 1};`,
+			output: "{\"b\": 2, \"a\": 1}\n3\n{\"b\": 2, \"a\": \"one\", \"c\": 3}\ntrue\nfalse\ntrue\nfalse\n[\"a\", \"c\"]\n[\"one\", 3]\n2\n{}\nnumber\nstring\nbool\nnil\nstill number\n{\"list\": [1, {\"x\": nil}]}\n{\"list\": [1, {\"x\": nil}], \"self\": {...}}\nfalse\n",
+		},
+		{
+			name:    "undefined map key",
+			input:   `var m = {"a": 1}; print m["a"]; print m["b"];`,
+			output:  "1\n",
+			runtime: true,
+		},
+		{
+			name:    "invalid map key",
+			input:   `var m = {}; m[[1]] = 1;`,
+			runtime: true,
+		},
+		{
+			name:    "map entry without a colon",
+			input:   `var m = {"a" 1};`,
+			compile: true,
+		},
+		{
+			name:    "list index out of range",
+			input:   `var xs = [1, 2]; print xs[0]; print xs[2];`,
+			output:  "1\n",
+			runtime: true,
+		},
+		{
+			name:    "list index not an integer",
+			input:   `var xs = [1, 2]; xs[0.5] = 1;`,
+			runtime: true,
+		},
+		{
+			name:    "indexing a non-list",
+			input:   `var s = "abc"; print s[0];`,
+			runtime: true,
+		},
+		{
+			name:    "pop from an empty list",
+			input:   `[].pop();`,
+			runtime: true,
+		},
+		{
+			name:    "sort mixed list",
+			input:   `[1, "a"].sort();`,
+			runtime: true,
+		},
+		{
+			name:    "error in a callback",
+			input:   `fun bad(x) { return x + "a"; } print [1].map(bad);`,
+			runtime: true,
+		},
+		{
+			name:    "unclosed list",
+			input:   `print [1, 2;`,
+			compile: true,
+		},
+		{
+			name:    "invalid index assignment target",
+			input:   `var xs = [1]; xs[0] + 1 = 2;`,
+			compile: true,
+		},
+		{
+			name:    "resolver error",
+			input:   `{ var a = 1; var a = 2; }`,
+			compile: true,
+		},
+		{
+			name: "break and continue",
+			input: `for (var i = 0; i < 10; i = i + 1) {
+				if (i == 1) continue;
+				if (i == 4) break;
+				print i;
+			}
+			var j = 0;
+			while (true) {
+				j = j + 1;
+				if (j < 3) continue;
+				break;
+			}
+			print j;`,
+			output: "0\n2\n3\n3\n",
+		},
+		{
+			name: "break out of an inner loop",
+			input: `for (var i = 0; i < 2; i = i + 1) {
+				for (var j = 0; j < 5; j = j + 1) {
+					if (j == 1) break;
+					print i + j;
+				}
+			}`,
+			output: "0\n1\n",
+		},
+		{
+			name: "break closes captured locals",
+			input: `var fs = [];
+			for (var i = 0; i < 3; i = i + 1) {
+				var j = i;
+				fun f() { return j; }
+				fs.append(f);
+				if (i == 1) break;
+			}
+			print fs[0]() + fs[1]();`,
+			output: "1\n",
+		},
+		{
+			name: "catch a thrown value",
+			input: `fun check(n) {
+				if (n < 0) throw "negative";
+				return n;
+			}
+			try {
+				print check(1);
+				print check(-1);
+				print "unreachable";
+			} catch (e) {
+				print "caught " + e;
+			} finally {
+				print "finally";
+			}`,
+			output: "1\ncaught negative\nfinally\n",
+		},
+		{
+			name: "catch a runtime error",
+			input: `try {
+				nil();
+			} catch (e) {
+				print e.message;
+				print e.line;
+			}`,
+			output: "Can only call functions and classes.\n2\n",
+		},
+		{
+			name: "finally runs on the way out",
+			input: `fun f() {
+				try {
+					return "try";
+				} finally {
+					print "finally";
+				}
+			}
+			print f();
+			while (true) {
+				try { break; } finally { print "left loop"; }
+			}`,
+			output: "finally\ntry\nleft loop\n",
+		},
+		{
+			name: "rethrow from catch",
+			input: `try {
+				try {
+					throw 1;
+				} catch (e) {
+					throw e + 1;
+				} finally {
+					print "inner";
+				}
+			} catch (e) {
+				print e;
+			}`,
+			output: "inner\n2\n",
+		},
+		{
+			name: "catch variable is scoped to the catch",
+			input: `var e = "outer";
+			try { throw "inner"; } catch (e) { print e; }
+			print e;`,
+			output: "inner\nouter\n",
+		},
+		{
+			name: "uncaught throw",
+			input: `class Oops { init(message) { this.message = message; } }
+			print "before";
+			throw Oops("bad");`,
+			output:  "before\n",
+			runtime: true,
+		},
+		{
+			name:    "try without catch or finally",
+			input:   `try { print 1; }`,
+			compile: true,
+		},
+		{
+			name:    "break outside a loop",
+			input:   `break;`,
+			compile: true,
+		},
+		{
+			name:    "continue in a function in a loop",
+			input:   `while (true) { fun f() { continue; } }`,
+			compile: true,
+		},
+		{
+			name: "lambdas",
+			input: `
+fun apply(f, x) { return f(x); }
+print apply(fun (n) { return n * 2; }, 21);
+var adder = fun (a) { return fun (b) { return a + b; }; };
+print adder(1)(2);
+fun (s) { print s; }("called at once");
+var l = [1, 2, 3];
+var total = 0;
+fun each(list, f) { for (var i = 0; i < list.len(); i = i + 1) f(list[i]); }
+each(l, fun (n) { total = total + n; });
+print total;
+print fun () {};`,
+			output: "42\n3\ncalled at once\n6\n<fn anonymous@line 12>\n",
+		},
+		{
+			name:    "lambda error names its line",
+			input:   "var f = fun () {\n  return -nil;\n};\nf();",
+			runtime: true,
+		},
+		{
+			name:    "lambda without parens",
+			input:   `var f = fun { return 1; };`,
+			compile: true,
+		},
+		{
+			name:    "lambda with a name",
+			input:   `var f = fun g() {};`,
+			compile: true,
+		},
+		{
+			name: "class methods",
+			input: `
+class Math {
+  class square(n) { return n * n; }
+  class twice(n) { return this.square(n) * 2; }
+}
+class More < Math {
+  class square(n) { return super.square(n) + 1; }
+}
+print Math.square(3);
+print Math.twice(3);
+print More.square(3);
+print More.twice(3);
+print Math.square;`,
+			output: "9\n18\n10\n20\n<fn square>\n",
+		},
+		{
+			name: "getters and setters",
+			input: `
+class Circle {
+  init(radius) { this.radius = radius; }
+  area { return 3 * this.radius * this.radius; }
+  diameter { return this.radius * 2; }
+  set diameter(d) { this.radius = d / 2; }
+  set(key, value) { return key + "=" + value; }
+}
+class Ring < Circle {
+  area { return super.area - 1; }
+}
+var c = Circle(2);
+print c.area;
+c.diameter = 10;
+print c.radius;
+print c.diameter;
+print c.set("a", "b");
+print Ring(1).area;`,
+			output: "12\n5\n10\na=b\n2\n",
+		},
+		{
+			name:    "class methods aren't instance methods",
+			input:   `class A { class make() {} } A().make();`,
+			runtime: true,
+		},
+		{
+			name:    "instance methods aren't class methods",
+			input:   `class A { make() {} } A.make();`,
+			runtime: true,
+		},
+		{
+			name:    "setter with two parameters",
+			input:   `class A { set x(a, b) {} }`,
+			compile: true,
+		},
+		{
+			name: "index operator method",
+			input: `
+class Squares {
+  __index__(n) { return n * n; }
+}
+var s = Squares();
+print s[3];
+print s[1 + 1];`,
+			output: "9\n4\n",
+		},
+		{
+			name:    "index without __index__",
+			input:   `class A {} A()[0];`,
+			runtime: true,
+		},
+		{
+			name:    "operator method errors show in the trace",
+			input:   "class A {\n  __add__(other) { return other - 1; }\n}\nprint A() + nil;",
+			runtime: true,
+		},
+		{
+			name: "for-in over built-in sequences",
+			input: `
+for (var c in "héy") print c;
+var xs = [1, 2, 3];
+for (var x in xs) {
+  if (x == 1) xs.append(4);
+  print x;
+}
+for (var key in {"a": 1, "b": 2}) print key;
+for (var x in []) print "never";`,
+			output: "h\né\ny\n1\n2\n3\n4\na\nb\n",
+		},
+		{
+			name: "for-in over the iterator protocol",
+			input: `
+class Range {
+  init(start, end) { this.start = start; this.end = end; }
+  iterator() { return RangeIterator(this.start, this.end); }
+}
+class RangeIterator {
+  init(next, end) { this.n = next; this.end = end; }
+  hasNext() { return this.n < this.end; }
+  next() { this.n = this.n + 1; return this.n - 1; }
+}
+for (var i in Range(0, 10)) {
+  if (i == 1) continue;
+  if (i == 4) break;
+  print i;
+}
+var it = "ab".iterator();
+print it.next() + it.next();
+print it.hasNext();`,
+			output: "0\n2\n3\nab\nfalse\n",
+		},
+		{
+			name: "for-in variables are fresh each time around",
+			input: `
+var fns = [];
+for (var x in [1, 2]) fns.append(fun () { return x; });
+print fns[0]() + fns[1]();
+var in = "still a name";
+print in;`,
+			output: "3\nstill a name\n",
+		},
+		{
+			name:    "for-in over a number",
+			input:   `for (var x in 5) print x;`,
+			runtime: true,
+		},
+		{
+			name:    "iterator past the end",
+			input:   `var it = [].iterator(); it.next();`,
+			runtime: true,
+		},
+		{
+			name:    "for-in without a variable",
+			input:   `for (var in [1]) print 1;`,
+			compile: true,
+		},
+		{
+			name: "string interpolation",
+			input: `
+var flavor = "lemon";
+var n = 3;
+print "${n} ${flavor} cakes";
+print "sum: ${1 + 2}, list: ${[1, "a"]}, nil: ${nil}, bool: ${n > 2}";
+print "quoted ${"inner ${flavor + "y"}"} and ${ {"a": 1}["a"] } brace";
+print "${n}";
+print "no $ interpolation {here}";
+class Cake { __str__() { return "a cake"; } }
+print "have ${Cake()}";`,
+			output: "3 lemon cakes\nsum: 3, list: [1, \"a\"], nil: nil, bool: true\nquoted inner lemony and 1 brace\n3\nno $ interpolation {here}\nhave a cake\n",
+		},
+		{
+			name: "numeric operators and literals",
+			input: `
+print 7 % 3;
+print -7 % 3;
+print 7.5 % 2;
+print 7 // 2;
+print -7 // 2;
+print 2 ** 10;
+print 2 ** 3 ** 2;
+print -2 ** 2;
+print 2 ** -1;
+print 6 & 3;
+print 6 | 3;
+print 6 ^ 3;
+print ~5;
+print 1 << 10;
+print -16 >> 2;
+print 1 + 2 * 3 % 4;
+print 1 | 2 ^ 3 & 4 << 1;
+print 5 & 1 == 1;
+print 0xFF + 0b101 + 1_000;
+var half = (9 + 1) // 2; # a comment
+print half;`,
+			output: "1\n2\n1.5\n3\n-4\n1024\n512\n-4\n0.5\n2\n7\n5\n-6\n1024\n-4\n3\n3\ntrue\n1260\n5\n",
+		},
+		{
+			name: "comments after operands",
+			input: `
+var x = 2;
+if (x > 1) # after a paren
+  print x;
+var y = x # after an identifier
+  + 1;
+print y + 3 # after a number
+;
+print [y] # after a bracket
+;`,
+			output: "2\n6\n[3]\n",
+		},
+		{
+			name: "overloaded numeric operators",
+			input: `
+class Mod {
+  init(n) { this.n = n; }
+  __mod__(m) { return Mod(this.n % m); }
+  __pow__(e) { return "pow " + "${this.n ** e}"; }
+  __and__(o) { return "and"; }
+}
+print (Mod(7) % 4).n;
+print Mod(3) ** 2;
+print Mod(1) & 1;
+print Mod(1) | 1;`,
+			output:  "3\npow 9\nand\n",
+			runtime: true,
+		},
+		{
+			name:    "bitwise operator on a fraction",
+			input:   `print 1.5 & 1;`,
+			runtime: true,
+		},
+		{
+			name:    "negative shift",
+			input:   `print 1 << -1;`,
+			runtime: true,
+		},
+		{
+			name:    "complement of a fraction",
+			input:   `print ~0.5;`,
+			runtime: true,
+		},
+		{
+			name:    "modulo of a string",
+			input:   `print "a" % 2;`,
+			runtime: true,
+		},
+		{
+			name:    "bad hex literal",
+			input:   `print 0xG;`,
+			compile: true,
+		},
+		{
+			name:    "bad underscore in a number",
+			input:   `print 1__000;`,
+			compile: true,
+		},
+		{
+			name: "string escapes",
+			input: `
+var x = 1;
+print "tab\tquote\" slash\\ \${x} \u{1F600}";
+print r"raw\n${x}\";
+print "two
+lines" + "\n...and a third";`,
+			output: "tab\tquote\" slash\\ ${x} \U0001F600\nraw\\n${x}\\\ntwo\nlines\n...and a third\n",
+		},
+		{
+			name:    "invalid escape",
+			input:   `print "a\qb";`,
+			compile: true,
+		},
+		{
+			name:    "invalid unicode escape",
+			input:   `print "\u{D800}";`,
+			compile: true,
+		},
+		{
+			name:    "unterminated raw string",
+			input:   `print r"abc;`,
+			compile: true,
+		},
+		{
+			name:    "unterminated interpolation",
+			input:   `print "a ${1 + 2";`,
+			compile: true,
+		},
+		{
+			name:    "interpolation without a closing brace",
+			input:   `print "a ${1 2}";`,
+			compile: true,
+		},
+		{
+			name:    "empty interpolation",
+			input:   `print "a ${}";`,
+			compile: true,
+		},
+		{
+			name:    "export in a block",
+			input:   `{ export var a = 1; }`,
+			compile: true,
+		},
+		{
+			name:    "export without a declaration",
+			input:   `export print 1;`,
+			compile: true,
+		},
+		{
+			name:    "import without a path",
+			input:   `import lib;`,
+			compile: true,
+		},
+		{
+			name:    "missing module",
+			input:   `import "no/such/module.lox";`,
+			runtime: true,
+		},
+	}
+
+	for _, backend := range backends {
+		for _, testcase := range testcases {
+			t.Run(backend.name+"/"+testcase.name, func(t *testing.T) {
+				output, err := runBackend(t, backend.closures, testcase.input)
+				require.Equal(t, testcase.output, output)
+
+				var compileError *CompileError
+				var runtimeError *RuntimeError
+				require.Equal(t, testcase.compile, errors.As(err, &compileError), "compile error: %v", err)
+				require.Equal(t, testcase.runtime, errors.As(err, &runtimeError), "runtime error: %v", err)
+			})
+		}
+	}
+}
+
+// TestBackendsAgreeOnExamples runs each example through every backend and
+// checks they all print the same thing and fail the same way.
+func TestBackendsAgreeOnExamples(t *testing.T) {
+	files, err := filepath.Glob("../../examples/*.lox")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			source, err := os.ReadFile(file)
+			require.NoError(t, err)
+
+			expectedOutput, expectedErr := runBackend(t, backends[0].closures, string(source))
+			for _, backend := range backends[1:] {
+				output, err := runBackend(t, backend.closures, string(source))
+				require.Equal(t, expectedOutput, output, backend.name)
+				require.IsType(t, expectedErr, err, backend.name)
+			}
+		})
+	}
+}
@@ -3,30 +3,63 @@ package main
 import (
 	"bufio"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/mkeesey/craftinginterpreters/pkg/ast"
+	"github.com/mkeesey/craftinginterpreters/pkg/closure"
 	"github.com/mkeesey/craftinginterpreters/pkg/failure"
 	"github.com/mkeesey/craftinginterpreters/pkg/parser"
 	"github.com/mkeesey/craftinginterpreters/pkg/scanner"
 )
 
+// interpreter is a backend that runs resolved statements.
+type interpreter interface {
+	ast.LocalResolver
+	Interpret(statements []ast.Stmt)
+	SetOutput(w io.Writer)
+	SetModuleLoader(loader *ast.ModuleLoader)
+}
+
 var (
+	closures = flag.Bool("closures", false, "compile the AST to Go closures instead of walking it")
+	path     = flag.String("path", "", "directories to search for imported modules, separated by '"+string(filepath.ListSeparator)+"'")
+
 	reporter = &failure.Reporter{}
-	visitor  = ast.NewInterpreter(reporter)
+	visitor  interpreter
 )
 
+func newInterpreter(reporter *failure.Reporter, closures bool) interpreter {
+	var visitor interpreter
+	if closures {
+		visitor = closure.NewInterpreter(reporter)
+	} else {
+		visitor = ast.NewInterpreter(reporter)
+	}
+	visitor.SetModuleLoader(ast.NewModuleLoader(filepath.SplitList(*path), func(file string) ([]ast.Stmt, error) {
+		return parser.ParseFile(file, reporter)
+	}))
+	return visitor
+}
+
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-closures] [-path dirs] [script]\n", os.Args[0])
+	}
+	flag.Parse()
+	visitor = newInterpreter(reporter, *closures)
+
 	var err error
-	if len(os.Args) == 2 {
-		err = runFile(os.Args[1])
-	} else if len(os.Args) == 1 {
+	if flag.NArg() == 1 {
+		err = runFile(flag.Arg(0))
+	} else if flag.NArg() == 0 {
 		err = runPrompt()
 	} else {
-		fmt.Fprintf(os.Stderr, "Usage: %s [script]\n", os.Args[0])
+		flag.Usage()
 		os.Exit(64)
 	}
 
@@ -57,7 +90,7 @@ func runFile(filename string) error {
 	}
 	defer file.Close()
 
-	return run(file)
+	return run(visitor, filename, file)
 }
 
 func runPrompt() error {
@@ -74,7 +107,7 @@ func runPrompt() error {
 		}
 
 		reader.Reset(line)
-		err = run(reader)
+		err = run(visitor, "", reader)
 		if err != nil {
 			var outputter ErrorOutputter
 			if errors.As(err, &outputter) {
@@ -86,9 +119,10 @@ func runPrompt() error {
 	}
 }
 
-func run(reader io.Reader) error {
-
-	scan := scanner.NewScanner(reader, reporter)
+// run runs the source read from reader, naming it filename in errors unless
+// that is empty.
+func run(visitor interpreter, filename string, reader io.Reader) error {
+	scan := scanner.NewFileScanner(reader, filename, reporter)
 	tokens := scan.ScanTokens()
 
 	parser := parser.NewParser(tokens, reporter)
@@ -1,9 +1,18 @@
 package ast
 
+import (
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/token"
+)
+
 //go:generate go run ../../bin/genast/genast.go .
 
 type Callable interface {
-	Call(interpreter *TreeWalkInterpreter, arguments []interface{}) interface{}
+	// Call invokes the callable. paren is the call site's closing parenthesis,
+	// used to locate runtime errors.
+	Call(interpreter *TreeWalkInterpreter, paren *token.Token, arguments []interface{}) (interface{}, error)
+	// Arity is negative for variadic callables, which check their own
+	// argument count.
 	Arity() int
 }
 
@@ -17,41 +26,37 @@ func NewLoxFunction(declaration *Function, closure *Environment, isInitializer b
 	return &LoxFunction{declaration: declaration, closure: closure, isIntializer: isInitializer}
 }
 
-func (l *LoxFunction) Call(interpreter *TreeWalkInterpreter, arguments []interface{}) (ret interface{}) {
+func (l *LoxFunction) Call(interpreter *TreeWalkInterpreter, paren *token.Token, arguments []interface{}) (interface{}, error) {
+	if err := interpreter.interrupted(paren); err != nil {
+		return nil, err
+	}
 	env := WithEnvironment(l.closure)
 
 	for i, param := range l.declaration.Params {
-		env.Define(param.Lexeme, arguments[i])
+		if err := interpreter.define(env, paren, param.Lexeme, arguments[i]); err != nil {
+			return nil, err
+		}
 	}
 
-	defer func() {
-		if r := recover(); r != nil {
-			returnval, ok := r.(returnval)
-			if !ok { // some other panic other than our return value
-				panic(r)
-			}
-
-			if l.isIntializer { // initializers always return 'this'
-				ret = l.closure.GetAt(0, "this")
-			} else {
-				ret = returnval.Value
-			}
-		}
-	}()
-	interpreter.executeBlock(l.declaration.Body, env)
-	if l.isIntializer {
-		return l.closure.GetAt(0, "this")
+	completion := interpreter.executeBlock(l.declaration.Body, env)
+	if completion.Kind == CompletionError {
+		return nil, failure.Unwind(completion.Err(), failure.Call(l.declaration.Name.Lexeme, paren))
+	}
+	if l.isIntializer { // initializers always return 'this'
+		return l.closure.GetAt(0, 0), nil
 	}
-	return nil
+	return completion.Value, nil
 }
 
 func (l *LoxFunction) Arity() int {
 	return len(l.declaration.Params)
 }
 
-func (l *LoxFunction) Bind(instance *LoxInstance) *LoxFunction {
+// Bind returns l with 'this' bound to this, an instance or, for class
+// methods, the class.
+func (l *LoxFunction) Bind(this interface{}) *LoxFunction {
 	env := WithEnvironment(l.closure)
-	env.Define("this", instance)
+	env.Define("this", this)
 	return NewLoxFunction(l.declaration, env, l.isIntializer)
 }
 
@@ -59,6 +64,6 @@ func (l *LoxFunction) String() string {
 	return "<fn " + l.declaration.Name.Lexeme + ">"
 }
 
-type returnval struct {
-	Value interface{}
+func (l *LoxFunction) TypeName() string {
+	return "function"
 }
@@ -2,6 +2,7 @@ package ast
 
 import (
 	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/heap"
 	"github.com/mkeesey/craftinginterpreters/pkg/token"
 )
 
@@ -9,20 +10,33 @@ type LoxClass struct {
 	name       string
 	superclass *LoxClass
 	methods    map[string]*LoxFunction
+	// statics are the class methods, bound to the class when called
+	statics map[string]*LoxFunction
+	getters map[string]*LoxFunction
+	setters map[string]*LoxFunction
 }
 
 func NewLoxClass(name string, superclass *LoxClass, methods map[string]*LoxFunction) *LoxClass {
 	return &LoxClass{name: name, superclass: superclass, methods: methods}
 }
 
-func (l *LoxClass) Call(interpreter *TreeWalkInterpreter, arguments []interface{}) interface{} {
+func (l *LoxClass) Call(interpreter *TreeWalkInterpreter, paren *token.Token, arguments []interface{}) (interface{}, error) {
+	if err := interpreter.Allocate(heap.Instance, heap.InstanceSize, paren); err != nil {
+		return nil, err
+	}
 	instance := NewLoxInstance(l)
 	initializer := l.findMethod("init")
 	if initializer != nil {
-		initializer.Bind(instance).Call(interpreter, arguments)
+		bound, err := interpreter.bind(initializer, instance, paren)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := bound.Call(interpreter, paren, arguments); err != nil {
+			return nil, err
+		}
 	}
 
-	return instance
+	return instance, nil
 }
 
 func (l *LoxClass) Arity() int {
@@ -38,6 +52,10 @@ func (l *LoxClass) String() string {
 	return l.name
 }
 
+func (l *LoxClass) TypeName() string {
+	return "class"
+}
+
 func (l *LoxClass) findMethod(name string) *LoxFunction {
 	if method, ok := l.methods[name]; ok {
 		return method
@@ -50,6 +68,61 @@ func (l *LoxClass) findMethod(name string) *LoxFunction {
 	return nil
 }
 
+// find looks name up in the table of l or of its nearest superclass that
+// has it.
+func (l *LoxClass) find(name string, table func(*LoxClass) map[string]*LoxFunction) *LoxFunction {
+	for class := l; class != nil; class = class.superclass {
+		if method, ok := table(class)[name]; ok {
+			return method
+		}
+	}
+	return nil
+}
+
+func statics(l *LoxClass) map[string]*LoxFunction { return l.statics }
+func getters(l *LoxClass) map[string]*LoxFunction { return l.getters }
+func setters(l *LoxClass) map[string]*LoxFunction { return l.setters }
+
+// Get reads a class method, bound to the class.
+func (l *LoxClass) Get(interpreter *TreeWalkInterpreter, name *token.Token) (interface{}, error) {
+	return l.property(interpreter, l, name)
+}
+
+// property reads name from l's class methods for this, which is l or a
+// subclass.
+func (l *LoxClass) property(interpreter *TreeWalkInterpreter, this *LoxClass, name *token.Token) (interface{}, error) {
+	if method := l.find(name.Lexeme, statics); method != nil {
+		return interpreter.bind(method, this, name)
+	}
+	return nil, failure.RuntimeError{Token: name, Message: "Undefined property '" + name.Lexeme + "'."}
+}
+
+// instanceProperty reads name from l's getters and methods for instance,
+// whose class is l or a subclass. Getters are called, methods are bound.
+func (l *LoxClass) instanceProperty(interpreter *TreeWalkInterpreter, instance *LoxInstance, name *token.Token) (interface{}, error) {
+	if getter := l.find(name.Lexeme, getters); getter != nil {
+		bound, err := interpreter.bind(getter, instance, name)
+		if err != nil {
+			return nil, err
+		}
+		return bound.Call(interpreter, name, nil)
+	}
+
+	if method := l.findMethod(name.Lexeme); method != nil {
+		return interpreter.bind(method, instance, name)
+	}
+
+	return nil, failure.RuntimeError{Token: name, Message: "Undefined property '" + name.Lexeme + "'."}
+}
+
+// PropertyAccessor is a Go value whose properties scripts can read and
+// assign, such as a *native.Object. Errors are reported as runtime errors at
+// the property name.
+type PropertyAccessor interface {
+	Get(name string) (interface{}, error)
+	Set(name string, value interface{}) error
+}
+
 type LoxInstance struct {
 	class  *LoxClass
 	fields map[string]interface{}
@@ -59,22 +132,53 @@ func NewLoxInstance(class *LoxClass) *LoxInstance {
 	return &LoxInstance{class: class, fields: make(map[string]interface{})}
 }
 
-func (l *LoxInstance) Get(name *token.Token) interface{} {
+func (l *LoxInstance) Get(interpreter *TreeWalkInterpreter, name *token.Token) (interface{}, error) {
 	if value, ok := l.fields[name.Lexeme]; ok {
-		return value
+		return value, nil
+	}
+
+	return l.class.instanceProperty(interpreter, l, name)
+}
+
+// Set calls the setter for name if the class has one, or else assigns the
+// field.
+func (l *LoxInstance) Set(interpreter *TreeWalkInterpreter, name *token.Token, value interface{}) error {
+	if setter := l.class.find(name.Lexeme, setters); setter != nil {
+		bound, err := interpreter.bind(setter, l, name)
+		if err != nil {
+			return err
+		}
+		_, err = bound.Call(interpreter, name, []interface{}{value})
+		return err
 	}
 
-	if method := l.class.findMethod(name.Lexeme); method != nil {
-		return method.Bind(l)
+	if _, ok := l.fields[name.Lexeme]; !ok {
+		if err := interpreter.Grow(heap.FieldSize, name); err != nil {
+			return err
+		}
 	}
+	l.fields[name.Lexeme] = value
+	return nil
+}
 
-	panic(failure.RuntimeError{Token: name, Message: "Undefined property '" + name.Lexeme + "'."})
+// ClassName is the name of the instance's class.
+func (l *LoxInstance) ClassName() string {
+	return l.class.name
 }
 
-func (l *LoxInstance) Set(name *token.Token, value interface{}) {
-	l.fields[name.Lexeme] = value
+// Fields returns a copy of the instance's fields.
+func (l *LoxInstance) Fields() map[string]interface{} {
+	fields := make(map[string]interface{}, len(l.fields))
+	for name, value := range l.fields {
+		fields[name] = value
+	}
+	return fields
 }
 
 func (l *LoxInstance) String() string {
 	return l.class.name + " instance"
 }
+
+func (l *LoxInstance) TypeName() string {
+	return "instance"
+}
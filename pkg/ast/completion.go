@@ -0,0 +1,55 @@
+package ast
+
+import (
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/token"
+)
+
+type CompletionKind int
+
+const (
+	CompletionNormal CompletionKind = iota
+	CompletionReturn
+	CompletionBreak
+	CompletionContinue
+	CompletionError
+)
+
+// Completion is how executing a statement or evaluating an expression ended.
+// Value holds an expression's value, the value being returned, or for
+// CompletionError the error. Expressions only complete normally or with an
+// error, and break and continue never escape the loop they are in.
+type Completion struct {
+	Kind  CompletionKind
+	Value interface{}
+}
+
+func normal(value interface{}) Completion {
+	return Completion{Kind: CompletionNormal, Value: value}
+}
+
+func returned(value interface{}) Completion {
+	return Completion{Kind: CompletionReturn, Value: value}
+}
+
+func failed(err error) Completion {
+	return Completion{Kind: CompletionError, Value: err}
+}
+
+func runtimeError(tok *token.Token, message string) Completion {
+	return failed(failure.RuntimeError{Token: tok, Message: message})
+}
+
+// Abrupt reports whether execution must stop unwinding to the nearest loop,
+// function call or to the top level.
+func (c Completion) Abrupt() bool {
+	return c.Kind != CompletionNormal
+}
+
+// Err returns the runtime error of a CompletionError.
+func (c Completion) Err() error {
+	if c.Kind != CompletionError {
+		return nil
+	}
+	return c.Value.(error)
+}
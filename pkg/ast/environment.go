@@ -7,9 +7,13 @@ import (
 	"github.com/mkeesey/craftinginterpreters/pkg/token"
 )
 
+// Environment holds the variables of one scope. Globals are looked up by
+// name. A local scope stores its variables in declaration order, which is the
+// slot the Resolver assigns each one, so resolved accesses are array indexing.
 type Environment struct {
 	enclosing *Environment
 	values    map[string]interface{}
+	slots     []interface{}
 }
 
 func NewEnvironment() *Environment {
@@ -22,12 +26,17 @@ func NewEnvironment() *Environment {
 func WithEnvironment(enclosing *Environment) *Environment {
 	return &Environment{
 		enclosing: enclosing,
-		values:    map[string]interface{}{},
 	}
 }
 
+// Define adds a variable. In a local scope the name is only documentation;
+// the variable takes the next slot.
 func (e *Environment) Define(name string, value interface{}) {
-	e.values[name] = value
+	if e.values != nil {
+		e.values[name] = value
+		return
+	}
+	e.slots = append(e.slots, value)
 }
 
 func (e *Environment) Assign(tok *token.Token, value interface{}) error {
@@ -44,10 +53,8 @@ func (e *Environment) Assign(tok *token.Token, value interface{}) error {
 	return failure.RuntimeError{Token: tok, Message: fmt.Sprintf("Undefined variable '%s'.", tok.Lexeme)}
 }
 
-func (e *Environment) AssignAt(distance int, tok *token.Token, value interface{}) error {
-	env := e.ancestor(distance)
-	env.values[tok.Lexeme] = value
-	return nil
+func (e *Environment) AssignAt(distance int, slot int, value interface{}) {
+	e.ancestor(distance).slots[slot] = value
 }
 
 func (e *Environment) Get(name *token.Token) (interface{}, error) {
@@ -63,14 +70,16 @@ func (e *Environment) Get(name *token.Token) (interface{}, error) {
 	return nil, failure.RuntimeError{Token: name, Message: fmt.Sprintf("Undefined variable '%s'.", name.Lexeme)}
 }
 
-func (e *Environment) GetAt(distance int, name string) interface{} {
+func (e *Environment) GetAt(distance int, slot int) interface{} {
 	env := e.ancestor(distance)
-	val, ok := env.values[name]
-	if ok {
-		return val
+	if slot >= len(env.slots) {
+		panic(fmt.Sprintf("Undefined slot %d which was supposed to be a defined local.", slot))
 	}
+	return env.slots[slot]
+}
 
-	panic(fmt.Sprintf("Undefined variable '%s' which was supposed to be a defined local.", name))
+func (e *Environment) size() int {
+	return len(e.values) + len(e.slots)
 }
 
 func (e *Environment) ancestor(distance int) *Environment {
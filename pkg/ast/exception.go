@@ -0,0 +1,97 @@
+package ast
+
+import (
+	"errors"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/heap"
+)
+
+// errorClass is the class of the instances runtime errors are caught as.
+// It has no methods, so every interpreter can share it.
+var errorClass = NewLoxClass("Error", nil, nil)
+
+func (p *TreeWalkInterpreter) VisitThrow(e *Throw) Completion {
+	value := p.evaluate(e.Value)
+	if value.Abrupt() {
+		return value
+	}
+	return failed(failure.RuntimeError{Token: e.Keyword, Message: ThrownMessage(value.Value), Thrown: true, Value: value.Value})
+}
+
+func (p *TreeWalkInterpreter) VisitTry(e *Try) Completion {
+	completion := p.executeBlock(e.Body, WithEnvironment(p.env))
+	if err, ok := catchable(completion); ok && e.CatchName != nil {
+		completion = p.catch(e, err)
+	}
+	if _, ok := catchable(completion); completion.Kind == CompletionError && !ok {
+		// fatal errors skip finally clauses too
+		return completion
+	}
+
+	if e.FinallyBody != nil {
+		// a finally body that jumps or fails replaces how the try ended
+		if finally := p.executeBlock(e.FinallyBody, WithEnvironment(p.env)); finally.Abrupt() {
+			return finally
+		}
+	}
+	return completion
+}
+
+// catchable returns the error c failed with, if a try statement can catch
+// it.
+func catchable(c Completion) (failure.RuntimeError, bool) {
+	var err failure.RuntimeError
+	if c.Kind != CompletionError || !errors.As(c.Err(), &err) {
+		return err, false
+	}
+	return err, !err.Fatal
+}
+
+// catch runs the catch clause of e for err.
+func (p *TreeWalkInterpreter) catch(e *Try, err failure.RuntimeError) Completion {
+	value, caughtErr := p.caught(err)
+	if caughtErr != nil {
+		return failed(caughtErr)
+	}
+	env := WithEnvironment(p.env)
+	if err := p.define(env, e.CatchName, e.CatchName.Lexeme, value); err != nil {
+		return failed(err)
+	}
+	return p.executeBlock(e.CatchBody, env)
+}
+
+// caught returns the value a catch clause binds for err: the thrown value,
+// or for errors the interpreter raised, an Error instance holding the
+// message and line.
+func (p *TreeWalkInterpreter) caught(err failure.RuntimeError) (interface{}, error) {
+	if err.Thrown {
+		return err.Value, nil
+	}
+	fields := CaughtFields(err)
+	if err := p.Allocate(heap.Instance, heap.InstanceSize+len(fields)*heap.FieldSize, err.Token); err != nil {
+		return nil, err
+	}
+	return &LoxInstance{class: errorClass, fields: fields}, nil
+}
+
+// CaughtFields are the fields of the Error instance a catch clause binds for
+// err, a runtime error the interpreter raised.
+func CaughtFields(err failure.RuntimeError) map[string]interface{} {
+	return map[string]interface{}{
+		"message": err.Message,
+		"line":    float64(err.Token.Line),
+	}
+}
+
+// ThrownMessage describes a thrown value for when it isn't caught: by its
+// message field if it is an instance with a string one, or else by the value
+// itself.
+func ThrownMessage(value interface{}) string {
+	if instance, ok := value.(Instance); ok {
+		if message, ok := instance.Fields()["message"].(string); ok {
+			return message
+		}
+	}
+	return stringify(value)
+}
@@ -20,6 +20,12 @@ type ExprVisitor[T any] interface {
 	VisitThis(*This) T
 	VisitUnary(*Unary) T
 	VisitExprVar(*ExprVar) T
+	VisitInterpolation(*Interpolation) T
+	VisitLambda(*Lambda) T
+	VisitList(*List) T
+	VisitMap(*Map) T
+	VisitIndex(*Index) T
+	VisitSetIndex(*SetIndex) T
 }
 
 func VisitExpr[T any](expr Expr, visitor ExprVisitor[T]) T {
@@ -48,6 +54,18 @@ func VisitExpr[T any](expr Expr, visitor ExprVisitor[T]) T {
 		return visitor.VisitUnary(n)
 	case *ExprVar:
 		return visitor.VisitExprVar(n)
+	case *Interpolation:
+		return visitor.VisitInterpolation(n)
+	case *Lambda:
+		return visitor.VisitLambda(n)
+	case *List:
+		return visitor.VisitList(n)
+	case *Map:
+		return visitor.VisitMap(n)
+	case *Index:
+		return visitor.VisitIndex(n)
+	case *SetIndex:
+		return visitor.VisitSetIndex(n)
 	default:
 		panic(fmt.Sprintf("Unknown Expr type %T", expr))
 	}
@@ -141,4 +159,50 @@ type ExprVar struct {
 
 func (b *ExprVar) expr() {}
 
+type Interpolation struct {
+	Start *token.Token
+	Parts []Expr
+}
+
+func (b *Interpolation) expr() {}
+
+type Lambda struct {
+	Keyword *token.Token
+	Function *Function
+}
+
+func (b *Lambda) expr() {}
+
+type List struct {
+	Bracket *token.Token
+	Elements []Expr
+}
+
+func (b *List) expr() {}
+
+type Map struct {
+	Brace *token.Token
+	Keys []Expr
+	Values []Expr
+}
+
+func (b *Map) expr() {}
+
+type Index struct {
+	Object Expr
+	Bracket *token.Token
+	Index Expr
+}
+
+func (b *Index) expr() {}
+
+type SetIndex struct {
+	Object Expr
+	Bracket *token.Token
+	Index Expr
+	Value Expr
+}
+
+func (b *SetIndex) expr() {}
+
 
@@ -0,0 +1,65 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// stringify formats value the way print shows it.
+func stringify(value interface{}) string {
+	var b strings.Builder
+	format(&b, value, false, make(map[interface{}]bool))
+	return b.String()
+}
+
+// format writes value to b. Strings inside lists and maps are quoted. seen
+// holds the collections being written, so one that contains itself prints
+// as [...] or {...} rather than forever.
+func format(b *strings.Builder, value interface{}, nested bool, seen map[interface{}]bool) {
+	switch v := value.(type) {
+	case nil:
+		b.WriteString("nil")
+	case string:
+		if nested {
+			b.WriteString(`"` + v + `"`)
+		} else {
+			b.WriteString(v)
+		}
+	case *LoxList:
+		if seen[v] {
+			b.WriteString("[...]")
+			return
+		}
+		seen[v] = true
+		defer delete(seen, v)
+
+		b.WriteByte('[')
+		for i, element := range v.elements {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			format(b, element, true, seen)
+		}
+		b.WriteByte(']')
+	case *LoxMap:
+		if seen[v] {
+			b.WriteString("{...}")
+			return
+		}
+		seen[v] = true
+		defer delete(seen, v)
+
+		b.WriteByte('{')
+		for i, key := range v.keys {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			format(b, key, true, seen)
+			b.WriteString(": ")
+			format(b, v.values[key], true, seen)
+		}
+		b.WriteByte('}')
+	default:
+		fmt.Fprint(b, v)
+	}
+}
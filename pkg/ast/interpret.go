@@ -2,151 +2,366 @@ package ast
 
 import (
 	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
 
 	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/heap"
+	"github.com/mkeesey/craftinginterpreters/pkg/native"
+	"github.com/mkeesey/craftinginterpreters/pkg/stdlib"
 	"github.com/mkeesey/craftinginterpreters/pkg/token"
 )
 
-// ExprVisitor[interface{}]
-// StmtVisitor
+// ExprVisitor[Completion]
+// StmtVisitor[Completion]
 type TreeWalkInterpreter struct {
 	env       *Environment
 	globalEnv *Environment
-	locals    map[Expr]int
-	reporter  *failure.Reporter
+	// scopes are the environments blocks will restore once they finish,
+	// innermost last
+	scopes   []*Environment
+	locals   map[Expr]local
+	heap     *heap.Heap
+	reporter *failure.Reporter
+	out      io.Writer
+	// interrupt stops the program once closed
+	interrupt <-chan struct{}
+	// modules loads imports, which fail without it
+	modules *ModuleLoader
+	// exports are the names of the exported globals
+	exports map[string]bool
 }
 
 func NewInterpreter(reporter *failure.Reporter) *TreeWalkInterpreter {
+	h := heap.New(0)
+	p := newInterpreter(reporter, h)
+	h.PushRoots(p.markRoots)
+	return p
+}
+
+// newInterpreter returns an interpreter with only the natives defined, which
+// charges allocations to h.
+func newInterpreter(reporter *failure.Reporter, h *heap.Heap) *TreeWalkInterpreter {
 	globalEnv := NewEnvironment()
 
 	globalEnv.Define("clock", &TimeCallable{})
 
-	return &TreeWalkInterpreter{
+	p := &TreeWalkInterpreter{
 		globalEnv: globalEnv,
 		env:       globalEnv,
-		locals:    make(map[Expr]int),
+		locals:    make(map[Expr]local),
+		heap:      h,
 		reporter:  reporter,
+		out:       os.Stdout,
+	}
+	if err := stdlib.Install(p); err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// SetOutput redirects print statements, which go to stdout by default.
+func (p *TreeWalkInterpreter) SetOutput(w io.Writer) {
+	p.out = w
+}
+
+// SetMaxHeap limits the estimated bytes of live data a script may hold. Zero
+// means no limit.
+func (p *TreeWalkInterpreter) SetMaxHeap(bytes int) {
+	p.heap.SetMaxHeap(bytes)
+}
+
+func (p *TreeWalkInterpreter) HeapStats() heap.Stats {
+	return p.heap.Stats()
+}
+
+// SetInterrupt makes the program stop with a runtime error once done is
+// closed. It is checked on each loop iteration and function call.
+func (p *TreeWalkInterpreter) SetInterrupt(done <-chan struct{}) {
+	p.interrupt = done
+}
+
+// DefineGlobal defines or redefines a global variable from Go. Go slices
+// become lists.
+func (p *TreeWalkInterpreter) DefineGlobal(name string, value interface{}) {
+	p.globalEnv.Define(name, FromHost(value))
+}
+
+// DefineNative defines a global function that calls fn, a Go function whose
+// parameters and results are converted as described by native.Wrap. An
+// error returned by fn becomes a runtime error at the call.
+func (p *TreeWalkInterpreter) DefineNative(name string, fn interface{}) error {
+	wrapped, err := native.Wrap(name, fn)
+	if err != nil {
+		return err
 	}
+	p.globalEnv.Define(name, &NativeCallable{fn: wrapped})
+	return nil
+}
+
+// Global returns the value of a global variable.
+func (p *TreeWalkInterpreter) Global(name string) (interface{}, bool) {
+	value, ok := p.globalEnv.values[name]
+	return value, ok
 }
 
 func (p *TreeWalkInterpreter) Interpret(statements []Stmt) {
-	defer func() {
-		if r := recover(); r != nil {
-			p.reporter.RuntimeError(r)
+	p.Eval(statements)
+}
+
+// Eval runs statements like Interpret. If the last statement is an
+// expression statement, its value is returned.
+func (p *TreeWalkInterpreter) Eval(statements []Stmt) interface{} {
+	var result interface{}
+	for i, stmt := range statements {
+		var completion Completion
+		if expression, ok := stmt.(*Expression); ok && i == len(statements)-1 {
+			completion = p.evaluate(expression.Expression)
+			result = completion.Value
+		} else {
+			completion = p.execute(stmt)
 		}
-	}()
-	for _, stmt := range statements {
-		VisitStmt(stmt, p)
+		if completion.Kind == CompletionError {
+			p.reporter.RuntimeError(completion.Err())
+			return nil
+		}
+	}
+	return result
+}
+
+// interrupted returns a runtime error at tok if the interrupt channel has
+// been closed.
+func (p *TreeWalkInterpreter) interrupted(tok *token.Token) error {
+	select {
+	case <-p.interrupt:
+		return failure.RuntimeError{Token: tok, Message: "Interrupted.", Fatal: true}
+	default:
+		return nil
 	}
 }
 
-func (p *TreeWalkInterpreter) VisitAssign(e *Assign) interface{} {
+func (p *TreeWalkInterpreter) VisitAssign(e *Assign) Completion {
 	value := p.evaluate(e.Value)
+	if value.Abrupt() {
+		return value
+	}
 
-	if distance, ok := p.locals[e]; ok {
-		err := p.env.AssignAt(distance, e.Name, value)
-		if err != nil {
-			panic(err)
-		}
-	} else {
-		err := p.globalEnv.Assign(e.Name, value)
-		if err != nil {
-			panic(err)
-		}
+	if local, ok := p.locals[e]; ok {
+		p.env.AssignAt(local.distance, local.slot, value.Value)
+	} else if err := p.globalEnv.Assign(e.Name, value.Value); err != nil {
+		return failed(err)
 	}
 
 	return value
 }
 
-func (p *TreeWalkInterpreter) VisitBinary(e *Binary) interface{} {
+func (p *TreeWalkInterpreter) VisitBinary(e *Binary) Completion {
 	left := p.evaluate(e.Left)
+	if left.Abrupt() {
+		return left
+	}
 	right := p.evaluate(e.Right)
+	if right.Abrupt() {
+		return right
+	}
 
-	switch e.Operator.Type {
+	return p.binary(e.Operator, left.Value, right.Value)
+}
+
+func (p *TreeWalkInterpreter) binary(operator *token.Token, left interface{}, right interface{}) Completion {
+	if _, ok := left.(*LoxInstance); ok {
+		result, err := Operator(p, operator, left, right)
+		if err != nil {
+			return failed(err)
+		}
+		return normal(result)
+	}
+
+	switch operator.Type {
 	case token.PLUS:
 		leftFloat, isLeftFloat := left.(float64)
 		rightFloat, isRightFloat := right.(float64)
 		if isLeftFloat && isRightFloat {
-			return leftFloat + rightFloat
+			return normal(leftFloat + rightFloat)
 		}
 
 		leftStr, isLeftStr := left.(string)
 		rightStr, isRightStr := right.(string)
 		if isLeftStr && isRightStr {
-			return leftStr + rightStr
+			result := leftStr + rightStr
+			if err := p.Allocate(heap.String, heap.StringSize(result), operator); err != nil {
+				return failed(err)
+			}
+			return normal(result)
 		}
 
-		panic(failure.RuntimeError{Token: e.Operator, Message: "Operands must be two numbers or two strings."})
+		return runtimeError(operator, "Operands must be two numbers or two strings.")
+	case token.EQUAL_EQUAL:
+		// TODO - ensure this matches lox requirements
+		return normal(left == right)
+	case token.BANG_EQUAL:
+		return normal(left != right)
+	}
+
+	leftFloat, isLeftFloat := left.(float64)
+	rightFloat, isRightFloat := right.(float64)
+	if !isLeftFloat || !isRightFloat {
+		return runtimeError(operator, "Operands must be numbers.")
+	}
+
+	switch operator.Type {
 	case token.MINUS:
-		return requireFloat64(left, e.Operator, "Operands must be numbers.") - requireFloat64(right, e.Operator, "Operands must be numbers.")
+		return normal(leftFloat - rightFloat)
 	case token.SLASH:
-		return requireFloat64(left, e.Operator, "Operands must be numbers.") / requireFloat64(right, e.Operator, "Operands must be numbers.")
+		return normal(leftFloat / rightFloat)
 	case token.STAR:
-		return requireFloat64(left, e.Operator, "Operands must be numbers.") * requireFloat64(right, e.Operator, "Operands must be numbers.")
+		return normal(leftFloat * rightFloat)
+	case token.SLASH_SLASH:
+		return normal(FloorDivide(leftFloat, rightFloat))
+	case token.PERCENT:
+		return normal(Modulo(leftFloat, rightFloat))
+	case token.STAR_STAR:
+		return normal(math.Pow(leftFloat, rightFloat))
+	case token.AMPERSAND, token.PIPE, token.CARET, token.LESS_LESS, token.GREATER_GREATER:
+		result, err := Bitwise(operator.Type, leftFloat, rightFloat)
+		if err != nil {
+			return runtimeError(operator, err.Error())
+		}
+		return normal(result)
 	case token.GREATER:
-		return requireFloat64(left, e.Operator, "Operands must be numbers.") > requireFloat64(right, e.Operator, "Operands must be numbers.")
+		return normal(leftFloat > rightFloat)
 	case token.GREATER_EQUAL:
-		return requireFloat64(left, e.Operator, "Operands must be numbers.") >= requireFloat64(right, e.Operator, "Operands must be numbers.")
+		return normal(leftFloat >= rightFloat)
 	case token.LESS:
-		return requireFloat64(left, e.Operator, "Operands must be numbers.") < requireFloat64(right, e.Operator, "Operands must be numbers.")
+		return normal(leftFloat < rightFloat)
 	case token.LESS_EQUAL:
-		return requireFloat64(left, e.Operator, "Operands must be numbers.") <= requireFloat64(right, e.Operator, "Operands must be numbers.")
-	case token.EQUAL_EQUAL:
-		// TODO - ensure this matches lox requirements
-		return left == right
-	case token.BANG_EQUAL:
-		return left != right
+		return normal(leftFloat <= rightFloat)
 	}
 
-	panic(failure.RuntimeError{Token: e.Operator, Message: fmt.Sprintf("unknown operator type %s.", e.Operator.Type)})
+	return runtimeError(operator, fmt.Sprintf("unknown operator type %s.", operator.Type))
 }
 
-func (p *TreeWalkInterpreter) VisitCall(e *Call) interface{} {
+func (p *TreeWalkInterpreter) VisitCall(e *Call) Completion {
 	callee := p.evaluate(e.Callee)
+	if callee.Abrupt() {
+		return callee
+	}
 
-	args := make([]interface{}, 0)
+	args := make([]interface{}, 0, len(e.Arguments))
 	for _, arg := range e.Arguments {
-		args = append(args, p.evaluate(arg))
+		value := p.evaluate(arg)
+		if value.Abrupt() {
+			return value
+		}
+		args = append(args, value.Value)
 	}
 
+	ret, err := p.Call(callee.Value, e.Paren, args)
+	if err != nil {
+		return failed(err)
+	}
+	return normal(ret)
+}
+
+// Call calls callee with args, checking it is callable and takes that many
+// arguments. paren locates runtime errors.
+func (p *TreeWalkInterpreter) Call(callee interface{}, paren *token.Token, args []interface{}) (interface{}, error) {
 	function, ok := callee.(Callable)
 	if !ok {
-		panic(failure.RuntimeError{Token: e.Paren, Message: fmt.Sprintf("Can only call functions and classes.")})
+		return nil, failure.RuntimeError{Token: paren, Message: "Can only call functions and classes."}
 	}
-	if len(args) != function.Arity() {
-		panic(failure.RuntimeError{Token: e.Paren, Message: fmt.Sprintf("Expected %d arguments but got %d.", function.Arity(), len(args))})
+	if arity := function.Arity(); arity >= 0 && len(args) != arity {
+		return nil, failure.RuntimeError{Token: paren, Message: fmt.Sprintf("Expected %d arguments but got %d.", arity, len(args))}
 	}
-
-	ret := function.Call(p, args)
-
-	return ret
+	return function.Call(p, paren, args)
 }
 
-func (p *TreeWalkInterpreter) VisitGet(e *Get) interface{} {
+func (p *TreeWalkInterpreter) VisitGet(e *Get) Completion {
 	obj := p.evaluate(e.Object)
-	if instance, ok := obj.(*LoxInstance); ok {
-		return instance.Get(e.Name)
+	if obj.Abrupt() {
+		return obj
+	}
+
+	if value, ok, err := Property(p, obj.Value, e.Name); ok {
+		if err != nil {
+			return failed(err)
+		}
+		return normal(value)
 	}
-	panic(failure.RuntimeError{Token: e.Name, Message: "Only instances have properties."})
+
+	switch object := obj.Value.(type) {
+	case *LoxInstance:
+		value, err := object.Get(p, e.Name)
+		if err != nil {
+			return failed(err)
+		}
+		return normal(value)
+	case *LoxClass:
+		value, err := object.Get(p, e.Name)
+		if err != nil {
+			return failed(err)
+		}
+		return normal(value)
+	case PropertyAccessor:
+		value, err := object.Get(e.Name.Lexeme)
+		if err != nil {
+			return runtimeError(e.Name, err.Error())
+		}
+		return normal(FromHost(value))
+	}
+	return runtimeError(e.Name, "Only instances have properties.")
 }
 
-func (p *TreeWalkInterpreter) VisitGrouping(e *Grouping) interface{} {
+func (p *TreeWalkInterpreter) VisitGrouping(e *Grouping) Completion {
 	return p.evaluate(e.Expression)
 }
 
-func (p *TreeWalkInterpreter) VisitLiteral(e *Literal) interface{} {
-	return e.Value
+func (p *TreeWalkInterpreter) VisitInterpolation(e *Interpolation) Completion {
+	var b strings.Builder
+	for _, part := range e.Parts {
+		value := p.evaluate(part)
+		if value.Abrupt() {
+			return value
+		}
+		str, err := Str(p, e.Start, value.Value)
+		if err != nil {
+			return failed(err)
+		}
+		b.WriteString(str)
+	}
+
+	result := b.String()
+	if err := p.Allocate(heap.String, heap.StringSize(result), e.Start); err != nil {
+		return failed(err)
+	}
+	return normal(result)
+}
+
+func (p *TreeWalkInterpreter) VisitLambda(e *Lambda) Completion {
+	if err := p.Allocate(heap.Closure, heap.ClosureSize, e.Keyword); err != nil {
+		return failed(err)
+	}
+	return normal(NewLoxFunction(e.Function, p.env, false))
 }
 
-func (p *TreeWalkInterpreter) VisitLogical(e *Logical) interface{} {
+func (p *TreeWalkInterpreter) VisitLiteral(e *Literal) Completion {
+	return normal(e.Value)
+}
+
+func (p *TreeWalkInterpreter) VisitLogical(e *Logical) Completion {
 	left := p.evaluate(e.Left)
+	if left.Abrupt() {
+		return left
+	}
 
 	if e.Operator.Type == token.OR {
-		if isTruthy(left) {
+		if isTruthy(left.Value) {
 			return left
 		}
 	} else {
-		if !isTruthy(left) {
+		if !isTruthy(left.Value) {
 			return left
 		}
 	}
@@ -154,182 +369,437 @@ func (p *TreeWalkInterpreter) VisitLogical(e *Logical) interface{} {
 	return p.evaluate(e.Right)
 }
 
-func (p *TreeWalkInterpreter) VisitSet(e *Set) interface{} {
+func (p *TreeWalkInterpreter) VisitSet(e *Set) Completion {
 	obj := p.evaluate(e.Object)
-	if instance, ok := obj.(*LoxInstance); ok {
-		value := p.evaluate(e.Value)
-		instance.Set(e.Name, value)
+	if obj.Abrupt() {
+		return obj
+	}
+
+	instance, isInstance := obj.Value.(*LoxInstance)
+	accessor, isAccessor := obj.Value.(PropertyAccessor)
+	if !isInstance && !isAccessor {
+		return runtimeError(e.Name, "Only instances have fields.")
+	}
+	value := p.evaluate(e.Value)
+	if value.Abrupt() {
 		return value
 	}
-	panic(failure.RuntimeError{Token: e.Name, Message: "Only instances have fields."})
+
+	if isInstance {
+		if err := instance.Set(p, e.Name, value.Value); err != nil {
+			return failed(err)
+		}
+	} else if err := accessor.Set(e.Name.Lexeme, value.Value); err != nil {
+		return runtimeError(e.Name, err.Error())
+	}
+	return value
 }
 
-func (p *TreeWalkInterpreter) VisitSuper(super *Super) interface{} {
-	distance := p.locals[super]
-	superVal := p.env.GetAt(distance, "super")
-	thisVal := p.env.GetAt(distance-1, "this")
+func (p *TreeWalkInterpreter) VisitIndex(e *Index) Completion {
+	obj := p.evaluate(e.Object)
+	if obj.Abrupt() {
+		return obj
+	}
+	index := p.evaluate(e.Index)
+	if index.Abrupt() {
+		return index
+	}
 
-	superclass, ok := superVal.(*LoxClass)
-	if !ok {
-		panic(failure.RuntimeError{Token: super.Keyword, Message: fmt.Sprintf("%s Could not convert super to LoxClass", super.Method.Lexeme)})
+	value, err := ReadIndex(p, e.Bracket, obj.Value, index.Value)
+	if err != nil {
+		return failed(err)
+	}
+	return normal(value)
+}
+
+func (p *TreeWalkInterpreter) VisitSetIndex(e *SetIndex) Completion {
+	obj := p.evaluate(e.Object)
+	if obj.Abrupt() {
+		return obj
+	}
+	index := p.evaluate(e.Index)
+	if index.Abrupt() {
+		return index
+	}
+	value := p.evaluate(e.Value)
+	if value.Abrupt() {
+		return value
 	}
 
-	this, ok := thisVal.(*LoxInstance)
+	if err := AssignIndex(p, e.Bracket, obj.Value, index.Value, value.Value); err != nil {
+		return failed(err)
+	}
+	return value
+}
+
+func (p *TreeWalkInterpreter) VisitSuper(super *Super) Completion {
+	// 'super' and 'this' are each alone in their scopes
+	distance := p.locals[super].distance
+	superVal := p.env.GetAt(distance, 0)
+	thisVal := p.env.GetAt(distance-1, 0)
+
+	superclass, ok := superVal.(*LoxClass)
 	if !ok {
-		panic(failure.RuntimeError{Token: super.Keyword, Message: fmt.Sprintf("%s Could not convert this value to LoxInstance", super.Method.Lexeme)})
+		return runtimeError(super.Keyword, fmt.Sprintf("%s Could not convert super to LoxClass", super.Method.Lexeme))
 	}
 
-	method := superclass.findMethod(super.Method.Lexeme)
-	if method == nil {
-		panic(failure.RuntimeError{Token: super.Keyword, Message: fmt.Sprintf("Undefined property '%s'.", super.Method.Lexeme)})
+	var value interface{}
+	var err error
+	switch this := thisVal.(type) {
+	case *LoxInstance:
+		value, err = superclass.instanceProperty(p, this, super.Method)
+	case *LoxClass: // in a class method
+		value, err = superclass.property(p, this, super.Method)
+	default:
+		return runtimeError(super.Keyword, fmt.Sprintf("%s Could not convert this value to LoxInstance", super.Method.Lexeme))
+	}
+	if err != nil {
+		return failed(err)
 	}
-	return method.Bind(this)
+	return normal(value)
 }
 
-func (p *TreeWalkInterpreter) VisitThis(e *This) interface{} {
+func (p *TreeWalkInterpreter) VisitThis(e *This) Completion {
 	this, err := p.lookupVariable(e.Keyword, e)
 	if err != nil {
-		panic(err)
+		return failed(err)
 	}
-	return this
+	return normal(this)
 }
 
-func (p *TreeWalkInterpreter) VisitUnary(e *Unary) interface{} {
+func (p *TreeWalkInterpreter) VisitUnary(e *Unary) Completion {
 	right := p.evaluate(e.Right)
+	if right.Abrupt() {
+		return right
+	}
 
 	switch e.Operator.Type {
 	case token.BANG:
-		val := isTruthy(right)
-		return !val
+		return normal(!isTruthy(right.Value))
 	case token.MINUS:
-		val := requireFloat64(right, e.Operator, "Operand must be a number.")
-		return -val
+		val, ok := right.Value.(float64)
+		if !ok {
+			return runtimeError(e.Operator, "Operand must be a number.")
+		}
+		return normal(-val)
+	case token.TILDE:
+		val, ok := right.Value.(float64)
+		if !ok {
+			return runtimeError(e.Operator, "Operand must be a number.")
+		}
+		result, err := Complement(val)
+		if err != nil {
+			return runtimeError(e.Operator, err.Error())
+		}
+		return normal(result)
 	}
 
-	panic(failure.RuntimeError{Token: e.Operator, Message: fmt.Sprintf("unknown operator type %s", e.Operator.Type)})
+	return runtimeError(e.Operator, fmt.Sprintf("unknown operator type %s", e.Operator.Type))
 }
 
-func (p *TreeWalkInterpreter) VisitExprVar(e *ExprVar) interface{} {
+func (p *TreeWalkInterpreter) VisitExprVar(e *ExprVar) Completion {
 	val, err := p.lookupVariable(e.Name, e)
 	if err != nil {
-		panic(err)
+		return failed(err)
 	}
-	return val
+	return normal(val)
 }
 
 func (p *TreeWalkInterpreter) lookupVariable(name *token.Token, expr Expr) (interface{}, error) {
-	distance, ok := p.locals[expr]
+	local, ok := p.locals[expr]
 	if ok {
-		return p.env.GetAt(distance, name.Lexeme), nil
+		return p.env.GetAt(local.distance, local.slot), nil
 	}
 	return p.globalEnv.Get(name)
 }
 
-func (p *TreeWalkInterpreter) VisitBlock(e *Block) {
+func (p *TreeWalkInterpreter) VisitBlock(e *Block) Completion {
 	env := WithEnvironment(p.env)
-	p.executeBlock(e.Statements, env)
+	return p.executeBlock(e.Statements, env)
 }
 
-func (p *TreeWalkInterpreter) executeBlock(stmts []Stmt, env *Environment) {
+// executeBlock runs stmts in env, stopping at the first abrupt completion.
+func (p *TreeWalkInterpreter) executeBlock(stmts []Stmt, env *Environment) Completion {
 	previous := p.env
+	p.env = env
+	p.scopes = append(p.scopes, previous)
 	defer func() {
+		p.scopes = p.scopes[:len(p.scopes)-1]
 		p.env = previous
 	}()
 
-	p.env = env
-
 	for _, stmt := range stmts {
-		VisitStmt(stmt, p)
+		if completion := p.execute(stmt); completion.Abrupt() {
+			return completion
+		}
 	}
+	return normal(nil)
 }
 
-func (p *TreeWalkInterpreter) VisitClass(class *Class) {
+func (p *TreeWalkInterpreter) VisitClass(class *Class) Completion {
 	var superclass *LoxClass = nil
 	if class.Superclass != nil {
+		value := p.evaluate(class.Superclass)
+		if value.Abrupt() {
+			return value
+		}
 		var ok bool
-		superclass, ok = p.evaluate(class.Superclass).(*LoxClass)
+		superclass, ok = value.Value.(*LoxClass)
 		if !ok {
-			panic(failure.RuntimeError{Token: class.Name, Message: "Superclass must be a class."})
+			return runtimeError(class.Name, "Superclass must be a class.")
 		}
 	}
 
-	p.env.Define(class.Name.Lexeme, nil)
+	classSlot := len(p.env.slots)
+	if err := p.define(p.env, class.Name, class.Name.Lexeme, nil); err != nil {
+		return failed(err)
+	}
 
+	// methods close over a scope holding 'super'
+	methodEnv := p.env
 	if superclass != nil {
-		p.env = WithEnvironment(p.env)
-		p.env.Define("super", superclass)
+		methodEnv = WithEnvironment(p.env)
+		if err := p.define(methodEnv, class.Name, "super", superclass); err != nil {
+			return failed(err)
+		}
 	}
 
 	methods := make(map[string]*LoxFunction)
 	for _, method := range class.Methods {
-		function := NewLoxFunction(method, p.env, method.Name.Lexeme == "init")
+		if err := p.Allocate(heap.Closure, heap.ClosureSize, method.Name); err != nil {
+			return failed(err)
+		}
+		function := NewLoxFunction(method, methodEnv, method.Name.Lexeme == "init")
 		methods[method.Name.Lexeme] = function
 	}
 
 	loxClass := NewLoxClass(class.Name.Lexeme, superclass, methods)
+	var err error
+	if loxClass.statics, err = p.methodTable(class.ClassMethods, methodEnv); err != nil {
+		return failed(err)
+	}
+	if loxClass.getters, err = p.methodTable(class.Getters, methodEnv); err != nil {
+		return failed(err)
+	}
+	if loxClass.setters, err = p.methodTable(class.Setters, methodEnv); err != nil {
+		return failed(err)
+	}
 
-	if superclass != nil {
-		p.env = p.env.enclosing
+	if p.env.values != nil {
+		if err := p.env.Assign(class.Name, loxClass); err != nil {
+			return failed(err)
+		}
+	} else {
+		p.env.slots[classSlot] = loxClass
 	}
+	return normal(nil)
+}
 
-	p.env.Assign(class.Name, loxClass)
+// methodTable makes functions of a class's methods, closing over env.
+func (p *TreeWalkInterpreter) methodTable(declarations []*Function, env *Environment) (map[string]*LoxFunction, error) {
+	table := make(map[string]*LoxFunction, len(declarations))
+	for _, declaration := range declarations {
+		if err := p.Allocate(heap.Closure, heap.ClosureSize, declaration.Name); err != nil {
+			return nil, err
+		}
+		table[declaration.Name.Lexeme] = NewLoxFunction(declaration, env, false)
+	}
+	return table, nil
 }
 
-func (p *TreeWalkInterpreter) resolve(expr Expr, depth int) {
-	p.locals[expr] = depth
+// local is where the Resolver found a local variable: how many scopes out
+// from the reference, and the variable's slot in that scope.
+type local struct {
+	distance int
+	slot     int
 }
 
-func (p *TreeWalkInterpreter) VisitExpression(e *Expression) {
-	p.evaluate(e.Expression)
+func (p *TreeWalkInterpreter) ResolveLocal(expr Expr, depth int, slot int) {
+	p.locals[expr] = local{distance: depth, slot: slot}
 }
 
-func (p *TreeWalkInterpreter) VisitIf(e *If) {
+func (p *TreeWalkInterpreter) VisitExpression(e *Expression) Completion {
+	value := p.evaluate(e.Expression)
+	if value.Abrupt() {
+		return value
+	}
+	return normal(nil)
+}
+
+func (p *TreeWalkInterpreter) VisitIf(e *If) Completion {
 	condition := p.evaluate(e.Condition)
-	if isTruthy(condition) {
-		VisitStmt(e.ThenBranch, p)
+	if condition.Abrupt() {
+		return condition
+	}
+
+	if isTruthy(condition.Value) {
+		return p.execute(e.ThenBranch)
 	} else if e.ElseBranch != nil {
-		VisitStmt(e.ElseBranch, p)
+		return p.execute(e.ElseBranch)
 	}
+	return normal(nil)
 }
 
-func (p *TreeWalkInterpreter) VisitPrint(e *Print) {
+func (p *TreeWalkInterpreter) VisitBreak(e *Break) Completion {
+	return Completion{Kind: CompletionBreak}
+}
+
+func (p *TreeWalkInterpreter) VisitContinue(e *Continue) Completion {
+	return Completion{Kind: CompletionContinue}
+}
+
+func (p *TreeWalkInterpreter) VisitPrint(e *Print) Completion {
 	val := p.evaluate(e.Expression)
-	if val == nil {
-		val = "nil"
+	if val.Abrupt() {
+		return val
+	}
+
+	str, err := Str(p, e.Keyword, val.Value)
+	if err != nil {
+		return failed(err)
 	}
-	fmt.Println(val)
+	fmt.Fprintln(p.out, str)
+	return normal(nil)
 }
 
-func (p *TreeWalkInterpreter) VisitReturn(e *Return) {
-	var value interface{}
-	if e.Value != nil {
-		value = p.evaluate(e.Value)
+func (p *TreeWalkInterpreter) VisitReturn(e *Return) Completion {
+	if e.Value == nil {
+		return returned(nil)
 	}
-	panic(returnval{value})
+
+	value := p.evaluate(e.Value)
+	if value.Abrupt() {
+		return value
+	}
+	return returned(value.Value)
 }
 
-func (p *TreeWalkInterpreter) VisitStmtVar(e *StmtVar) {
+func (p *TreeWalkInterpreter) VisitStmtVar(e *StmtVar) Completion {
 	var value interface{}
 	if e.Initializer != nil {
-		value = p.evaluate(e.Initializer)
+		initializer := p.evaluate(e.Initializer)
+		if initializer.Abrupt() {
+			return initializer
+		}
+		value = initializer.Value
 	}
 
-	p.env.Define(e.Name.Lexeme, value)
+	if err := p.define(p.env, e.Name, e.Name.Lexeme, value); err != nil {
+		return failed(err)
+	}
+	return normal(nil)
 }
 
-func (p *TreeWalkInterpreter) VisitFunction(e *Function) {
+func (p *TreeWalkInterpreter) VisitFunction(e *Function) Completion {
+	if err := p.Allocate(heap.Closure, heap.ClosureSize, e.Name); err != nil {
+		return failed(err)
+	}
 	function := NewLoxFunction(e, p.env, false)
-	p.env.Define(e.Name.Lexeme, function)
+	if err := p.define(p.env, e.Name, e.Name.Lexeme, function); err != nil {
+		return failed(err)
+	}
+	return normal(nil)
 }
 
-func (p *TreeWalkInterpreter) VisitWhile(e *While) {
-	for isTruthy(p.evaluate(e.Condition)) {
-		VisitStmt(e.Body, p)
+func (p *TreeWalkInterpreter) VisitWhile(e *While) Completion {
+	for {
+		condition := p.evaluate(e.Condition)
+		if condition.Abrupt() {
+			return condition
+		}
+		if !isTruthy(condition.Value) {
+			return normal(nil)
+		}
+		if err := p.interrupted(e.Keyword); err != nil {
+			return failed(err)
+		}
+
+		completion := p.execute(e.Body)
+		if completion.Kind == CompletionBreak {
+			return normal(nil)
+		}
+		if completion.Abrupt() && completion.Kind != CompletionContinue {
+			return completion
+		}
+
+		if e.Increment != nil {
+			if increment := p.evaluate(e.Increment); increment.Abrupt() {
+				return increment
+			}
+		}
 	}
 }
 
-func (p *TreeWalkInterpreter) evaluate(e Expr) interface{} {
-	return VisitExpr(e, p)
+// define declares name in env. The environment is charged to the heap when
+// its first variable is defined, so scopes that declare nothing are free.
+func (p *TreeWalkInterpreter) define(env *Environment, tok *token.Token, name string, value interface{}) error {
+	if env.size() == 0 {
+		if err := p.Allocate(heap.Environment, heap.EnvironmentSize, tok); err != nil {
+			return err
+		}
+	}
+	// only globals can be redefined
+	if _, ok := env.values[name]; !ok {
+		if err := p.Grow(heap.VariableSize, tok); err != nil {
+			return err
+		}
+	}
+	env.Define(name, value)
+	return nil
+}
+
+// bind binds method to instance, charging for the closure and the
+// environment holding 'this'.
+func (p *TreeWalkInterpreter) bind(method *LoxFunction, this interface{}, tok *token.Token) (*LoxFunction, error) {
+	if err := p.Allocate(heap.Closure, heap.ClosureSize, tok); err != nil {
+		return nil, err
+	}
+	if err := p.Allocate(heap.Environment, heap.EnvironmentSize+heap.VariableSize, tok); err != nil {
+		return nil, err
+	}
+	return method.Bind(this), nil
+}
+
+// Method returns the method name of value's class bound to value, or nil if
+// value isn't an instance or its class doesn't define name.
+func (p *TreeWalkInterpreter) Method(value interface{}, name string, tok *token.Token) (interface{}, error) {
+	instance, ok := value.(*LoxInstance)
+	if !ok {
+		return nil, nil
+	}
+	method := instance.class.findMethod(name)
+	if method == nil {
+		return nil, nil
+	}
+	bound, err := p.bind(method, instance, tok)
+	if err != nil {
+		return nil, err
+	}
+	return bound, nil
+}
+
+// Allocate charges for a new object of size bytes.
+func (p *TreeWalkInterpreter) Allocate(kind heap.Kind, size int, tok *token.Token) error {
+	if err := p.heap.Allocate(kind, size); err != nil {
+		return failure.RuntimeError{Token: tok, Message: err.Error()}
+	}
+	return nil
+}
+
+// Grow charges for an object growing by size bytes.
+func (p *TreeWalkInterpreter) Grow(size int, tok *token.Token) error {
+	if err := p.heap.Grow(size); err != nil {
+		return failure.RuntimeError{Token: tok, Message: err.Error()}
+	}
+	return nil
+}
+
+func (p *TreeWalkInterpreter) evaluate(e Expr) Completion {
+	return VisitExpr[Completion](e, p)
+}
+
+func (p *TreeWalkInterpreter) execute(s Stmt) Completion {
+	return VisitStmt[Completion](s, p)
 }
 
 func isTruthy(value interface{}) bool {
@@ -342,11 +812,3 @@ func isTruthy(value interface{}) bool {
 	}
 	return casted
 }
-
-func requireFloat64(value interface{}, token *token.Token, msg string) float64 {
-	val, ok := value.(float64)
-	if !ok {
-		panic(failure.RuntimeError{Token: token, Message: msg})
-	}
-	return val
-}
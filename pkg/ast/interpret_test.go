@@ -0,0 +1,139 @@
+package ast_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/ast"
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/parser"
+	"github.com/mkeesey/craftinginterpreters/pkg/scanner"
+	"github.com/stretchr/testify/require"
+)
+
+func run(t *testing.T, interpreter *ast.TreeWalkInterpreter, reporter *failure.Reporter, source string) {
+	t.Helper()
+	tokens := scanner.NewScanner(strings.NewReader(source), reporter).ScanTokens()
+	statements, err := parser.NewParser(tokens, reporter).Parse()
+	require.NoError(t, err)
+	ast.NewResolver(interpreter, reporter).Resolve(statements)
+	require.False(t, reporter.HasFailed())
+
+	interpreter.Interpret(statements)
+}
+
+func TestHeapStats(t *testing.T) {
+	reporter := &failure.Reporter{}
+	interpreter := ast.NewInterpreter(reporter)
+	run(t, interpreter, reporter, `class Point {
+  init(x) { this.x = x; }
+}
+var p = Point(1);
+var s = "a" + "b";`)
+	require.False(t, reporter.HasFailed())
+
+	stats := interpreter.HeapStats()
+	require.Equal(t, 1, stats.Instances)
+	require.Equal(t, 1, stats.Strings)
+	// the init method, and init bound to the new instance
+	require.Equal(t, 2, stats.Closures)
+	// the bound method's 'this' and the call's parameters
+	require.Equal(t, 2, stats.Environments)
+	require.Positive(t, stats.BytesAllocated)
+}
+
+func TestHeapLimit(t *testing.T) {
+	reporter := &failure.Reporter{}
+	interpreter := ast.NewInterpreter(reporter)
+	interpreter.SetMaxHeap(4096)
+	run(t, interpreter, reporter, `var s = "";
+for (var i = 0; i < 1000; i = i + 1) {
+  s = s + "waffles";
+}`)
+	require.True(t, reporter.HasFailed())
+
+	stats := interpreter.HeapStats()
+	require.LessOrEqual(t, stats.BytesAllocated, stats.MaxHeap)
+}
+
+func TestListHeapLimit(t *testing.T) {
+	reporter := &failure.Reporter{}
+	interpreter := ast.NewInterpreter(reporter)
+	interpreter.SetMaxHeap(4096)
+	run(t, interpreter, reporter, `var xs = [1, 2, 3];
+for (var i = 0; i < 1000; i = i + 1) {
+  xs.append(i);
+}`)
+	require.True(t, reporter.HasFailed())
+
+	stats := interpreter.HeapStats()
+	require.Equal(t, 1, stats.Lists)
+	require.LessOrEqual(t, stats.BytesAllocated, stats.MaxHeap)
+}
+
+// TestLocalSlots runs programs that call the undefined function failed, a
+// runtime error, if a variable reads the wrong slot.
+func TestLocalSlots(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"shadowing", `{ var a = 1; { var b = 2; var a = 3; if (a != 3 or b != 2) failed(); } if (a != 1) failed(); }`},
+		{"assignment", `{ var a = 1; var b = 2; b = a + b; a = 10; if (a != 10 or b != 3) failed(); }`},
+		{"parameters and locals", `fun f(a, b) { var c = a - b; return c; } if (f(5, 3) != 2) failed();`},
+		{"closures", `fun counter() { var skipped = 0; var n = 0; fun inc() { n = n + 1; return n; } return inc; }
+var c = counter(); c(); if (c() != 2) failed();`},
+		{"recursion", `fun fib(n) { if (n < 2) return n; return fib(n - 2) + fib(n - 1); } if (fib(10) != 55) failed();`},
+		{"local class", `{ var before = 1; class A { get() { return before; } } if (A().get() != 1) failed(); }`},
+		{"local subclass", `{ class A { name() { return "A"; } } class B < A { name() { return super.name() + "B"; } }
+if (B().name() != "AB") failed(); }`},
+		{"initializer returns this", `class A { init() { this.x = 1; } } var a = A(); if (a.init() != a) failed();`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reporter := &failure.Reporter{}
+			interpreter := ast.NewInterpreter(reporter)
+			run(t, interpreter, reporter, test.source)
+			require.False(t, reporter.HasFailed())
+		})
+	}
+}
+
+func TestCompletions(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"return from nested blocks", `fun f() { { while (true) { { return 1; } } } } if (f() != 1) failed();`},
+		{"return without value", `fun f() { return; } if (f() != nil) failed();`},
+		{"falling off the end", `fun f() { var a = 1; } if (f() != nil) failed();`},
+		{"early return from initializer", `class A { init(x) { this.x = x; if (x) return; this.x = "late"; } }
+if (A(true).x != true or A(false).x != "late") failed();`},
+		{"return stops the loop", `var n = 0; fun f() { for (var i = 0; i < 10; i = i + 1) { n = i; if (i == 3) return; } } f(); if (n != 3) failed();`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reporter := &failure.Reporter{}
+			interpreter := ast.NewInterpreter(reporter)
+			run(t, interpreter, reporter, test.source)
+			require.False(t, reporter.HasFailed())
+		})
+	}
+}
+
+func TestRuntimeErrorsUnwind(t *testing.T) {
+	reporter := &failure.Reporter{}
+	interpreter := ast.NewInterpreter(reporter)
+	run(t, interpreter, reporter, `var reached = false;
+fun inner() { { var a = 1; return a - "b"; } }
+fun outer() { inner(); reached = true; }
+{ var shadow = 1; outer(); }`)
+	require.True(t, reporter.HasFailed())
+
+	// the next run, as in the REPL, starts back at the global scope
+	reporter.Reset()
+	run(t, interpreter, reporter, `if (reached) failed(); var after = 1; if (after != 1) failed();`)
+	require.False(t, reporter.HasFailed())
+}
@@ -0,0 +1,79 @@
+package ast
+
+import (
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/heap"
+	"github.com/mkeesey/craftinginterpreters/pkg/token"
+)
+
+// LoxIterator is what iterator() returns for the built-in sequences: it
+// steps through the characters of a string, the elements of a list or the
+// keys of a map. for-in loops call its hasNext and next methods, the same
+// protocol instances implement.
+type LoxIterator struct {
+	// sequence is the string, list or map stepped through
+	sequence interface{}
+	// size is what the iterator was charged
+	size int
+	len  func() int
+	at   func(i int) interface{}
+	next int
+}
+
+// newIterator charges for an iterator over sequence, besides extra bytes it
+// copies from the sequence, and returns it.
+func newIterator(rt Runtime, tok *token.Token, sequence interface{}, extra int, size func() int, at func(i int) interface{}) (interface{}, error) {
+	charged := heap.InstanceSize + extra
+	if err := rt.Allocate(heap.Instance, charged, tok); err != nil {
+		return nil, err
+	}
+	return &LoxIterator{sequence: sequence, size: charged, len: size, at: at}, nil
+}
+
+// stringIterator steps through the characters of s.
+func stringIterator(rt Runtime, tok *token.Token, s string) (interface{}, error) {
+	chars := []rune(s)
+	return newIterator(rt, tok, s, heap.StringSize(s), func() int { return len(chars) }, func(i int) interface{} {
+		return string(chars[i])
+	})
+}
+
+func (it *LoxIterator) Get(rt Runtime, name *token.Token) (interface{}, error) {
+	var method func(rt Runtime, paren *token.Token, args []interface{}) (interface{}, error)
+	switch name.Lexeme {
+	case "hasNext":
+		method = func(rt Runtime, paren *token.Token, args []interface{}) (interface{}, error) {
+			return it.next < it.len(), nil
+		}
+	case "next":
+		method = func(rt Runtime, paren *token.Token, args []interface{}) (interface{}, error) {
+			if it.next >= it.len() {
+				return nil, failure.RuntimeError{Token: paren, Message: "Iterator has no more elements."}
+			}
+			it.next++
+			return it.at(it.next - 1), nil
+		}
+	default:
+		return nil, undefinedProperty(name)
+	}
+	return newBuiltin(rt, name, it, 0, method)
+}
+
+func (it *LoxIterator) String() string {
+	return "<iterator>"
+}
+
+func (it *LoxIterator) TypeName() string {
+	return "iterator"
+}
+
+// stringProperty reads a property of the string s. Strings only have an
+// iterator method.
+func stringProperty(rt Runtime, s string, name *token.Token) (interface{}, error) {
+	if name.Lexeme != "iterator" {
+		return nil, undefinedProperty(name)
+	}
+	return newBuiltin(rt, name, s, 0, func(rt Runtime, paren *token.Token, args []interface{}) (interface{}, error) {
+		return stringIterator(rt, paren, s)
+	})
+}
@@ -0,0 +1,297 @@
+package ast
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/heap"
+	"github.com/mkeesey/craftinginterpreters/pkg/token"
+)
+
+// LoxList is a Lox list. Like instances, lists are shared by reference and
+// equal only to themselves.
+type LoxList struct {
+	elements []interface{}
+}
+
+func NewLoxList(elements []interface{}) *LoxList {
+	return &LoxList{elements: elements}
+}
+
+func (l *LoxList) Len() int {
+	return len(l.elements)
+}
+
+// Elements returns a copy of the list's elements.
+func (l *LoxList) Elements() []interface{} {
+	return append([]interface{}(nil), l.elements...)
+}
+
+func (l *LoxList) String() string {
+	return stringify(l)
+}
+
+func (l *LoxList) TypeName() string {
+	return "list"
+}
+
+// Get returns the list method name bound to l.
+func (l *LoxList) Get(rt Runtime, name *token.Token) (interface{}, error) {
+	method, ok := listMethods[name.Lexeme]
+	if !ok {
+		return nil, undefinedProperty(name)
+	}
+	return newBuiltin(rt, name, l, method.arity, func(rt Runtime, paren *token.Token, args []interface{}) (interface{}, error) {
+		return method.fn(rt, l, paren, args)
+	})
+}
+
+// index checks that value indexes an element of l. With end, the index just
+// past the last element is allowed too.
+func (l *LoxList) index(tok *token.Token, value interface{}, end bool) (int, error) {
+	n, ok := value.(float64)
+	if !ok {
+		return 0, failure.RuntimeError{Token: tok, Message: "List index must be a number."}
+	}
+	i := int(n)
+	if float64(i) != n {
+		return 0, failure.RuntimeError{Token: tok, Message: "List index must be an integer."}
+	}
+	limit := len(l.elements)
+	if end {
+		limit++
+	}
+	if i < 0 || i >= limit {
+		return 0, failure.RuntimeError{Token: tok, Message: "List index out of range."}
+	}
+	return i, nil
+}
+
+func (p *TreeWalkInterpreter) VisitList(e *List) Completion {
+	elements := make([]interface{}, 0, len(e.Elements))
+	for _, element := range e.Elements {
+		value := p.evaluate(element)
+		if value.Abrupt() {
+			return value
+		}
+		elements = append(elements, value.Value)
+	}
+
+	list, err := AllocateList(p, elements, e.Bracket)
+	if err != nil {
+		return failed(err)
+	}
+	return normal(list)
+}
+
+// AllocateList charges for a list holding elements and returns it.
+func AllocateList(rt Runtime, elements []interface{}, tok *token.Token) (*LoxList, error) {
+	if err := rt.Allocate(heap.List, heap.ListSize+len(elements)*heap.ElementSize, tok); err != nil {
+		return nil, err
+	}
+	return NewLoxList(elements), nil
+}
+
+type listMethod struct {
+	// arity is negative for methods that take optional arguments and check
+	// the count themselves
+	arity int
+	fn    func(rt Runtime, l *LoxList, paren *token.Token, args []interface{}) (interface{}, error)
+}
+
+var listMethods = map[string]listMethod{
+	"append": {1, listAppend},
+	"pop":    {0, listPop},
+	"insert": {2, listInsert},
+	"remove": {1, listRemove},
+	"len":    {0, listLen},
+	"slice":  {-1, listSlice},
+	"map":    {1, listMap},
+	"filter": {1, listFilter},
+	"reduce": {2, listReduce},
+	"sort":   {-1, listSort},
+	// iterator steps through the elements as they are when it gets to
+	// them, so it sees elements appended during the loop
+	"iterator": {0, listIterator},
+}
+
+func listAppend(rt Runtime, l *LoxList, paren *token.Token, args []interface{}) (interface{}, error) {
+	if err := rt.Grow(heap.ElementSize, paren); err != nil {
+		return nil, err
+	}
+	l.elements = append(l.elements, args[0])
+	return nil, nil
+}
+
+func listPop(rt Runtime, l *LoxList, paren *token.Token, args []interface{}) (interface{}, error) {
+	if len(l.elements) == 0 {
+		return nil, failure.RuntimeError{Token: paren, Message: "Can't pop from an empty list."}
+	}
+	last := l.elements[len(l.elements)-1]
+	l.elements[len(l.elements)-1] = nil
+	l.elements = l.elements[:len(l.elements)-1]
+	return last, nil
+}
+
+func listInsert(rt Runtime, l *LoxList, paren *token.Token, args []interface{}) (interface{}, error) {
+	i, err := l.index(paren, args[0], true)
+	if err != nil {
+		return nil, err
+	}
+	if err := rt.Grow(heap.ElementSize, paren); err != nil {
+		return nil, err
+	}
+	l.elements = append(l.elements, nil)
+	copy(l.elements[i+1:], l.elements[i:])
+	l.elements[i] = args[1]
+	return nil, nil
+}
+
+func listRemove(rt Runtime, l *LoxList, paren *token.Token, args []interface{}) (interface{}, error) {
+	i, err := l.index(paren, args[0], false)
+	if err != nil {
+		return nil, err
+	}
+	removed := l.elements[i]
+	copy(l.elements[i:], l.elements[i+1:])
+	l.elements[len(l.elements)-1] = nil
+	l.elements = l.elements[:len(l.elements)-1]
+	return removed, nil
+}
+
+func listIterator(rt Runtime, l *LoxList, paren *token.Token, args []interface{}) (interface{}, error) {
+	return newIterator(rt, paren, l, 0, l.Len, func(i int) interface{} { return l.elements[i] })
+}
+
+func listLen(rt Runtime, l *LoxList, paren *token.Token, args []interface{}) (interface{}, error) {
+	return float64(len(l.elements)), nil
+}
+
+// listSlice copies the elements from start up to end, which defaults to the
+// end of the list.
+func listSlice(rt Runtime, l *LoxList, paren *token.Token, args []interface{}) (interface{}, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, failure.RuntimeError{Token: paren, Message: fmt.Sprintf("Expected 1 or 2 arguments but got %d.", len(args))}
+	}
+	start, err := l.index(paren, args[0], true)
+	if err != nil {
+		return nil, err
+	}
+	end := len(l.elements)
+	if len(args) == 2 {
+		if end, err = l.index(paren, args[1], true); err != nil {
+			return nil, err
+		}
+	}
+	if end < start {
+		return nil, failure.RuntimeError{Token: paren, Message: "List index out of range."}
+	}
+	return AllocateList(rt, append([]interface{}(nil), l.elements[start:end]...), paren)
+}
+
+func listMap(rt Runtime, l *LoxList, paren *token.Token, args []interface{}) (interface{}, error) {
+	// the callback may change the list, so iterate over what it held
+	elements := l.Elements()
+	for i, element := range elements {
+		mapped, err := rt.Call(args[0], paren, []interface{}{element})
+		if err != nil {
+			return nil, err
+		}
+		elements[i] = mapped
+	}
+	return AllocateList(rt, elements, paren)
+}
+
+func listFilter(rt Runtime, l *LoxList, paren *token.Token, args []interface{}) (interface{}, error) {
+	kept := []interface{}{}
+	for _, element := range l.Elements() {
+		keep, err := rt.Call(args[0], paren, []interface{}{element})
+		if err != nil {
+			return nil, err
+		}
+		if isTruthy(keep) {
+			kept = append(kept, element)
+		}
+	}
+	return AllocateList(rt, kept, paren)
+}
+
+// listReduce folds the list from the left, starting from its second
+// argument.
+func listReduce(rt Runtime, l *LoxList, paren *token.Token, args []interface{}) (interface{}, error) {
+	accumulator := args[1]
+	for _, element := range l.Elements() {
+		var err error
+		accumulator, err = rt.Call(args[0], paren, []interface{}{accumulator, element})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return accumulator, nil
+}
+
+// listSort sorts the list in place. Without an argument the elements must be
+// all numbers or all strings; otherwise the argument is a function that
+// returns whether its first argument belongs before its second.
+func listSort(rt Runtime, l *LoxList, paren *token.Token, args []interface{}) (interface{}, error) {
+	if len(args) > 1 {
+		return nil, failure.RuntimeError{Token: paren, Message: fmt.Sprintf("Expected 0 or 1 arguments but got %d.", len(args))}
+	}
+
+	var less func(a, b interface{}) (bool, error)
+	if len(args) == 1 {
+		less = func(a, b interface{}) (bool, error) {
+			result, err := rt.Call(args[0], paren, []interface{}{a, b})
+			return isTruthy(result), err
+		}
+	} else {
+		if !sortable(l.elements) {
+			return nil, failure.RuntimeError{Token: paren, Message: "Can only sort lists of numbers or strings without a comparison function."}
+		}
+		less = func(a, b interface{}) (bool, error) {
+			if x, ok := a.(float64); ok {
+				return x < b.(float64), nil
+			}
+			return a.(string) < b.(string), nil
+		}
+	}
+
+	// sort a copy so a comparison function that changes the list can't
+	// corrupt the sort
+	elements := l.Elements()
+	var sortErr error
+	sort.SliceStable(elements, func(i, j int) bool {
+		if sortErr != nil {
+			return false
+		}
+		result, err := less(elements[i], elements[j])
+		sortErr = err
+		return result
+	})
+	if sortErr != nil {
+		return nil, sortErr
+	}
+	l.elements = elements
+	return nil, nil
+}
+
+// sortable reports whether elements are all numbers or all strings.
+func sortable(elements []interface{}) bool {
+	if len(elements) == 0 {
+		return true
+	}
+	_, numbers := elements[0].(float64)
+	for _, element := range elements {
+		var ok bool
+		if numbers {
+			_, ok = element.(float64)
+		} else {
+			_, ok = element.(string)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,216 @@
+package ast
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/heap"
+	"github.com/mkeesey/craftinginterpreters/pkg/token"
+)
+
+// LoxMap is a Lox map. Keys are strings, numbers, booleans or nil, which Go
+// compares the way Lox's == does, and entries keep the order they were
+// first added in.
+type LoxMap struct {
+	keys   []interface{}
+	values map[interface{}]interface{}
+}
+
+func NewLoxMap() *LoxMap {
+	return &LoxMap{values: make(map[interface{}]interface{})}
+}
+
+func (m *LoxMap) Len() int {
+	return len(m.keys)
+}
+
+// Keys returns a copy of the map's keys in insertion order.
+func (m *LoxMap) Keys() []interface{} {
+	return append([]interface{}(nil), m.keys...)
+}
+
+// Lookup returns the value stored under key.
+func (m *LoxMap) Lookup(key interface{}) (interface{}, bool) {
+	value, ok := m.values[key]
+	return value, ok
+}
+
+func (m *LoxMap) String() string {
+	return stringify(m)
+}
+
+func (m *LoxMap) TypeName() string {
+	return "map"
+}
+
+// validKey reports whether key can be stored in a map.
+func validKey(key interface{}) bool {
+	switch key.(type) {
+	case nil, bool, float64, string:
+		return true
+	}
+	return false
+}
+
+func (m *LoxMap) get(tok *token.Token, key interface{}) (interface{}, error) {
+	if !validKey(key) {
+		return nil, failure.RuntimeError{Token: tok, Message: "Map keys must be strings, numbers, booleans or nil."}
+	}
+	value, ok := m.values[key]
+	if !ok {
+		return nil, failure.RuntimeError{Token: tok, Message: fmt.Sprintf("Undefined key %s.", formatKey(key))}
+	}
+	return value, nil
+}
+
+// set stores value under key, charging for the entry if the key is new.
+func (m *LoxMap) set(rt Runtime, tok *token.Token, key interface{}, value interface{}) error {
+	if !validKey(key) {
+		return failure.RuntimeError{Token: tok, Message: "Map keys must be strings, numbers, booleans or nil."}
+	}
+	if _, ok := m.values[key]; !ok {
+		if err := rt.Grow(heap.EntrySize, tok); err != nil {
+			return err
+		}
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+	return nil
+}
+
+func (m *LoxMap) delete(key interface{}) bool {
+	if !validKey(key) {
+		return false
+	}
+	if _, ok := m.values[key]; !ok {
+		return false
+	}
+	delete(m.values, key)
+	for i, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// sortKeys orders keys nil first, then booleans, numbers and strings.
+func sortKeys(keys []interface{}) {
+	rank := func(key interface{}) int {
+		switch key.(type) {
+		case nil:
+			return 0
+		case bool:
+			return 1
+		case float64:
+			return 2
+		}
+		return 3
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if rank(a) != rank(b) {
+			return rank(a) < rank(b)
+		}
+		switch a := a.(type) {
+		case bool:
+			return !a && b.(bool)
+		case float64:
+			return a < b.(float64)
+		case string:
+			return a < b.(string)
+		}
+		return false
+	})
+}
+
+// formatKey quotes string keys for error messages.
+func formatKey(key interface{}) string {
+	if s, ok := key.(string); ok {
+		return `"` + s + `"`
+	}
+	return stringify(key)
+}
+
+// Get returns the map method name bound to m.
+func (m *LoxMap) Get(rt Runtime, name *token.Token) (interface{}, error) {
+	method, ok := mapMethods[name.Lexeme]
+	if !ok {
+		return nil, undefinedProperty(name)
+	}
+	return newBuiltin(rt, name, m, method.arity, func(rt Runtime, paren *token.Token, args []interface{}) (interface{}, error) {
+		return method.fn(rt, m, paren, args)
+	})
+}
+
+func (p *TreeWalkInterpreter) VisitMap(e *Map) Completion {
+	if err := p.Allocate(heap.Map, heap.MapSize, e.Brace); err != nil {
+		return failed(err)
+	}
+	m := NewLoxMap()
+	for i, key := range e.Keys {
+		k := p.evaluate(key)
+		if k.Abrupt() {
+			return k
+		}
+		v := p.evaluate(e.Values[i])
+		if v.Abrupt() {
+			return v
+		}
+		if err := m.set(p, e.Brace, k.Value, v.Value); err != nil {
+			return failed(err)
+		}
+	}
+	return normal(m)
+}
+
+type mapMethod struct {
+	arity int
+	fn    func(rt Runtime, m *LoxMap, paren *token.Token, args []interface{}) (interface{}, error)
+}
+
+var mapMethods = map[string]mapMethod{
+	"has":    {1, mapHas},
+	"delete": {1, mapDelete},
+	"keys":   {0, mapKeys},
+	"values": {0, mapValues},
+	"len":    {0, mapLen},
+	// iterator steps through the keys the map has when it is called
+	"iterator": {0, mapIterator},
+}
+
+func mapHas(rt Runtime, m *LoxMap, paren *token.Token, args []interface{}) (interface{}, error) {
+	if !validKey(args[0]) {
+		return false, nil
+	}
+	_, ok := m.values[args[0]]
+	return ok, nil
+}
+
+// mapDelete removes a key, returning whether it was there.
+func mapDelete(rt Runtime, m *LoxMap, paren *token.Token, args []interface{}) (interface{}, error) {
+	return m.delete(args[0]), nil
+}
+
+func mapKeys(rt Runtime, m *LoxMap, paren *token.Token, args []interface{}) (interface{}, error) {
+	return AllocateList(rt, m.Keys(), paren)
+}
+
+func mapValues(rt Runtime, m *LoxMap, paren *token.Token, args []interface{}) (interface{}, error) {
+	values := make([]interface{}, len(m.keys))
+	for i, key := range m.keys {
+		values[i] = m.values[key]
+	}
+	return AllocateList(rt, values, paren)
+}
+
+func mapIterator(rt Runtime, m *LoxMap, paren *token.Token, args []interface{}) (interface{}, error) {
+	keys := m.Keys()
+	return newIterator(rt, paren, m, len(keys)*heap.ElementSize, func() int { return len(keys) }, func(i int) interface{} { return keys[i] })
+}
+
+func mapLen(rt Runtime, m *LoxMap, paren *token.Token, args []interface{}) (interface{}, error) {
+	return float64(len(m.keys)), nil
+}
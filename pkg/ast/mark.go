@@ -0,0 +1,116 @@
+package ast
+
+import "github.com/mkeesey/craftinginterpreters/pkg/heap"
+
+// Go's collector reclaims Lox objects, so the heap can't be told when they
+// die. Instead, when an allocation would go over the max heap, it measures
+// what each interpreter's roots can still reach. Values only held while an
+// expression is evaluated, such as the arguments of a call not yet made,
+// aren't reached until they are stored somewhere.
+
+// markRoots marks everything the interpreter can reach: its globals, the
+// scope running and those it will return to, and the loaded modules.
+func (p *TreeWalkInterpreter) markRoots(m *heap.Marker) {
+	markEnvironment(m, p.globalEnv)
+	markEnvironment(m, p.env)
+	for _, env := range p.scopes {
+		markEnvironment(m, env)
+	}
+	if p.modules != nil {
+		p.modules.Mark(m, func(value interface{}) { markValue(m, value) })
+	}
+}
+
+func markEnvironment(m *heap.Marker, env *Environment) {
+	for ; env != nil && m.Visit(env); env = env.enclosing {
+		if env.size() > 0 {
+			m.Count(heap.Environment, heap.EnvironmentSize+env.size()*heap.VariableSize)
+		}
+		for _, value := range env.values {
+			markValue(m, value)
+		}
+		for _, value := range env.slots {
+			markValue(m, value)
+		}
+	}
+}
+
+// markValue marks value and what it references.
+func markValue(m *heap.Marker, value interface{}) {
+	switch value := value.(type) {
+	case *LoxFunction:
+		if m.Visit(value) {
+			m.Count(heap.Closure, heap.ClosureSize)
+			markEnvironment(m, value.closure)
+		}
+	case *LoxClass:
+		for class := value; class != nil && m.Visit(class); class = class.superclass {
+			for _, table := range []map[string]*LoxFunction{class.methods, class.statics, class.getters, class.setters} {
+				for _, method := range table {
+					markValue(m, method)
+				}
+			}
+		}
+	case *LoxInstance:
+		if m.Visit(value) {
+			m.Count(heap.Instance, heap.InstanceSize+len(value.fields)*heap.FieldSize)
+			markValue(m, value.class)
+			for _, field := range value.fields {
+				markValue(m, field)
+			}
+		}
+	default:
+		Mark(m, value, func(value interface{}) { markValue(m, value) })
+	}
+}
+
+// Mark marks value if it is one of the built-in values the backends share,
+// calling mark for the values it references.
+func Mark(m *heap.Marker, value interface{}, mark func(value interface{})) {
+	switch value := value.(type) {
+	case string:
+		m.String(value)
+	case *LoxList:
+		if m.Visit(value) {
+			m.Count(heap.List, heap.ListSize+len(value.elements)*heap.ElementSize)
+			for _, element := range value.elements {
+				mark(element)
+			}
+		}
+	case *LoxMap:
+		if m.Visit(value) {
+			m.Count(heap.Map, heap.MapSize+len(value.keys)*heap.EntrySize)
+			for _, key := range value.keys {
+				mark(key)
+				mark(value.values[key])
+			}
+		}
+	case *LoxIterator:
+		if m.Visit(value) {
+			m.Count(heap.Instance, value.size)
+			mark(value.sequence)
+		}
+	case *builtin:
+		if m.Visit(value) {
+			m.Count(heap.Closure, heap.ClosureSize)
+			mark(value.receiver)
+		}
+	case *LoxModule:
+		if m.Visit(value) {
+			m.Count(heap.Environment, heap.EnvironmentSize+len(value.globals)*heap.VariableSize)
+			for _, global := range value.globals {
+				mark(global)
+			}
+		}
+	}
+}
+
+// Mark calls mark for each module l has loaded.
+func (l *ModuleLoader) Mark(m *heap.Marker, mark func(value interface{})) {
+	if !m.Visit(l) {
+		return
+	}
+	for _, module := range l.modules {
+		mark(module)
+	}
+}
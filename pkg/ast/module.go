@@ -0,0 +1,214 @@
+package ast
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/token"
+)
+
+// ModuleLoader finds the files import statements name and remembers the
+// modules loaded from them, so each file runs once however often it is
+// imported. An interpreter shares its loader with the interpreters it runs
+// modules in.
+type ModuleLoader struct {
+	paths []string
+	parse func(file string) ([]Stmt, error)
+	// modules are the loaded modules by absolute path
+	modules map[string]interface{}
+	// loading is the chain of files being loaded, outermost first
+	loading []loadingFile
+}
+
+type loadingFile struct {
+	key string
+	// path is the import path as written
+	path string
+}
+
+// NewModuleLoader returns a loader that looks for a module relative to the
+// file importing it, then relative to each of paths. parse reads the
+// statements of a module file; this package can't import the parser, so the
+// host supplies it.
+func NewModuleLoader(paths []string, parse func(file string) ([]Stmt, error)) *ModuleLoader {
+	return &ModuleLoader{paths: paths, parse: parse, modules: make(map[string]interface{})}
+}
+
+// Load returns the module the string literal path names, parsing its file
+// and calling run with the statements the first time it is imported. Errors,
+// including those run returns, are runtime errors at path.
+func (l *ModuleLoader) Load(path *token.Token, run func(file string, statements []Stmt) (interface{}, error)) (interface{}, error) {
+	file, err := l.find(path.Literal.(string), path.File)
+	if err != nil {
+		return nil, failure.RuntimeError{Token: path, Message: err.Error()}
+	}
+	key, err := filepath.Abs(file)
+	if err != nil {
+		return nil, failure.RuntimeError{Token: path, Message: err.Error()}
+	}
+	if module, ok := l.modules[key]; ok {
+		return module, nil
+	}
+
+	for i, loading := range l.loading {
+		if loading.key == key {
+			chain := []string{}
+			for _, cycle := range l.loading[i:] {
+				chain = append(chain, cycle.path)
+			}
+			chain = append(chain, path.Literal.(string))
+			return nil, failure.RuntimeError{Token: path, Message: fmt.Sprintf("Import cycle: %s.", strings.Join(chain, " -> "))}
+		}
+	}
+
+	statements, err := l.parse(file)
+	if err != nil {
+		// the reporter has already failed for errors found scanning, so
+		// compile errors can't be caught
+		return nil, failure.RuntimeError{Token: path, Message: err.Error(), Fatal: true}
+	}
+
+	l.loading = append(l.loading, loadingFile{key: key, path: path.Literal.(string)})
+	module, err := run(file, statements)
+	l.loading = l.loading[:len(l.loading)-1]
+	if err != nil {
+		return nil, err
+	}
+	l.modules[key] = module
+	return module, nil
+}
+
+// find returns the file import path names from code in from, which is empty
+// for code not read from a file.
+func (l *ModuleLoader) find(path string, from string) (string, error) {
+	candidates := []string{path}
+	if !filepath.IsAbs(path) {
+		candidates = []string{filepath.Join(filepath.Dir(from), path)}
+		for _, dir := range l.paths {
+			candidates = append(candidates, filepath.Join(dir, path))
+		}
+	}
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("Can't find module '%s'.", path)
+}
+
+// LoxModule is an imported module. Reading an export reads the module's
+// global, so it sees later assignments the module makes.
+type LoxModule struct {
+	name    string
+	globals map[string]interface{}
+	exports map[string]bool
+}
+
+// NewLoxModule returns the module name, which exports the names in exports
+// from globals.
+func NewLoxModule(name string, globals map[string]interface{}, exports map[string]bool) *LoxModule {
+	return &LoxModule{name: name, globals: globals, exports: exports}
+}
+
+func (m *LoxModule) Get(name *token.Token) (interface{}, error) {
+	if m.exports[name.Lexeme] {
+		if value, ok := m.globals[name.Lexeme]; ok {
+			return value, nil
+		}
+	}
+	return nil, failure.RuntimeError{Token: name, Message: fmt.Sprintf("Module '%s' has no export '%s'.", m.name, name.Lexeme)}
+}
+
+func (m *LoxModule) String() string {
+	return "<module " + m.name + ">"
+}
+
+func (m *LoxModule) TypeName() string {
+	return "module"
+}
+
+// SetModuleLoader lets the interpreter run import statements, which fail
+// without a loader.
+func (p *TreeWalkInterpreter) SetModuleLoader(loader *ModuleLoader) {
+	p.modules = loader
+}
+
+func (p *TreeWalkInterpreter) VisitImport(e *Import) Completion {
+	if p.modules == nil {
+		return runtimeError(e.Keyword, "Can't import modules here.")
+	}
+	loaded, err := p.modules.Load(e.Path, func(file string, statements []Stmt) (interface{}, error) {
+		return p.runModule(e, statements)
+	})
+	if err != nil {
+		return failed(err)
+	}
+
+	module := loaded.(*LoxModule)
+	if e.Name != nil {
+		if err := p.define(p.env, e.Name, e.Name.Lexeme, module); err != nil {
+			return failed(err)
+		}
+	}
+	for _, name := range e.Names {
+		value, err := module.Get(name)
+		if err != nil {
+			return failed(err)
+		}
+		if err := p.define(p.env, name, name.Lexeme, value); err != nil {
+			return failed(err)
+		}
+	}
+	return normal(nil)
+}
+
+// runModule resolves and runs the statements of the module e imports in
+// globals of their own.
+func (p *TreeWalkInterpreter) runModule(e *Import, statements []Stmt) (*LoxModule, error) {
+	name := e.Path.Literal.(string)
+	module := newInterpreter(p.reporter, p.heap)
+	module.locals = p.locals
+	module.out = p.out
+	module.interrupt = p.interrupt
+	module.modules = p.modules
+	p.heap.PushRoots(module.markRoots)
+	defer p.heap.PopRoots()
+
+	NewResolver(module, p.reporter).Resolve(statements)
+	if p.reporter.HasFailed() {
+		return nil, failure.RuntimeError{Token: e.Path, Message: fmt.Sprintf("Can't compile module '%s'.", name), Fatal: true}
+	}
+	for _, stmt := range statements {
+		if completion := module.execute(stmt); completion.Kind == CompletionError {
+			return nil, failure.Unwind(completion.Err(), failure.Frame{Function: name, Module: true, File: e.Keyword.File, Line: e.Keyword.Line})
+		}
+	}
+	return NewLoxModule(name, module.globalEnv.values, module.exports), nil
+}
+
+func (p *TreeWalkInterpreter) VisitExport(e *Export) Completion {
+	if completion := p.execute(e.Declaration); completion.Abrupt() {
+		return completion
+	}
+	if p.exports == nil {
+		p.exports = make(map[string]bool)
+	}
+	p.exports[DeclaredName(e.Declaration).Lexeme] = true
+	return normal(nil)
+}
+
+// DeclaredName returns the name an exported declaration defines.
+func DeclaredName(declaration Stmt) *token.Token {
+	switch d := declaration.(type) {
+	case *StmtVar:
+		return d.Name
+	case *Function:
+		return d.Name
+	case *Class:
+		return d.Name
+	}
+	panic(fmt.Sprintf("Unexpected exported declaration %T", declaration))
+}
@@ -0,0 +1,68 @@
+package ast
+
+import (
+	"errors"
+	"math"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/token"
+)
+
+// FloorDivide is a // b, the quotient rounded down.
+func FloorDivide(a, b float64) float64 {
+	return math.Floor(a / b)
+}
+
+// Modulo is a % b. Like FloorDivide it rounds down, so the result has the
+// sign of b and a == b * (a // b) + a % b.
+func Modulo(a, b float64) float64 {
+	r := math.Mod(a, b)
+	if r != 0 && (r < 0) != (b < 0) {
+		r += b
+	}
+	return r
+}
+
+// Integer returns n as an integer, if it is a whole number in range of one.
+func Integer(n float64) (int64, bool) {
+	if n != math.Trunc(n) || n < math.MinInt64 || n >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(n), true
+}
+
+// Bitwise applies one of the bitwise operators & | ^ << >>, which only take
+// numbers that are integers.
+func Bitwise(operator token.TokenType, a, b float64) (float64, error) {
+	x, okX := Integer(a)
+	y, okY := Integer(b)
+	if !okX || !okY {
+		return 0, errors.New("Operands must be integers.")
+	}
+
+	switch operator {
+	case token.AMPERSAND:
+		return float64(x & y), nil
+	case token.PIPE:
+		return float64(x | y), nil
+	case token.CARET:
+		return float64(x ^ y), nil
+	case token.LESS_LESS, token.GREATER_GREATER:
+		if y < 0 {
+			return 0, errors.New("Shift count must not be negative.")
+		}
+		if operator == token.LESS_LESS {
+			return float64(x << y), nil
+		}
+		return float64(x >> y), nil
+	}
+	return 0, errors.New("Unknown bitwise operator.")
+}
+
+// Complement is ~n, which only takes a number that is an integer.
+func Complement(n float64) (float64, error) {
+	x, ok := Integer(n)
+	if !ok {
+		return 0, errors.New("Operand must be an integer.")
+	}
+	return float64(^x), nil
+}
@@ -0,0 +1,110 @@
+package ast
+
+import (
+	"fmt"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/token"
+)
+
+// OperatorMethod returns the method an instance on the left of operator
+// defines to overload it, and whether the operator negates the method's
+// result. Only != does: a != b is !(a == b).
+func OperatorMethod(operator token.TokenType) (method string, negate bool, ok bool) {
+	switch operator {
+	case token.PLUS:
+		return "__add__", false, true
+	case token.MINUS:
+		return "__sub__", false, true
+	case token.STAR:
+		return "__mul__", false, true
+	case token.SLASH:
+		return "__div__", false, true
+	case token.SLASH_SLASH:
+		return "__floordiv__", false, true
+	case token.PERCENT:
+		return "__mod__", false, true
+	case token.STAR_STAR:
+		return "__pow__", false, true
+	case token.AMPERSAND:
+		return "__and__", false, true
+	case token.PIPE:
+		return "__or__", false, true
+	case token.CARET:
+		return "__xor__", false, true
+	case token.LESS_LESS:
+		return "__lshift__", false, true
+	case token.GREATER_GREATER:
+		return "__rshift__", false, true
+	case token.EQUAL_EQUAL:
+		return "__eq__", false, true
+	case token.BANG_EQUAL:
+		return "__eq__", true, true
+	case token.LESS:
+		return "__lt__", false, true
+	case token.GREATER_EQUAL:
+		return "__ge__", false, true
+	case token.GREATER:
+		return "__gt__", false, true
+	case token.LESS_EQUAL:
+		return "__le__", false, true
+	}
+	return "", false, false
+}
+
+// UndefinedOperator is the error for an instance on the left of an operator
+// its class doesn't overload.
+func UndefinedOperator(method string) string {
+	return fmt.Sprintf("Undefined operator method '%s'.", method)
+}
+
+// Operator applies operator to left, an instance, by calling the method
+// its class overloads the operator with. Instances without an __eq__ method
+// compare by identity.
+func Operator(rt Runtime, operator *token.Token, left interface{}, right interface{}) (interface{}, error) {
+	name, negate, _ := OperatorMethod(operator.Type)
+	method, err := rt.Method(left, name, operator)
+	if err != nil {
+		return nil, err
+	}
+	if method == nil {
+		if name == "__eq__" {
+			return (left == right) != negate, nil
+		}
+		return nil, failure.RuntimeError{Token: operator, Message: UndefinedOperator(name)}
+	}
+
+	result, err := rt.Call(method, operator, []interface{}{right})
+	if err != nil {
+		return nil, err
+	}
+	if negate {
+		return !isTruthy(result), nil
+	}
+	return result, nil
+}
+
+// StrNotString is the error for a __str__ method that returns something
+// other than a string.
+const StrNotString = "__str__ must return a string."
+
+// Str formats value for print, calling __str__ on instances that define
+// it, which must return a string.
+func Str(rt Runtime, tok *token.Token, value interface{}) (string, error) {
+	method, err := rt.Method(value, "__str__", tok)
+	if err != nil {
+		return "", err
+	}
+	if method == nil {
+		return stringify(value), nil
+	}
+	result, err := rt.Call(method, tok, nil)
+	if err != nil {
+		return "", err
+	}
+	str, ok := result.(string)
+	if !ok {
+		return "", failure.RuntimeError{Token: tok, Message: StrNotString}
+	}
+	return str, nil
+}
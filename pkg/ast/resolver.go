@@ -22,16 +22,32 @@ const (
 	classTypeSubclass
 )
 
+// LocalResolver receives the scope distance and slot the Resolver computes
+// for each reference to a local variable.
+type LocalResolver interface {
+	ResolveLocal(expr Expr, depth int, slot int)
+}
+
+// variable is a local the Resolver has seen declared. Slots number a scope's
+// variables in declaration order.
+type variable struct {
+	defined bool
+	slot    int
+}
+
 type Resolver struct {
 	reporter      *failure.Reporter
-	interpreter   *TreeWalkInterpreter
-	scopes        []map[string]bool
+	locals        LocalResolver
+	scopes        []map[string]*variable
 	currFuncType  functionType
 	currClassType classType
+	// loopDepth counts the loops enclosing the code being resolved, within
+	// the current function
+	loopDepth int
 }
 
-func NewResolver(interpreter *TreeWalkInterpreter, reporter *failure.Reporter) *Resolver {
-	return &Resolver{interpreter: interpreter,
+func NewResolver(locals LocalResolver, reporter *failure.Reporter) *Resolver {
+	return &Resolver{locals: locals,
 		reporter:      reporter,
 		currFuncType:  funcTypeNone,
 		currClassType: classTypeNone,
@@ -68,6 +84,18 @@ func (r *Resolver) VisitGrouping(g *Grouping) interface{} {
 	return nil
 }
 
+func (r *Resolver) VisitInterpolation(i *Interpolation) interface{} {
+	for _, part := range i.Parts {
+		r.resolveExpr(part)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitLambda(l *Lambda) interface{} {
+	r.resolveFunction(l.Function, funcTypeFunction)
+	return nil
+}
+
 func (r *Resolver) VisitLiteral(lit *Literal) interface{} {
 	return nil
 }
@@ -112,8 +140,8 @@ func (r *Resolver) VisitUnary(unary *Unary) interface{} {
 func (r *Resolver) VisitExprVar(expr *ExprVar) interface{} {
 	scope, ok := r.peekScope()
 	if ok {
-		defined, declared := scope[expr.Name.Lexeme]
-		if declared && !defined {
+		variable, declared := scope[expr.Name.Lexeme]
+		if declared && !variable.defined {
 			r.reporter.TokenError(expr.Name, "Can't read local variable in its own initializer.")
 		}
 	}
@@ -122,13 +150,49 @@ func (r *Resolver) VisitExprVar(expr *ExprVar) interface{} {
 	return nil
 }
 
-func (r *Resolver) VisitBlock(b *Block) {
+func (r *Resolver) VisitList(list *List) interface{} {
+	for _, element := range list.Elements {
+		r.resolveExpr(element)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitMap(m *Map) interface{} {
+	for i, key := range m.Keys {
+		r.resolveExpr(key)
+		r.resolveExpr(m.Values[i])
+	}
+	return nil
+}
+
+func (r *Resolver) VisitIndex(index *Index) interface{} {
+	r.resolveExpr(index.Object)
+	r.resolveExpr(index.Index)
+	return nil
+}
+
+func (r *Resolver) VisitSetIndex(set *SetIndex) interface{} {
+	r.resolveExpr(set.Value)
+	r.resolveExpr(set.Object)
+	r.resolveExpr(set.Index)
+	return nil
+}
+
+func (r *Resolver) VisitBlock(b *Block) interface{} {
 	r.beginScope()
 	r.Resolve(b.Statements)
 	r.endScope()
+	return nil
+}
+
+func (r *Resolver) VisitBreak(b *Break) interface{} {
+	if r.loopDepth == 0 {
+		r.reporter.TokenError(b.Keyword, "Can't use 'break' outside of a loop.")
+	}
+	return nil
 }
 
-func (r *Resolver) VisitClass(class *Class) {
+func (r *Resolver) VisitClass(class *Class) interface{} {
 	priorClassType := r.currClassType
 	r.currClassType = classTypeClass
 	defer func() {
@@ -147,13 +211,13 @@ func (r *Resolver) VisitClass(class *Class) {
 		r.beginScope()
 		defer r.endScope()
 		scope, _ := r.peekScope()
-		scope["super"] = true
+		scope["super"] = &variable{defined: true, slot: 0}
 	}
 
 	r.beginScope()
 	defer r.endScope()
 	scope, _ := r.peekScope()
-	scope["this"] = true
+	scope["this"] = &variable{defined: true, slot: 0}
 
 	for _, method := range class.Methods {
 		declaration := funcTypeMethod
@@ -162,31 +226,68 @@ func (r *Resolver) VisitClass(class *Class) {
 		}
 		r.resolveFunction(method, declaration)
 	}
+	for _, methods := range [][]*Function{class.ClassMethods, class.Getters, class.Setters} {
+		for _, method := range methods {
+			r.resolveFunction(method, funcTypeMethod)
+		}
+	}
+	return nil
 }
 
-func (r *Resolver) VisitExpression(exp *Expression) {
+func (r *Resolver) VisitContinue(c *Continue) interface{} {
+	if r.loopDepth == 0 {
+		r.reporter.TokenError(c.Keyword, "Can't use 'continue' outside of a loop.")
+	}
+	return nil
+}
+
+func (r *Resolver) VisitExport(export *Export) interface{} {
+	if len(r.scopes) > 0 {
+		r.reporter.TokenError(export.Keyword, "Can only export top-level declarations.")
+	}
+	r.resolveStmt(export.Declaration)
+	return nil
+}
+
+func (r *Resolver) VisitExpression(exp *Expression) interface{} {
 	r.resolveExpr(exp.Expression)
+	return nil
 }
 
-func (r *Resolver) VisitFunction(fun *Function) {
+func (r *Resolver) VisitFunction(fun *Function) interface{} {
 	r.declare(fun.Name)
 	r.define(fun.Name)
 	r.resolveFunction(fun, funcTypeFunction)
+	return nil
 }
 
-func (r *Resolver) VisitIf(i *If) {
+func (r *Resolver) VisitIf(i *If) interface{} {
 	r.resolveExpr(i.Condition)
 	r.resolveStmt(i.ThenBranch)
 	if i.ElseBranch != nil {
 		r.resolveStmt(i.ElseBranch)
 	}
+	return nil
 }
 
-func (r *Resolver) VisitPrint(p *Print) {
+func (r *Resolver) VisitImport(i *Import) interface{} {
+	if i.Name != nil {
+		r.declare(i.Name)
+		r.define(i.Name)
+	}
+	for _, name := range i.Names {
+		r.declare(name)
+		r.define(name)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitPrint(p *Print) interface{} {
 	r.resolveExpr(p.Expression)
+	return nil
 }
 
-func (r *Resolver) VisitReturn(ret *Return) {
+func (r *Resolver) VisitReturn(ret *Return) interface{} {
 	if r.currFuncType == funcTypeNone {
 		r.reporter.TokenError(ret.Keyword, "Can't return from top-level code.")
 	}
@@ -197,19 +298,55 @@ func (r *Resolver) VisitReturn(ret *Return) {
 
 		r.resolveExpr(ret.Value)
 	}
+	return nil
 }
 
-func (r *Resolver) VisitStmtVar(s *StmtVar) {
+func (r *Resolver) VisitStmtVar(s *StmtVar) interface{} {
 	r.declare(s.Name)
 	if s.Initializer != nil {
 		r.resolveExpr(s.Initializer)
 	}
 	r.define(s.Name)
+	return nil
 }
 
-func (r *Resolver) VisitWhile(while *While) {
+func (r *Resolver) VisitThrow(throw *Throw) interface{} {
+	r.resolveExpr(throw.Value)
+	return nil
+}
+
+func (r *Resolver) VisitTry(try *Try) interface{} {
+	r.beginScope()
+	r.Resolve(try.Body)
+	r.endScope()
+
+	if try.CatchName != nil {
+		// the exception variable shares a scope with the catch body, as
+		// parameters do with a function's body
+		r.beginScope()
+		r.declare(try.CatchName)
+		r.define(try.CatchName)
+		r.Resolve(try.CatchBody)
+		r.endScope()
+	}
+
+	if try.FinallyBody != nil {
+		r.beginScope()
+		r.Resolve(try.FinallyBody)
+		r.endScope()
+	}
+	return nil
+}
+
+func (r *Resolver) VisitWhile(while *While) interface{} {
 	r.resolveExpr(while.Condition)
+	r.loopDepth++
 	r.resolveStmt(while.Body)
+	r.loopDepth--
+	if while.Increment != nil {
+		r.resolveExpr(while.Increment)
+	}
+	return nil
 }
 
 func (r *Resolver) Resolve(statements []Stmt) {
@@ -219,7 +356,7 @@ func (r *Resolver) Resolve(statements []Stmt) {
 }
 
 func (r *Resolver) resolveStmt(stmt Stmt) {
-	VisitStmt(stmt, r)
+	VisitStmt[interface{}](stmt, r)
 }
 
 func (r *Resolver) resolveExpr(expr Expr) {
@@ -227,8 +364,8 @@ func (r *Resolver) resolveExpr(expr Expr) {
 }
 
 func (r *Resolver) resolveFunction(fun *Function, funcType functionType) {
-	enclosingType := r.currFuncType
-	r.currFuncType = funcType
+	enclosingType, enclosingLoopDepth := r.currFuncType, r.loopDepth
+	r.currFuncType, r.loopDepth = funcType, 0
 	r.beginScope()
 	for _, param := range fun.Params {
 		r.declare(param)
@@ -237,13 +374,13 @@ func (r *Resolver) resolveFunction(fun *Function, funcType functionType) {
 
 	r.Resolve(fun.Body)
 	r.endScope()
-	r.currFuncType = enclosingType
+	r.currFuncType, r.loopDepth = enclosingType, enclosingLoopDepth
 }
 
 func (r *Resolver) resolveLocal(expr Expr, name *token.Token) {
 	for i := len(r.scopes) - 1; i >= 0; i-- {
-		if _, ok := r.scopes[i][name.Lexeme]; ok {
-			r.interpreter.resolve(expr, len(r.scopes)-1-i)
+		if variable, ok := r.scopes[i][name.Lexeme]; ok {
+			r.locals.ResolveLocal(expr, len(r.scopes)-1-i, variable.slot)
 			return
 		}
 	}
@@ -251,7 +388,7 @@ func (r *Resolver) resolveLocal(expr Expr, name *token.Token) {
 
 func (r *Resolver) beginScope() {
 	//TODO reuse map instead?
-	r.scopes = append(r.scopes, make(map[string]bool))
+	r.scopes = append(r.scopes, make(map[string]*variable))
 }
 
 func (r *Resolver) endScope() {
@@ -267,8 +404,9 @@ func (r *Resolver) declare(name *token.Token) {
 	}
 	if _, alreadyDeclared := scope[name.Lexeme]; alreadyDeclared {
 		r.reporter.TokenError(name, "Already a variable with this name in this scope.")
+		return
 	}
-	scope[name.Lexeme] = false
+	scope[name.Lexeme] = &variable{defined: false, slot: len(scope)}
 }
 
 func (r *Resolver) define(name *token.Token) {
@@ -276,10 +414,10 @@ func (r *Resolver) define(name *token.Token) {
 	if !ok {
 		return
 	}
-	scope[name.Lexeme] = true
+	scope[name.Lexeme].defined = true
 }
 
-func (r *Resolver) peekScope() (map[string]bool, bool) {
+func (r *Resolver) peekScope() (map[string]*variable, bool) {
 	if len(r.scopes) == 0 {
 		return nil, false
 	}
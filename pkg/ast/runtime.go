@@ -0,0 +1,147 @@
+package ast
+
+import (
+	"fmt"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/heap"
+	"github.com/mkeesey/craftinginterpreters/pkg/token"
+)
+
+// Runtime is the interpreter the built-in values run on. Lists, maps,
+// iterators, modules and natives are shared by the tree-walk interpreter and
+// the closure backend, which each implement it.
+type Runtime interface {
+	// Call calls callee with args, checking it is callable and takes that
+	// many arguments. paren locates runtime errors.
+	Call(callee interface{}, paren *token.Token, args []interface{}) (interface{}, error)
+	// Method returns the method name of value's class bound to value, or
+	// nil if value isn't an instance or its class doesn't define name.
+	Method(value interface{}, name string, tok *token.Token) (interface{}, error)
+	// Allocate charges for a new object of size bytes.
+	Allocate(kind heap.Kind, size int, tok *token.Token) error
+	// Grow charges for an object growing by size bytes.
+	Grow(size int, tok *token.Token) error
+}
+
+// Builtin is a function the runtime provides, such as a native or a list
+// method bound to its list, which any Runtime can call.
+type Builtin interface {
+	// Invoke calls the function with arguments already checked against its
+	// arity.
+	Invoke(rt Runtime, paren *token.Token, arguments []interface{}) (interface{}, error)
+	// Arity is negative for functions that check their own argument count.
+	Arity() int
+}
+
+// Instance is an instance of a class declared in Lox, in either of the
+// backends sharing this runtime.
+type Instance interface {
+	ClassName() string
+	Fields() map[string]interface{}
+}
+
+// builtin is a method of a built-in value bound to the value, such as
+// xs.append or it.next.
+type builtin struct {
+	// receiver is the value the method was read from
+	receiver interface{}
+	// arity is negative for methods that take optional arguments and check
+	// the count themselves
+	arity int
+	fn    func(rt Runtime, paren *token.Token, args []interface{}) (interface{}, error)
+}
+
+// newBuiltin charges for a method read from receiver, a built-in value, at
+// name and returns it.
+func newBuiltin(rt Runtime, name *token.Token, receiver interface{}, arity int, fn func(rt Runtime, paren *token.Token, args []interface{}) (interface{}, error)) (interface{}, error) {
+	if err := rt.Allocate(heap.Closure, heap.ClosureSize, name); err != nil {
+		return nil, err
+	}
+	return &builtin{receiver: receiver, arity: arity, fn: fn}, nil
+}
+
+func (b *builtin) Invoke(rt Runtime, paren *token.Token, arguments []interface{}) (interface{}, error) {
+	return b.fn(rt, paren, arguments)
+}
+
+func (b *builtin) Call(interpreter *TreeWalkInterpreter, paren *token.Token, arguments []interface{}) (interface{}, error) {
+	return b.fn(interpreter, paren, arguments)
+}
+
+func (b *builtin) Arity() int {
+	return b.arity
+}
+
+func (b *builtin) String() string {
+	return "<native fn>"
+}
+
+func (b *builtin) TypeName() string {
+	return "function"
+}
+
+// Property reads the property name of a built-in value: a list, map,
+// iterator, module or string. ok is false for any other value.
+func Property(rt Runtime, object interface{}, name *token.Token) (value interface{}, ok bool, err error) {
+	switch object := object.(type) {
+	case *LoxList:
+		value, err = object.Get(rt, name)
+	case *LoxMap:
+		value, err = object.Get(rt, name)
+	case *LoxIterator:
+		value, err = object.Get(rt, name)
+	case *LoxModule:
+		value, err = object.Get(name)
+	case string:
+		value, err = stringProperty(rt, object, name)
+	default:
+		return nil, false, nil
+	}
+	return value, true, err
+}
+
+// ReadIndex reads object[index] from a list, a map, or an instance with an
+// __index__ method.
+func ReadIndex(rt Runtime, bracket *token.Token, object interface{}, index interface{}) (interface{}, error) {
+	switch object := object.(type) {
+	case *LoxList:
+		i, err := object.index(bracket, index, false)
+		if err != nil {
+			return nil, err
+		}
+		return object.elements[i], nil
+	case *LoxMap:
+		return object.get(bracket, index)
+	case Instance:
+		method, err := rt.Method(object, "__index__", bracket)
+		if err != nil {
+			return nil, err
+		}
+		if method == nil {
+			return nil, failure.RuntimeError{Token: bracket, Message: UndefinedOperator("__index__")}
+		}
+		return rt.Call(method, bracket, []interface{}{index})
+	}
+	return nil, failure.RuntimeError{Token: bracket, Message: "Only lists and maps can be indexed."}
+}
+
+// AssignIndex assigns object[index] in a list or map.
+func AssignIndex(rt Runtime, bracket *token.Token, object interface{}, index interface{}, value interface{}) error {
+	switch object := object.(type) {
+	case *LoxList:
+		i, err := object.index(bracket, index, false)
+		if err != nil {
+			return err
+		}
+		object.elements[i] = value
+		return nil
+	case *LoxMap:
+		return object.set(rt, bracket, index, value)
+	}
+	return failure.RuntimeError{Token: bracket, Message: "Only lists and maps can be indexed."}
+}
+
+func undefinedProperty(name *token.Token) error {
+	return failure.RuntimeError{Token: name, Message: fmt.Sprintf("Undefined property '%s'.", name.Lexeme)}
+}
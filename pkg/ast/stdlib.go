@@ -1,14 +1,19 @@
 package ast
 
 import (
+	"reflect"
 	"time"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/native"
+	"github.com/mkeesey/craftinginterpreters/pkg/token"
 )
 
 type TimeCallable struct {
 }
 
-func (t *TimeCallable) Call(interpreter *TreeWalkInterpreter, arguments []interface{}) interface{} {
-	return float64(time.Now().Unix())
+func (t *TimeCallable) Call(interpreter *TreeWalkInterpreter, paren *token.Token, arguments []interface{}) (interface{}, error) {
+	return float64(time.Now().Unix()), nil
 }
 
 func (t *TimeCallable) Arity() int {
@@ -18,3 +23,68 @@ func (t *TimeCallable) Arity() int {
 func (t *TimeCallable) String() string {
 	return "<native fn>"
 }
+
+func (t *TimeCallable) TypeName() string {
+	return "function"
+}
+
+// NativeCallable is a Go function registered with DefineNative.
+type NativeCallable struct {
+	fn *native.Func
+}
+
+func (n *NativeCallable) Call(interpreter *TreeWalkInterpreter, paren *token.Token, arguments []interface{}) (interface{}, error) {
+	return n.Invoke(interpreter, paren, arguments)
+}
+
+func (n *NativeCallable) Invoke(rt Runtime, paren *token.Token, arguments []interface{}) (interface{}, error) {
+	result, err := n.fn.Call(arguments)
+	if err != nil {
+		return nil, failure.RuntimeError{Token: paren, Message: err.Error()}
+	}
+	return FromHost(result), nil
+}
+
+func (n *NativeCallable) Arity() int {
+	return n.fn.Arity()
+}
+
+func (n *NativeCallable) String() string {
+	return "<native fn>"
+}
+
+func (n *NativeCallable) TypeName() string {
+	return "function"
+}
+
+// FromHost converts a value from Go code into one the interpreter can use,
+// making bound Go methods callable, Go slices lists and Go maps maps.
+func FromHost(value interface{}) interface{} {
+	if fn, ok := value.(*native.Func); ok {
+		return &NativeCallable{fn: fn}
+	}
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Slice, reflect.Array:
+		elements := make([]interface{}, v.Len())
+		for i := range elements {
+			elements[i] = FromHost(native.FromGo(v.Index(i)))
+		}
+		return NewLoxList(elements)
+	case reflect.Map:
+		keys := v.MapKeys()
+		m := NewLoxMap()
+		for _, key := range keys {
+			k := native.FromGo(key)
+			if !validKey(k) {
+				// leave maps Lox can't key as they are
+				return value
+			}
+			m.keys = append(m.keys, k)
+			m.values[k] = FromHost(native.FromGo(v.MapIndex(key)))
+		}
+		// Go maps have no order, so give the entries a stable one
+		sortKeys(m.keys)
+		return m
+	}
+	return value
+}
@@ -7,38 +7,56 @@ import (
 	"github.com/mkeesey/craftinginterpreters/pkg/token"
 )
 
-type StmtVisitor interface {
-	VisitBlock(*Block)
-	VisitClass(*Class)
-	VisitExpression(*Expression)
-	VisitFunction(*Function)
-	VisitIf(*If)
-	VisitPrint(*Print)
-	VisitReturn(*Return)
-	VisitStmtVar(*StmtVar)
-	VisitWhile(*While)
-}
-
-func VisitStmt(stmt Stmt, visitor StmtVisitor) {
+type StmtVisitor[T any] interface {
+	VisitBlock(*Block) T
+	VisitBreak(*Break) T
+	VisitClass(*Class) T
+	VisitContinue(*Continue) T
+	VisitExport(*Export) T
+	VisitExpression(*Expression) T
+	VisitFunction(*Function) T
+	VisitIf(*If) T
+	VisitImport(*Import) T
+	VisitPrint(*Print) T
+	VisitReturn(*Return) T
+	VisitStmtVar(*StmtVar) T
+	VisitThrow(*Throw) T
+	VisitTry(*Try) T
+	VisitWhile(*While) T
+}
+
+func VisitStmt[T any](stmt Stmt, visitor StmtVisitor[T]) T {
 	switch n := stmt.(type) {
 	case *Block:
-		visitor.VisitBlock(n)
+		return visitor.VisitBlock(n)
+	case *Break:
+		return visitor.VisitBreak(n)
 	case *Class:
-		visitor.VisitClass(n)
+		return visitor.VisitClass(n)
+	case *Continue:
+		return visitor.VisitContinue(n)
+	case *Export:
+		return visitor.VisitExport(n)
 	case *Expression:
-		visitor.VisitExpression(n)
+		return visitor.VisitExpression(n)
 	case *Function:
-		visitor.VisitFunction(n)
+		return visitor.VisitFunction(n)
 	case *If:
-		visitor.VisitIf(n)
+		return visitor.VisitIf(n)
+	case *Import:
+		return visitor.VisitImport(n)
 	case *Print:
-		visitor.VisitPrint(n)
+		return visitor.VisitPrint(n)
 	case *Return:
-		visitor.VisitReturn(n)
+		return visitor.VisitReturn(n)
 	case *StmtVar:
-		visitor.VisitStmtVar(n)
+		return visitor.VisitStmtVar(n)
+	case *Throw:
+		return visitor.VisitThrow(n)
+	case *Try:
+		return visitor.VisitTry(n)
 	case *While:
-		visitor.VisitWhile(n)
+		return visitor.VisitWhile(n)
 	default:
 		panic(fmt.Sprintf("Unknown Stmt type %T", stmt))
 	}
@@ -54,14 +72,36 @@ type Block struct {
 
 func (b *Block) stmt() {}
 
+type Break struct {
+	Keyword *token.Token
+}
+
+func (b *Break) stmt() {}
+
 type Class struct {
 	Name *token.Token
 	Methods []*Function
+	ClassMethods []*Function
+	Getters []*Function
+	Setters []*Function
 	Superclass *ExprVar
 }
 
 func (b *Class) stmt() {}
 
+type Continue struct {
+	Keyword *token.Token
+}
+
+func (b *Continue) stmt() {}
+
+type Export struct {
+	Keyword *token.Token
+	Declaration Stmt
+}
+
+func (b *Export) stmt() {}
+
 type Expression struct {
 	Expression Expr
 }
@@ -84,7 +124,17 @@ type If struct {
 
 func (b *If) stmt() {}
 
+type Import struct {
+	Keyword *token.Token
+	Path *token.Token
+	Name *token.Token
+	Names []*token.Token
+}
+
+func (b *Import) stmt() {}
+
 type Print struct {
+	Keyword *token.Token
 	Expression Expr
 }
 
@@ -104,9 +154,28 @@ type StmtVar struct {
 
 func (b *StmtVar) stmt() {}
 
+type Throw struct {
+	Keyword *token.Token
+	Value Expr
+}
+
+func (b *Throw) stmt() {}
+
+type Try struct {
+	Keyword *token.Token
+	Body []Stmt
+	CatchName *token.Token
+	CatchBody []Stmt
+	FinallyBody []Stmt
+}
+
+func (b *Try) stmt() {}
+
 type While struct {
+	Keyword *token.Token
 	Condition Expr
 	Body Stmt
+	Increment Expr
 }
 
 func (b *While) stmt() {}
@@ -0,0 +1,879 @@
+package bytecode
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/ast"
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/heap"
+	loxparser "github.com/mkeesey/craftinginterpreters/pkg/parser"
+	loxscanner "github.com/mkeesey/craftinginterpreters/pkg/scanner"
+	loxtoken "github.com/mkeesey/craftinginterpreters/pkg/token"
+)
+
+var debugPrintCode = false
+
+const (
+	localsMax   = math.MaxUint8 + 1
+	upvaluesMax = math.MaxUint8 + 1
+)
+
+type functionType int
+
+const (
+	TYPE_FUNCTION functionType = iota
+	TYPE_INITIALIZER
+	TYPE_METHOD
+	TYPE_SCRIPT
+)
+
+type local struct {
+	name       string
+	depth      int
+	isCaptured bool
+}
+
+type upvalue struct {
+	index   uint8
+	isLocal bool
+}
+
+// loop is a loop being compiled. Breaks and continues jump forward, so their
+// jumps are patched once the loop's end and increment are placed.
+type loop struct {
+	enclosing *loop
+	// scopeDepth is the depth of the scope enclosing the loop; locals
+	// deeper than it are discarded when jumping out of the body
+	scopeDepth int
+	breaks     []int
+	continues  []int
+}
+
+type classCompiler struct {
+	enclosing     *classCompiler
+	hasSuperclass bool
+}
+
+// astCompiler lowers resolved ast statements into the chunk of a single
+// function. Nested function declarations get their own astCompiler that
+// points back at the enclosing one so upvalues can be resolved.
+//
+// ExprVisitor[any]
+// StmtVisitor[any]
+type astCompiler struct {
+	vm          *VM
+	enclosing   *astCompiler
+	functionRef ObjRef
+	function    *ObjFunction
+	funcType    functionType
+	locals      []local
+	upvalues    []upvalue
+	scopeDepth  int
+	line        int
+	class       *classCompiler
+	loop        *loop
+	reporter    *failure.Reporter
+}
+
+// compile runs source through the same scanner, parser and resolver as the
+// tree-walk interpreter and lowers the result into a top-level script
+// function on the VM's heap. Parse errors are returned; scan, resolve and
+// compile errors are reported through the reporter. With keepResult, the
+// script returns the value of a trailing expression statement.
+func (vm *VM) compile(reader io.Reader, reporter *failure.Reporter, keepResult bool) (ObjRef, error) {
+	scan := loxscanner.NewScanner(reader, reporter)
+	tokens := scan.ScanTokens()
+
+	parse := loxparser.NewParser(tokens, reporter)
+	statements, err := parse.Parse()
+	if err != nil {
+		return ObjRef{}, err
+	}
+	if reporter.HasFailed() {
+		return ObjRef{}, ErrCompileError
+	}
+
+	return vm.compileStatements(statements, reporter, keepResult)
+}
+
+// compileStatements resolves statements and lowers them into a top-level
+// script function.
+func (vm *VM) compileStatements(statements []ast.Stmt, reporter *failure.Reporter, keepResult bool) (ObjRef, error) {
+	compiler := newASTCompiler(vm, nil, TYPE_SCRIPT, reporter)
+	defer func() {
+		vm.compiler = nil
+	}()
+
+	resolver := ast.NewResolver(compiler, reporter)
+	resolver.Resolve(statements)
+	if reporter.HasFailed() {
+		return ObjRef{}, ErrCompileError
+	}
+
+	for i, stmt := range statements {
+		if expression, ok := stmt.(*ast.Expression); ok && keepResult && i == len(statements)-1 {
+			compiler.expression(expression.Expression)
+			compiler.emitByte(byte(OP_RETURN))
+			break
+		}
+		compiler.statement(stmt)
+	}
+	function := compiler.end()
+
+	if reporter.HasFailed() {
+		return ObjRef{}, ErrCompileError
+	}
+	return function, nil
+}
+
+// newASTCompiler allocates the function it will fill in and makes itself the
+// VM's innermost compiler, which roots that function until end.
+func newASTCompiler(vm *VM, enclosing *astCompiler, funcType functionType, reporter *failure.Reporter) *astCompiler {
+	c := &astCompiler{
+		vm:        vm,
+		enclosing: enclosing,
+		function:  &ObjFunction{chunk: NewChunk()},
+		funcType:  funcType,
+		line:      1,
+		reporter:  reporter,
+	}
+	if enclosing != nil {
+		c.line = enclosing.line
+		c.class = enclosing.class
+	}
+
+	ref, err := vm.allocate(c.function, heap.Function, heap.FunctionSize)
+	if err != nil {
+		c.reporter.Error(c.line, err.Error())
+	}
+	c.functionRef = ref
+	vm.compiler = c
+
+	// slot zero holds the function being called, or the receiver for methods
+	if funcType == TYPE_METHOD || funcType == TYPE_INITIALIZER {
+		c.locals = append(c.locals, local{name: "this", depth: 0})
+	} else {
+		c.locals = append(c.locals, local{name: "", depth: 0})
+	}
+	return c
+}
+
+// ResolveLocal satisfies ast.LocalResolver. The compiler assigns stack slots
+// itself, so the resolver is only used for its static checks.
+func (c *astCompiler) ResolveLocal(expr ast.Expr, depth int, slot int) {
+}
+
+func (c *astCompiler) VisitAssign(e *ast.Assign) interface{} {
+	c.expression(e.Value)
+	c.setLine(e.Name)
+	c.namedVariable(e.Name, true)
+	return nil
+}
+
+func (c *astCompiler) VisitBinary(e *ast.Binary) interface{} {
+	c.expression(e.Left)
+	c.expression(e.Right)
+	c.setLine(e.Operator)
+
+	switch e.Operator.Type {
+	case loxtoken.BANG_EQUAL:
+		c.emitBytes(byte(OP_EQUAL), byte(OP_NOT))
+	case loxtoken.EQUAL_EQUAL:
+		c.emitByte(byte(OP_EQUAL))
+	case loxtoken.GREATER:
+		c.emitByte(byte(OP_GREATER))
+	case loxtoken.GREATER_EQUAL:
+		c.emitByte(byte(OP_GREATER_EQUAL))
+	case loxtoken.LESS:
+		c.emitByte(byte(OP_LESS))
+	case loxtoken.LESS_EQUAL:
+		c.emitByte(byte(OP_LESS_EQUAL))
+	case loxtoken.PLUS:
+		c.emitByte(byte(OP_ADD))
+	case loxtoken.MINUS:
+		c.emitByte(byte(OP_SUBTRACT))
+	case loxtoken.STAR:
+		c.emitByte(byte(OP_MULTIPLY))
+	case loxtoken.SLASH:
+		c.emitByte(byte(OP_DIVIDE))
+	case loxtoken.SLASH_SLASH:
+		c.emitByte(byte(OP_FLOOR_DIVIDE))
+	case loxtoken.PERCENT:
+		c.emitByte(byte(OP_MODULO))
+	case loxtoken.STAR_STAR:
+		c.emitByte(byte(OP_POWER))
+	case loxtoken.AMPERSAND:
+		c.emitByte(byte(OP_BIT_AND))
+	case loxtoken.PIPE:
+		c.emitByte(byte(OP_BIT_OR))
+	case loxtoken.CARET:
+		c.emitByte(byte(OP_BIT_XOR))
+	case loxtoken.LESS_LESS:
+		c.emitByte(byte(OP_SHIFT_LEFT))
+	case loxtoken.GREATER_GREATER:
+		c.emitByte(byte(OP_SHIFT_RIGHT))
+	default:
+		c.reporter.TokenError(e.Operator, "Unknown binary operator.")
+	}
+	return nil
+}
+
+func (c *astCompiler) VisitCall(e *ast.Call) interface{} {
+	// method calls skip creating a bound method by invoking directly
+	switch callee := e.Callee.(type) {
+	case *ast.Get:
+		c.expression(callee.Object)
+		c.arguments(e.Arguments)
+		c.setLine(callee.Name)
+		c.emitBytes(byte(OP_INVOKE), c.identifierConstant(callee.Name))
+		c.emitByte(byte(len(e.Arguments)))
+		c.emitInlineCache()
+	case *ast.Super:
+		c.setLine(callee.Keyword)
+		c.namedVariable(syntheticToken("this", callee.Keyword), false)
+		c.arguments(e.Arguments)
+		c.setLine(callee.Keyword)
+		c.namedVariable(syntheticToken("super", callee.Keyword), false)
+		c.emitBytes(byte(OP_SUPER_INVOKE), c.identifierConstant(callee.Method))
+		c.emitByte(byte(len(e.Arguments)))
+		c.emitInlineCache()
+	default:
+		c.expression(e.Callee)
+		c.arguments(e.Arguments)
+		c.setLine(e.Paren)
+		c.emitBytes(byte(OP_CALL), byte(len(e.Arguments)))
+	}
+	return nil
+}
+
+func (c *astCompiler) VisitGet(e *ast.Get) interface{} {
+	c.expression(e.Object)
+	c.setLine(e.Name)
+	c.emitBytes(byte(OP_GET_PROPERTY), c.identifierConstant(e.Name))
+	c.emitInlineCache()
+	return nil
+}
+
+func (c *astCompiler) VisitGrouping(e *ast.Grouping) interface{} {
+	c.expression(e.Expression)
+	return nil
+}
+
+func (c *astCompiler) VisitLambda(e *ast.Lambda) interface{} {
+	c.compileFunction(e.Function, TYPE_FUNCTION)
+	return nil
+}
+
+// VisitInterpolation joins the parts of the string, converting those that
+// aren't text.
+func (c *astCompiler) VisitInterpolation(e *ast.Interpolation) interface{} {
+	for i, part := range e.Parts {
+		c.expression(part)
+		c.setLine(e.Start)
+		if literal, ok := part.(*ast.Literal); !ok || !isString(literal.Value) {
+			c.emitByte(byte(OP_TO_STRING))
+		}
+		if i > 0 {
+			c.emitByte(byte(OP_ADD))
+		}
+	}
+	return nil
+}
+
+func isString(value interface{}) bool {
+	_, ok := value.(string)
+	return ok
+}
+
+func (c *astCompiler) VisitLiteral(e *ast.Literal) interface{} {
+	switch val := e.Value.(type) {
+	case nil:
+		c.emitByte(byte(OP_NIL))
+	case bool:
+		if val {
+			c.emitByte(byte(OP_TRUE))
+		} else {
+			c.emitByte(byte(OP_FALSE))
+		}
+	case float64:
+		c.emitConstant(NumberValue(val))
+	case string:
+		c.emitConstant(c.stringConstant(val))
+	default:
+		c.reporter.Error(c.line, fmt.Sprintf("Unknown literal type %T.", val))
+	}
+	return nil
+}
+
+func (c *astCompiler) VisitLogical(e *ast.Logical) interface{} {
+	c.expression(e.Left)
+	c.setLine(e.Operator)
+
+	if e.Operator.Type == loxtoken.OR {
+		elseJump := c.emitJump(OP_JUMP_IF_FALSE)
+		endJump := c.emitJump(OP_JUMP)
+		c.patchJump(elseJump)
+		c.emitByte(byte(OP_POP))
+		c.expression(e.Right)
+		c.patchJump(endJump)
+	} else {
+		endJump := c.emitJump(OP_JUMP_IF_FALSE)
+		c.emitByte(byte(OP_POP))
+		c.expression(e.Right)
+		c.patchJump(endJump)
+	}
+	return nil
+}
+
+func (c *astCompiler) VisitSet(e *ast.Set) interface{} {
+	c.expression(e.Object)
+	c.expression(e.Value)
+	c.setLine(e.Name)
+	c.emitBytes(byte(OP_SET_PROPERTY), c.identifierConstant(e.Name))
+	c.emitInlineCache()
+	return nil
+}
+
+func (c *astCompiler) VisitSuper(e *ast.Super) interface{} {
+	c.setLine(e.Keyword)
+	c.namedVariable(syntheticToken("this", e.Keyword), false)
+	c.namedVariable(syntheticToken("super", e.Keyword), false)
+	c.emitBytes(byte(OP_GET_SUPER), c.identifierConstant(e.Method))
+	c.emitInlineCache()
+	return nil
+}
+
+func (c *astCompiler) VisitThis(e *ast.This) interface{} {
+	c.setLine(e.Keyword)
+	c.namedVariable(e.Keyword, false)
+	return nil
+}
+
+func (c *astCompiler) VisitUnary(e *ast.Unary) interface{} {
+	c.expression(e.Right)
+	c.setLine(e.Operator)
+
+	switch e.Operator.Type {
+	case loxtoken.MINUS:
+		c.emitByte(byte(OP_NEGATE))
+	case loxtoken.BANG:
+		c.emitByte(byte(OP_NOT))
+	case loxtoken.TILDE:
+		c.emitByte(byte(OP_BIT_NOT))
+	default:
+		c.reporter.TokenError(e.Operator, "Unknown unary operator.")
+	}
+	return nil
+}
+
+func (c *astCompiler) VisitExprVar(e *ast.ExprVar) interface{} {
+	c.setLine(e.Name)
+	c.namedVariable(e.Name, false)
+	return nil
+}
+
+// unsupported reports syntax the VM has no runtime support for, so that a
+// script using it fails to compile rather than partway through running. The
+// constructs are listed on lox.Bytecode.
+func (c *astCompiler) unsupported(at *loxtoken.Token, what string) {
+	c.reporter.TokenError(at, "The bytecode VM doesn't support "+what+".")
+}
+
+func (c *astCompiler) VisitList(e *ast.List) interface{} {
+	c.unsupported(e.Bracket, "lists")
+	return nil
+}
+
+func (c *astCompiler) VisitMap(e *ast.Map) interface{} {
+	c.unsupported(e.Brace, "maps")
+	return nil
+}
+
+// VisitIndex compiles a[i], which on the VM only instances with an
+// __index__ method support.
+func (c *astCompiler) VisitIndex(e *ast.Index) interface{} {
+	c.expression(e.Object)
+	c.expression(e.Index)
+	c.setLine(e.Bracket)
+	c.emitByte(byte(OP_INDEX))
+	return nil
+}
+
+func (c *astCompiler) VisitSetIndex(e *ast.SetIndex) interface{} {
+	c.unsupported(e.Bracket, "index assignment")
+	return nil
+}
+
+func (c *astCompiler) VisitBlock(s *ast.Block) interface{} {
+	c.beginScope()
+	for _, stmt := range s.Statements {
+		c.statement(stmt)
+	}
+	c.endScope()
+	return nil
+}
+
+func (c *astCompiler) VisitBreak(s *ast.Break) interface{} {
+	c.setLine(s.Keyword)
+	c.discardLocals(c.loop.scopeDepth)
+	c.loop.breaks = append(c.loop.breaks, c.emitJump(OP_JUMP))
+	return nil
+}
+
+func (c *astCompiler) VisitClass(s *ast.Class) interface{} {
+	c.setLine(s.Name)
+	nameConstant := c.identifierConstant(s.Name)
+	global := c.declareVariable(s.Name)
+
+	c.emitBytes(byte(OP_CLASS), nameConstant)
+	c.defineVariable(global)
+
+	c.class = &classCompiler{enclosing: c.class}
+	defer func() {
+		c.class = c.class.enclosing
+	}()
+
+	if s.Superclass != nil {
+		c.VisitExprVar(s.Superclass)
+
+		c.beginScope()
+		c.addLocal(syntheticToken("super", s.Superclass.Name))
+		c.defineVariable(0)
+
+		c.namedVariable(s.Name, false)
+		c.emitByte(byte(OP_INHERIT))
+		c.class.hasSuperclass = true
+	}
+
+	// keep the class on the stack while its methods are bound
+	c.namedVariable(s.Name, false)
+	for _, method := range s.Methods {
+		c.setLine(method.Name)
+		funcType := TYPE_METHOD
+		if method.Name.Lexeme == "init" {
+			funcType = TYPE_INITIALIZER
+		}
+		c.compileFunction(method, funcType)
+		c.emitBytes(byte(OP_METHOD), c.identifierConstant(method.Name))
+	}
+	members := []struct {
+		op        OpCode
+		functions []*ast.Function
+	}{
+		{OP_CLASS_METHOD, s.ClassMethods},
+		{OP_GETTER, s.Getters},
+		{OP_SETTER, s.Setters},
+	}
+	for _, member := range members {
+		for _, function := range member.functions {
+			c.setLine(function.Name)
+			c.compileFunction(function, TYPE_METHOD)
+			c.emitBytes(byte(member.op), c.identifierConstant(function.Name))
+		}
+	}
+	c.emitByte(byte(OP_POP))
+
+	if c.class.hasSuperclass {
+		c.endScope()
+	}
+	return nil
+}
+
+func (c *astCompiler) VisitContinue(s *ast.Continue) interface{} {
+	c.setLine(s.Keyword)
+	c.discardLocals(c.loop.scopeDepth)
+	c.loop.continues = append(c.loop.continues, c.emitJump(OP_JUMP))
+	return nil
+}
+
+func (c *astCompiler) VisitExpression(s *ast.Expression) interface{} {
+	c.expression(s.Expression)
+	c.emitByte(byte(OP_POP))
+	return nil
+}
+
+func (c *astCompiler) VisitFunction(s *ast.Function) interface{} {
+	c.setLine(s.Name)
+	global := c.declareVariable(s.Name)
+	// a function may refer to itself, so it is usable before its body is compiled
+	c.markInitialized()
+	c.compileFunction(s, TYPE_FUNCTION)
+	c.defineVariable(global)
+	return nil
+}
+
+func (c *astCompiler) VisitIf(s *ast.If) interface{} {
+	c.expression(s.Condition)
+
+	thenJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitByte(byte(OP_POP))
+	c.statement(s.ThenBranch)
+
+	elseJump := c.emitJump(OP_JUMP)
+	c.patchJump(thenJump)
+	c.emitByte(byte(OP_POP))
+
+	if s.ElseBranch != nil {
+		c.statement(s.ElseBranch)
+	}
+	c.patchJump(elseJump)
+	return nil
+}
+
+func (c *astCompiler) VisitPrint(s *ast.Print) interface{} {
+	c.expression(s.Expression)
+	c.emitByte(byte(OP_PRINT))
+	return nil
+}
+
+func (c *astCompiler) VisitReturn(s *ast.Return) interface{} {
+	c.setLine(s.Keyword)
+	if s.Value == nil {
+		c.emitReturn()
+		return nil
+	}
+
+	c.expression(s.Value)
+	c.setLine(s.Keyword)
+	c.emitByte(byte(OP_RETURN))
+	return nil
+}
+
+func (c *astCompiler) VisitStmtVar(s *ast.StmtVar) interface{} {
+	c.setLine(s.Name)
+	global := c.declareVariable(s.Name)
+
+	if s.Initializer != nil {
+		c.expression(s.Initializer)
+	} else {
+		c.emitByte(byte(OP_NIL))
+	}
+	c.setLine(s.Name)
+	c.defineVariable(global)
+	return nil
+}
+
+func (c *astCompiler) VisitImport(s *ast.Import) interface{} {
+	c.unsupported(s.Keyword, "modules")
+	return nil
+}
+
+func (c *astCompiler) VisitExport(s *ast.Export) interface{} {
+	c.unsupported(s.Keyword, "modules")
+	return nil
+}
+
+func (c *astCompiler) VisitThrow(s *ast.Throw) interface{} {
+	c.unsupported(s.Keyword, "exceptions")
+	return nil
+}
+
+func (c *astCompiler) VisitTry(s *ast.Try) interface{} {
+	c.unsupported(s.Keyword, "exceptions")
+	return nil
+}
+
+func (c *astCompiler) VisitWhile(s *ast.While) interface{} {
+	loopStart := len(c.currentChunk().code)
+	c.expression(s.Condition)
+
+	exitJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitByte(byte(OP_POP))
+	c.loop = &loop{enclosing: c.loop, scopeDepth: c.scopeDepth}
+	c.statement(s.Body)
+
+	for _, jump := range c.loop.continues {
+		c.patchJump(jump)
+	}
+	if s.Increment != nil {
+		c.expression(s.Increment)
+		c.emitByte(byte(OP_POP))
+	}
+	c.emitLoop(loopStart)
+
+	c.patchJump(exitJump)
+	c.emitByte(byte(OP_POP))
+	// breaks skip the pop, having popped the condition before the body
+	for _, jump := range c.loop.breaks {
+		c.patchJump(jump)
+	}
+	c.loop = c.loop.enclosing
+	return nil
+}
+
+func (c *astCompiler) arguments(args []ast.Expr) {
+	for _, arg := range args {
+		c.expression(arg)
+	}
+}
+
+func (c *astCompiler) statement(stmt ast.Stmt) {
+	ast.VisitStmt[interface{}](stmt, c)
+}
+
+func (c *astCompiler) expression(expr ast.Expr) {
+	ast.VisitExpr[interface{}](expr, c)
+}
+
+func (c *astCompiler) compileFunction(declaration *ast.Function, funcType functionType) {
+	compiler := newASTCompiler(c.vm, c, funcType, c.reporter)
+	compiler.function.name = declaration.Name.Lexeme
+	compiler.function.arity = len(declaration.Params)
+	compiler.beginScope()
+
+	for _, param := range declaration.Params {
+		compiler.addLocal(param)
+		compiler.markInitialized()
+	}
+	for _, stmt := range declaration.Body {
+		compiler.statement(stmt)
+	}
+
+	function := compiler.end()
+	c.emitBytes(byte(OP_CLOSURE), c.makeConstant(ObjValue(function)))
+	for _, upvalue := range compiler.upvalues {
+		if upvalue.isLocal {
+			c.emitByte(1)
+		} else {
+			c.emitByte(0)
+		}
+		c.emitByte(upvalue.index)
+	}
+}
+
+// end finishes the function and hands rooting it back to the caller, which
+// must store it before allocating anything else.
+func (c *astCompiler) end() ObjRef {
+	c.emitReturn()
+	if debugPrintCode && !c.reporter.HasFailed() {
+		c.vm.disassembleChunk(c.currentChunk(), c.function.String())
+	}
+	c.function.upvalueCount = len(c.upvalues)
+	c.vm.compiler = c.enclosing
+	return c.functionRef
+}
+
+func (c *astCompiler) beginScope() {
+	c.scopeDepth++
+}
+
+func (c *astCompiler) endScope() {
+	c.scopeDepth--
+
+	for len(c.locals) > 0 && c.locals[len(c.locals)-1].depth > c.scopeDepth {
+		if c.locals[len(c.locals)-1].isCaptured {
+			c.emitByte(byte(OP_CLOSE_UPVALUE))
+		} else {
+			c.emitByte(byte(OP_POP))
+		}
+		c.locals = c.locals[:len(c.locals)-1]
+	}
+}
+
+// discardLocals emits the pops and upvalue closes for the locals deeper than
+// depth without forgetting them, for jumps that leave their scopes early.
+func (c *astCompiler) discardLocals(depth int) {
+	for i := len(c.locals) - 1; i >= 0 && c.locals[i].depth > depth; i-- {
+		if c.locals[i].isCaptured {
+			c.emitByte(byte(OP_CLOSE_UPVALUE))
+		} else {
+			c.emitByte(byte(OP_POP))
+		}
+	}
+}
+
+// declareVariable records a local for name when inside a scope. At the top
+// level it instead returns the constant index of the global's name.
+func (c *astCompiler) declareVariable(name *loxtoken.Token) uint8 {
+	if c.scopeDepth == 0 {
+		return c.identifierConstant(name)
+	}
+	c.addLocal(name)
+	return 0
+}
+
+func (c *astCompiler) defineVariable(global uint8) {
+	if c.scopeDepth > 0 {
+		c.markInitialized()
+		return
+	}
+	c.emitBytes(byte(OP_DEFINE_GLOBAL), global)
+}
+
+func (c *astCompiler) addLocal(name *loxtoken.Token) {
+	if len(c.locals) == localsMax {
+		c.reporter.TokenError(name, "Too many local variables in function.")
+		return
+	}
+	c.locals = append(c.locals, local{name: name.Lexeme, depth: -1})
+}
+
+func (c *astCompiler) markInitialized() {
+	if c.scopeDepth == 0 {
+		return
+	}
+	c.locals[len(c.locals)-1].depth = c.scopeDepth
+}
+
+func (c *astCompiler) namedVariable(name *loxtoken.Token, assign bool) {
+	var getOp, setOp OpCode
+	var arg uint8
+
+	if slot := c.resolveLocal(name); slot != -1 {
+		arg = uint8(slot)
+		getOp, setOp = OP_GET_LOCAL, OP_SET_LOCAL
+	} else if index := c.resolveUpvalue(name); index != -1 {
+		arg = uint8(index)
+		getOp, setOp = OP_GET_UPVALUE, OP_SET_UPVALUE
+	} else {
+		arg = c.identifierConstant(name)
+		getOp, setOp = OP_GET_GLOBAL, OP_SET_GLOBAL
+	}
+
+	if assign {
+		c.emitBytes(byte(setOp), arg)
+	} else {
+		c.emitBytes(byte(getOp), arg)
+	}
+}
+
+func (c *astCompiler) resolveLocal(name *loxtoken.Token) int {
+	for i := len(c.locals) - 1; i >= 0; i-- {
+		if c.locals[i].name == name.Lexeme {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *astCompiler) resolveUpvalue(name *loxtoken.Token) int {
+	if c.enclosing == nil {
+		return -1
+	}
+
+	if slot := c.enclosing.resolveLocal(name); slot != -1 {
+		c.enclosing.locals[slot].isCaptured = true
+		return c.addUpvalue(name, uint8(slot), true)
+	}
+
+	if index := c.enclosing.resolveUpvalue(name); index != -1 {
+		return c.addUpvalue(name, uint8(index), false)
+	}
+
+	return -1
+}
+
+func (c *astCompiler) addUpvalue(name *loxtoken.Token, index uint8, isLocal bool) int {
+	for i, upvalue := range c.upvalues {
+		if upvalue.index == index && upvalue.isLocal == isLocal {
+			return i
+		}
+	}
+
+	if len(c.upvalues) == upvaluesMax {
+		c.reporter.TokenError(name, "Too many closure variables in function.")
+		return 0
+	}
+
+	c.upvalues = append(c.upvalues, upvalue{index: index, isLocal: isLocal})
+	return len(c.upvalues) - 1
+}
+
+func (c *astCompiler) identifierConstant(name *loxtoken.Token) uint8 {
+	return c.makeConstant(c.stringConstant(name.Lexeme))
+}
+
+func (c *astCompiler) stringConstant(chars string) Value {
+	ref, err := c.vm.copyString(chars)
+	if err != nil {
+		c.reporter.Error(c.line, err.Error())
+	}
+	return ObjValue(ref)
+}
+
+// syntheticToken names a variable the compiler introduces itself, using the
+// line of the token that caused it.
+func syntheticToken(name string, at *loxtoken.Token) *loxtoken.Token {
+	return loxtoken.NewToken(loxtoken.IDENTIFIER, name, nil, at.Line)
+}
+
+func (c *astCompiler) setLine(tok *loxtoken.Token) {
+	c.line = tok.Line
+}
+
+func (c *astCompiler) currentChunk() *Chunk {
+	return c.function.chunk
+}
+
+func (c *astCompiler) makeConstant(val Value) uint8 {
+	if len(c.currentChunk().constants) > math.MaxUint8 {
+		c.reporter.Error(c.line, "Too many constants in one chunk.")
+		return 0
+	}
+	return c.currentChunk().WriteConstant(val)
+}
+
+func (c *astCompiler) emitByte(val byte) {
+	c.currentChunk().Write(val, c.line)
+}
+
+func (c *astCompiler) emitBytes(valOne byte, valTwo byte) {
+	c.emitByte(valOne)
+	c.emitByte(valTwo)
+}
+
+func (c *astCompiler) emitConstant(val Value) {
+	c.emitBytes(byte(OP_CONSTANT), c.makeConstant(val))
+}
+
+func (c *astCompiler) emitReturn() {
+	if c.funcType == TYPE_INITIALIZER {
+		c.emitBytes(byte(OP_GET_LOCAL), 0)
+	} else {
+		c.emitByte(byte(OP_NIL))
+	}
+	c.emitByte(byte(OP_RETURN))
+}
+
+// emitInlineCache writes the two byte index of a fresh inline cache for the
+// property access or invoke instruction just emitted.
+func (c *astCompiler) emitInlineCache() {
+	index := 0
+	if len(c.currentChunk().caches) == inlineCachesMax {
+		c.reporter.Error(c.line, "Too many property accesses in one chunk.")
+	} else {
+		index = c.currentChunk().AddInlineCache()
+	}
+	c.emitBytes(byte((index>>8)&0xff), byte(index&0xff))
+}
+
+func (c *astCompiler) emitJump(op OpCode) int {
+	c.emitByte(byte(op))
+	c.emitBytes(0xff, 0xff)
+	return len(c.currentChunk().code) - 2
+}
+
+func (c *astCompiler) patchJump(offset int) {
+	// -2 to adjust for the bytecode for the jump offset itself
+	jump := len(c.currentChunk().code) - offset - 2
+	if jump > math.MaxUint16 {
+		c.reporter.Error(c.line, "Too much code to jump over.")
+	}
+
+	c.currentChunk().code[offset] = byte((jump >> 8) & 0xff)
+	c.currentChunk().code[offset+1] = byte(jump & 0xff)
+}
+
+func (c *astCompiler) emitLoop(loopStart int) {
+	c.emitByte(byte(OP_LOOP))
+
+	offset := len(c.currentChunk().code) - loopStart + 2
+	if offset > math.MaxUint16 {
+		c.reporter.Error(c.line, "Loop body too large.")
+	}
+
+	c.emitByte(byte((offset >> 8) & 0xff))
+	c.emitByte(byte(offset & 0xff))
+}
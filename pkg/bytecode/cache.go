@@ -0,0 +1,81 @@
+package bytecode
+
+import "math"
+
+// inlineCaching can be switched off to measure what the caches save.
+var inlineCaching = true
+
+const inlineCachesMax = math.MaxUint16 + 1
+
+// shape maps field names to slots in ObjInstance.fields. Instances of the same
+// class that gained the same fields in the same order share a shape, so a
+// shape pins down both the receiver's class and its field layout.
+type shape struct {
+	slots       map[string]int
+	transitions map[string]*shape
+}
+
+func newShape() *shape {
+	return &shape{slots: map[string]int{}, transitions: map[string]*shape{}}
+}
+
+// with returns the shape reached by adding name as a new field.
+func (s *shape) with(name string) *shape {
+	if next, ok := s.transitions[name]; ok {
+		return next
+	}
+
+	next := newShape()
+	for field, slot := range s.slots {
+		next.slots[field] = slot
+	}
+	next.slots[name] = len(s.slots)
+	s.transitions[name] = next
+	return next
+}
+
+// inlineCache remembers how the last property access or invoke at one call
+// site was resolved. Entries are keyed on the receiver's shape. Method
+// entries also record the VM's class epoch, which is bumped whenever a method
+// table or superclass changes, so stale methods are never returned.
+//
+// Caches don't keep objects alive. A hit needs a live receiver with the
+// cached shape, or for super a handle equal to the cached class, and either
+// keeps the cached method reachable.
+type inlineCache struct {
+	shape *shape
+	// class keys super invokes, which look methods up on a fixed class
+	class ObjRef
+	epoch uint64
+	// slot is the field slot for field entries, or -1 for method entries
+	slot   int
+	method ObjRef
+	// next is the shape after a set added a new field
+	next *shape
+}
+
+func (c *inlineCache) fieldHit(instance *ObjInstance) (int, bool) {
+	if c.shape != instance.shape || c.slot < 0 || c.next != nil {
+		return 0, false
+	}
+	return c.slot, true
+}
+
+func (c *inlineCache) methodHit(shape *shape, class ObjRef, epoch uint64) (ObjRef, bool) {
+	if c.method.IsNil() || c.shape != shape || c.class != class || c.epoch != epoch {
+		return ObjRef{}, false
+	}
+	return c.method, true
+}
+
+func (c *inlineCache) fillField(shape *shape, slot int) {
+	*c = inlineCache{shape: shape, slot: slot}
+}
+
+func (c *inlineCache) fillMethod(shape *shape, class ObjRef, epoch uint64, method ObjRef) {
+	*c = inlineCache{shape: shape, class: class, epoch: epoch, slot: -1, method: method}
+}
+
+func (c *inlineCache) fillTransition(shape *shape, next *shape, slot int) {
+	*c = inlineCache{shape: shape, slot: slot, next: next}
+}
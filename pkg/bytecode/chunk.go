@@ -7,22 +7,68 @@ const (
 	OP_NIL
 	OP_TRUE
 	OP_FALSE
+	OP_POP
+	OP_GET_LOCAL
+	OP_SET_LOCAL
+	OP_GET_GLOBAL
+	OP_DEFINE_GLOBAL
+	OP_SET_GLOBAL
+	OP_GET_UPVALUE
+	OP_SET_UPVALUE
+	OP_GET_PROPERTY
+	OP_SET_PROPERTY
+	OP_GET_SUPER
+	// OP_INDEX replaces the object and index on top of the stack with the
+	// result of calling the object's __index__ method
+	OP_INDEX
 	OP_EQUAL
 	OP_GREATER
 	OP_LESS
+	OP_GREATER_EQUAL
+	OP_LESS_EQUAL
 	OP_ADD
 	OP_SUBTRACT
 	OP_MULTIPLY
 	OP_DIVIDE
+	OP_FLOOR_DIVIDE
+	OP_MODULO
+	OP_POWER
+	OP_BIT_AND
+	OP_BIT_OR
+	OP_BIT_XOR
+	OP_SHIFT_LEFT
+	OP_SHIFT_RIGHT
 	OP_NOT
 	OP_NEGATE
+	OP_BIT_NOT
+	OP_PRINT
+	// OP_TO_STRING replaces the value on top of the stack with the string
+	// print would show for it
+	OP_TO_STRING
+	OP_JUMP
+	OP_JUMP_IF_FALSE
+	OP_LOOP
+	OP_CALL
+	OP_INVOKE
+	OP_SUPER_INVOKE
+	OP_CLOSURE
+	OP_CLOSE_UPVALUE
 	OP_RETURN
+	OP_CLASS
+	OP_INHERIT
+	OP_METHOD
+	// OP_CLASS_METHOD, OP_GETTER and OP_SETTER bind the closure on top of
+	// the stack into the class below it, like OP_METHOD
+	OP_CLASS_METHOD
+	OP_GETTER
+	OP_SETTER
 )
 
 type Chunk struct {
 	code      []byte
 	lines     []int
 	constants ValueArray
+	caches    []inlineCache
 }
 
 func NewChunk() *Chunk {
@@ -43,8 +89,16 @@ func (c *Chunk) WriteConstant(value Value) uint8 {
 	return uint8(len(c.constants) - 1)
 }
 
+// AddInlineCache reserves an empty inline cache for a property access or
+// invoke call site and returns its index.
+func (c *Chunk) AddInlineCache() int {
+	c.caches = append(c.caches, inlineCache{slot: -1})
+	return len(c.caches) - 1
+}
+
 func (c *Chunk) Free() {
 	c.code = c.code[:0]
 	c.lines = c.lines[:0]
 	c.constants = c.constants[:0]
+	c.caches = c.caches[:0]
 }
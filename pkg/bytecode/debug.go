@@ -5,11 +5,18 @@ import (
 	"fmt"
 )
 
+// DisassembleChunk prints chunk without a heap, so object constants are
+// shown by handle.
 func DisassembleChunk(chunk *Chunk, name string) {
+	var vm *VM
+	vm.disassembleChunk(chunk, name)
+}
+
+func (vm *VM) disassembleChunk(chunk *Chunk, name string) {
 	fmt.Println("== ", name, " ==")
 	var err error
 	for offset := 0; offset < len(chunk.code); {
-		offset, err = disassembleInstruction(chunk, offset)
+		offset, err = vm.disassembleInstruction(chunk, offset)
 		if err != nil {
 			fmt.Printf("Error disassembling instruction at offset %d: %v\n", offset, err)
 			break
@@ -17,7 +24,7 @@ func DisassembleChunk(chunk *Chunk, name string) {
 	}
 }
 
-func disassembleInstruction(chunk *Chunk, offset int) (int, error) {
+func (vm *VM) disassembleInstruction(chunk *Chunk, offset int) (int, error) {
 	if offset >= len(chunk.code) {
 		return offset, fmt.Errorf("offset %d out of bounds", offset)
 	}
@@ -31,7 +38,7 @@ func disassembleInstruction(chunk *Chunk, offset int) (int, error) {
 	instruction := OpCode(chunk.code[offset])
 	switch instruction {
 	case OP_CONSTANT:
-		return constantInstruction("OP_CONSTANT", chunk, offset)
+		return vm.constantInstruction("OP_CONSTANT", chunk, offset)
 	case OP_ADD:
 		return simpleInstruction("OP_ADD", offset), nil
 	case OP_SUBTRACT:
@@ -40,10 +47,28 @@ func disassembleInstruction(chunk *Chunk, offset int) (int, error) {
 		return simpleInstruction("OP_MULTIPLY", offset), nil
 	case OP_DIVIDE:
 		return simpleInstruction("OP_DIVIDE", offset), nil
+	case OP_FLOOR_DIVIDE:
+		return simpleInstruction("OP_FLOOR_DIVIDE", offset), nil
+	case OP_MODULO:
+		return simpleInstruction("OP_MODULO", offset), nil
+	case OP_POWER:
+		return simpleInstruction("OP_POWER", offset), nil
+	case OP_BIT_AND:
+		return simpleInstruction("OP_BIT_AND", offset), nil
+	case OP_BIT_OR:
+		return simpleInstruction("OP_BIT_OR", offset), nil
+	case OP_BIT_XOR:
+		return simpleInstruction("OP_BIT_XOR", offset), nil
+	case OP_SHIFT_LEFT:
+		return simpleInstruction("OP_SHIFT_LEFT", offset), nil
+	case OP_SHIFT_RIGHT:
+		return simpleInstruction("OP_SHIFT_RIGHT", offset), nil
 	case OP_NOT:
 		return simpleInstruction("OP_NOT", offset), nil
 	case OP_NEGATE:
 		return simpleInstruction("OP_NEGATE", offset), nil
+	case OP_BIT_NOT:
+		return simpleInstruction("OP_BIT_NOT", offset), nil
 	case OP_RETURN:
 		return simpleInstruction("OP_RETURN", offset), nil
 	case OP_NIL:
@@ -58,6 +83,66 @@ func disassembleInstruction(chunk *Chunk, offset int) (int, error) {
 		return simpleInstruction("OP_GREATER", offset), nil
 	case OP_LESS:
 		return simpleInstruction("OP_LESS", offset), nil
+	case OP_INDEX:
+		return simpleInstruction("OP_INDEX", offset), nil
+	case OP_GREATER_EQUAL:
+		return simpleInstruction("OP_GREATER_EQUAL", offset), nil
+	case OP_LESS_EQUAL:
+		return simpleInstruction("OP_LESS_EQUAL", offset), nil
+	case OP_POP:
+		return simpleInstruction("OP_POP", offset), nil
+	case OP_GET_LOCAL:
+		return byteInstruction("OP_GET_LOCAL", chunk, offset), nil
+	case OP_SET_LOCAL:
+		return byteInstruction("OP_SET_LOCAL", chunk, offset), nil
+	case OP_GET_GLOBAL:
+		return vm.constantInstruction("OP_GET_GLOBAL", chunk, offset)
+	case OP_DEFINE_GLOBAL:
+		return vm.constantInstruction("OP_DEFINE_GLOBAL", chunk, offset)
+	case OP_SET_GLOBAL:
+		return vm.constantInstruction("OP_SET_GLOBAL", chunk, offset)
+	case OP_GET_UPVALUE:
+		return byteInstruction("OP_GET_UPVALUE", chunk, offset), nil
+	case OP_SET_UPVALUE:
+		return byteInstruction("OP_SET_UPVALUE", chunk, offset), nil
+	case OP_GET_PROPERTY:
+		return vm.propertyInstruction("OP_GET_PROPERTY", chunk, offset), nil
+	case OP_SET_PROPERTY:
+		return vm.propertyInstruction("OP_SET_PROPERTY", chunk, offset), nil
+	case OP_GET_SUPER:
+		return vm.propertyInstruction("OP_GET_SUPER", chunk, offset), nil
+	case OP_PRINT:
+		return simpleInstruction("OP_PRINT", offset), nil
+	case OP_TO_STRING:
+		return simpleInstruction("OP_TO_STRING", offset), nil
+	case OP_JUMP:
+		return jumpInstruction("OP_JUMP", 1, chunk, offset), nil
+	case OP_JUMP_IF_FALSE:
+		return jumpInstruction("OP_JUMP_IF_FALSE", 1, chunk, offset), nil
+	case OP_LOOP:
+		return jumpInstruction("OP_LOOP", -1, chunk, offset), nil
+	case OP_CALL:
+		return byteInstruction("OP_CALL", chunk, offset), nil
+	case OP_INVOKE:
+		return vm.invokeInstruction("OP_INVOKE", chunk, offset), nil
+	case OP_SUPER_INVOKE:
+		return vm.invokeInstruction("OP_SUPER_INVOKE", chunk, offset), nil
+	case OP_CLOSURE:
+		return vm.closureInstruction("OP_CLOSURE", chunk, offset)
+	case OP_CLOSE_UPVALUE:
+		return simpleInstruction("OP_CLOSE_UPVALUE", offset), nil
+	case OP_CLASS:
+		return vm.constantInstruction("OP_CLASS", chunk, offset)
+	case OP_INHERIT:
+		return simpleInstruction("OP_INHERIT", offset), nil
+	case OP_METHOD:
+		return vm.constantInstruction("OP_METHOD", chunk, offset)
+	case OP_CLASS_METHOD:
+		return vm.constantInstruction("OP_CLASS_METHOD", chunk, offset)
+	case OP_GETTER:
+		return vm.constantInstruction("OP_GETTER", chunk, offset)
+	case OP_SETTER:
+		return vm.constantInstruction("OP_SETTER", chunk, offset)
 	default:
 		fmt.Printf("Unknown opcode %d\n", instruction)
 		return offset + 1, errors.New("unknown opcode")
@@ -69,12 +154,65 @@ func simpleInstruction(name string, offset int) int {
 	return offset + 1
 }
 
-func constantInstruction(name string, chunk *Chunk, offset int) (int, error) {
+func (vm *VM) constantInstruction(name string, chunk *Chunk, offset int) (int, error) {
 	constantIndex := chunk.code[offset+1]
 	if constantIndex >= uint8(len(chunk.constants)) {
 		return offset, fmt.Errorf("constant index %d out of bounds", constantIndex)
 	}
 	constant := chunk.constants[constantIndex]
-	fmt.Printf("%s %s\n", name, constant)
+	fmt.Printf("%s %s\n", name, vm.format(constant))
 	return offset + 2, nil
 }
+
+func byteInstruction(name string, chunk *Chunk, offset int) int {
+	slot := chunk.code[offset+1]
+	fmt.Printf("%-16s %4d\n", name, slot)
+	return offset + 2
+}
+
+func (vm *VM) propertyInstruction(name string, chunk *Chunk, offset int) int {
+	constant := vm.format(chunk.constants[chunk.code[offset+1]])
+	cache := int(chunk.code[offset+2])<<8 | int(chunk.code[offset+3])
+	fmt.Printf("%-16s '%s' ic %d\n", name, constant, cache)
+	return offset + 4
+}
+
+func (vm *VM) invokeInstruction(name string, chunk *Chunk, offset int) int {
+	constant := vm.format(chunk.constants[chunk.code[offset+1]])
+	argCount := chunk.code[offset+2]
+	cache := int(chunk.code[offset+3])<<8 | int(chunk.code[offset+4])
+	fmt.Printf("%-16s (%d args) '%s' ic %d\n", name, argCount, constant, cache)
+	return offset + 5
+}
+
+func jumpInstruction(name string, sign int, chunk *Chunk, offset int) int {
+	jump := int(chunk.code[offset+1])<<8 | int(chunk.code[offset+2])
+	fmt.Printf("%-16s %4d -> %d\n", name, offset, offset+3+sign*jump)
+	return offset + 3
+}
+
+func (vm *VM) closureInstruction(name string, chunk *Chunk, offset int) (int, error) {
+	constantIndex := chunk.code[offset+1]
+	if constantIndex >= uint8(len(chunk.constants)) {
+		return offset, fmt.Errorf("constant index %d out of bounds", constantIndex)
+	}
+	constant := chunk.constants[constantIndex]
+	fmt.Printf("%s %s\n", name, vm.format(constant))
+
+	offset += 2
+	if vm == nil {
+		return offset, nil
+	}
+	function := vm.asFunction(constant.AsRef())
+	for i := 0; i < function.upvalueCount; i++ {
+		isLocal := chunk.code[offset]
+		index := chunk.code[offset+1]
+		kind := "upvalue"
+		if isLocal == 1 {
+			kind = "local"
+		}
+		fmt.Printf("%04d      |                     %s %d\n", offset, kind, index)
+		offset += 2
+	}
+	return offset, nil
+}
@@ -0,0 +1,181 @@
+package bytecode
+
+import "github.com/mkeesey/craftinginterpreters/pkg/heap"
+
+// fiberStackInitial is the number of value slots a fiber starts with. Stacks
+// grow as needed up to StackMax.
+const fiberStackInitial = 256
+
+func newFiber(closure ObjRef) *ObjFiber {
+	return &ObjFiber{
+		closure: closure,
+		stack:   make([]Value, fiberStackInitial),
+		state:   FIBER_NEW,
+	}
+}
+
+// switchFiber makes ref the running fiber. The caller is responsible for
+// keeping the fiber it leaves reachable.
+func (vm *VM) switchFiber(ref ObjRef) {
+	vm.fiberRef = ref
+	vm.fiber = vm.deref(ref).(*ObjFiber)
+}
+
+// growStack doubles the running fiber's stack. Open upvalues point into the
+// old stack, so they are moved to the new one.
+func (vm *VM) growStack() {
+	fiber := vm.fiber
+	if len(fiber.stack) >= StackMax {
+		panic("Stack overflow")
+	}
+
+	stack := make([]Value, min(2*len(fiber.stack), StackMax))
+	copy(stack, fiber.stack)
+	fiber.stack = stack
+	for _, ref := range fiber.openUpvalues {
+		upvalue := vm.asUpvalue(ref)
+		upvalue.location = &fiber.stack[upvalue.slot]
+	}
+}
+
+// finishFiber hands result to the fiber that resumed the running one, which
+// has returned from its function.
+func (vm *VM) finishFiber(result Value) {
+	fiber := vm.fiber
+	fiber.state = FIBER_DONE
+	fiber.stack = nil
+
+	caller := fiber.caller
+	fiber.caller = ObjRef{}
+	vm.switchFiber(caller)
+	vm.push(result)
+}
+
+func (vm *VM) definePrimitive(name string, primitive primitiveFn) {
+	native, err := vm.allocate(&ObjNative{name: name, primitive: primitive}, heap.Function, heap.FunctionSize)
+	if err != nil {
+		panic(err)
+	}
+	vm.globals[name] = ObjValue(native)
+}
+
+// optionalArg returns the single argument of a primitive that takes zero or
+// one, defaulting to nil.
+func (vm *VM) optionalArg(argCount int) (Value, bool) {
+	switch argCount {
+	case 0:
+		return NilValue(), true
+	case 1:
+		return vm.peek(0), true
+	default:
+		vm.runtimeError("Expected 0 or 1 arguments but got %d.", argCount)
+		return NilValue(), false
+	}
+}
+
+// fiberPrimitive implements Fiber(fn), creating a fiber that will call fn
+// when it is first resumed.
+func fiberPrimitive(vm *VM, argCount int) bool {
+	if argCount != 1 {
+		vm.runtimeError("Expected 1 arguments but got %d.", argCount)
+		return false
+	}
+	if !vm.isObjType(vm.peek(0), OBJ_CLOSURE) {
+		vm.runtimeError("Fiber function must be a function.")
+		return false
+	}
+	closure := vm.peek(0).AsRef()
+	if vm.asFunction(vm.asClosure(closure).function).arity > 1 {
+		vm.runtimeError("Fiber function must take 0 or 1 arguments.")
+		return false
+	}
+
+	fiber, ok := vm.newObject(newFiber(closure), heap.Fiber, heap.FiberSize)
+	if !ok {
+		return false
+	}
+	vm.fiber.stackIdx -= argCount + 1
+	vm.push(ObjValue(fiber))
+	return true
+}
+
+// yieldPrimitive implements yield(value), suspending the running fiber and
+// handing value to the fiber that resumed it.
+func yieldPrimitive(vm *VM, argCount int) bool {
+	value, ok := vm.optionalArg(argCount)
+	if !ok {
+		return false
+	}
+	if vm.fiber.caller.IsNil() {
+		vm.runtimeError("Can't yield from the main fiber.")
+		return false
+	}
+
+	fiber := vm.fiber
+	fiber.stackIdx -= argCount + 1
+	fiber.state = FIBER_SUSPENDED
+
+	caller := fiber.caller
+	fiber.caller = ObjRef{}
+	vm.switchFiber(caller)
+	vm.push(value)
+	return true
+}
+
+// invokeFiber calls one of the methods every fiber has.
+func (vm *VM) invokeFiber(name string, argCount int) bool {
+	ref := vm.peek(argCount).AsRef()
+	fiber := vm.deref(ref).(*ObjFiber)
+
+	switch name {
+	case "resume":
+		return vm.resumeFiber(ref, fiber, argCount)
+	case "isDone":
+		if argCount != 0 {
+			vm.runtimeError("Expected 0 arguments but got %d.", argCount)
+			return false
+		}
+		vm.fiber.stackIdx--
+		vm.push(BoolValue(fiber.state == FIBER_DONE))
+		return true
+	default:
+		vm.runtimeError("Undefined property '%s'.", name)
+		return false
+	}
+}
+
+// resumeFiber switches to fiber, passing it value as the argument to its
+// function on the first resume and as the result of yield afterwards. The
+// resume call gets its result when the fiber next yields or returns.
+func (vm *VM) resumeFiber(ref ObjRef, fiber *ObjFiber, argCount int) bool {
+	value, ok := vm.optionalArg(argCount)
+	if !ok {
+		return false
+	}
+	switch fiber.state {
+	case FIBER_RUNNING:
+		vm.runtimeError("Fiber is already running.")
+		return false
+	case FIBER_DONE:
+		vm.runtimeError("Can't resume a finished fiber.")
+		return false
+	}
+
+	vm.fiber.stackIdx -= argCount + 1
+	fiber.caller = vm.fiberRef
+	vm.switchFiber(ref)
+
+	if fiber.state == FIBER_SUSPENDED {
+		fiber.state = FIBER_RUNNING
+		vm.push(value)
+		return true
+	}
+
+	fiber.state = FIBER_RUNNING
+	vm.push(ObjValue(fiber.closure))
+	arity := vm.asFunction(vm.asClosure(fiber.closure).function).arity
+	if arity == 1 {
+		vm.push(value)
+	}
+	return vm.call(fiber.closure, arity)
+}
@@ -0,0 +1,169 @@
+package bytecode
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var fiberTests = []struct {
+	name     string
+	source   string
+	expected string
+}{
+	{
+		name: "generator",
+		source: `fun count() {
+  for (var i = 1; i <= 3; i = i + 1) yield(i);
+  return "done";
+}
+var gen = Fiber(count);
+while (!gen.isDone()) print gen.resume();`,
+		expected: "1\n2\n3\ndone\n",
+	},
+	{
+		name: "values flow both ways",
+		source: `fun echo(first) {
+  print "got " + first;
+  var second = yield("one");
+  print "got " + second;
+  return "two";
+}
+var fiber = Fiber(echo);
+print fiber.resume("a");
+print fiber.resume("b");
+print fiber.isDone();`,
+		expected: "got a\none\ngot b\ntwo\ntrue\n",
+	},
+	{
+		name: "yield without a value",
+		source: `fun task() { print yield(); }
+var fiber = Fiber(task);
+print fiber.resume();
+print fiber.resume();`,
+		expected: "nil\nnil\nnil\n",
+	},
+	{
+		name: "nested fibers",
+		source: `fun inner() { yield("inner 1"); return "inner 2"; }
+fun outer() {
+  var fiber = Fiber(inner);
+  yield(fiber.resume());
+  yield(fiber.resume());
+  return "outer";
+}
+var fiber = Fiber(outer);
+print fiber.resume();
+print fiber.resume();
+print fiber.resume();`,
+		expected: "inner 1\ninner 2\nouter\n",
+	},
+	{
+		name: "closures over fiber locals",
+		source: `fun task() {
+  var n = 0;
+  fun bump() { n = n + 1; return n; }
+  yield(bump);
+  yield(n);
+}
+var fiber = Fiber(task);
+var bump = fiber.resume();
+bump();
+bump();
+print fiber.resume();`,
+		expected: "2\n",
+	},
+	{
+		name: "stack grows under open upvalues",
+		source: `fun task() {
+  var captured = "before";
+  fun get() { return captured; }
+  fun deep(n) {
+    var a = 1; var b = 2; var c = 3; var d = 4; var e = 5;
+    if (n > 0) return deep(n - 1) + a;
+    captured = "after";
+    return 0;
+  }
+  print deep(60);
+  return get();
+}
+print Fiber(task).resume();`,
+		expected: "60\nafter\n",
+	},
+}
+
+func TestFibers(t *testing.T) {
+	for _, test := range fiberTests {
+		t.Run(test.name, func(t *testing.T) {
+			output, err := interpret(t, test.source)
+			if err != nil {
+				t.Fatalf("Interpret failed: %v", err)
+			}
+			if output != test.expected {
+				t.Errorf("Expected output %q, got %q", test.expected, output)
+			}
+		})
+	}
+}
+
+func TestFibersStressGC(t *testing.T) {
+	stressGC = true
+	defer func() { stressGC = false }()
+
+	for _, test := range fiberTests {
+		t.Run(test.name, func(t *testing.T) {
+			output, err := interpret(t, test.source)
+			if err != nil {
+				t.Fatalf("Interpret failed: %v", err)
+			}
+			if output != test.expected {
+				t.Errorf("Expected output %q, got %q", test.expected, output)
+			}
+		})
+	}
+}
+
+func TestFiberErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"error propagates out of fiber", `fun task() { print 1 - "a"; } Fiber(task).resume();`},
+		{"error propagates through nested fibers", `fun inner() { nil(); }
+fun outer() { Fiber(inner).resume(); }
+Fiber(outer).resume();`},
+		{"yield from main fiber", `yield(1);`},
+		{"resume finished fiber", `fun task() {} var f = Fiber(task); f.resume(); f.resume();`},
+		{"resume running fiber", `var f; fun task() { f.resume(); } f = Fiber(task); f.resume();`},
+		{"not a function", `Fiber(1);`},
+		{"too many parameters", `fun task(a, b) {} Fiber(task);`},
+		{"unknown method", `fun task() {} Fiber(task).missing();`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := interpret(t, test.source)
+			if !errors.Is(err, InterpretRuntimeError) {
+				t.Errorf("Expected runtime error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFailedFiberIsDone(t *testing.T) {
+	var out strings.Builder
+	vm := NewVM()
+	vm.out = &out
+	err := vm.Interpret(`fun task() { nil(); } var f = Fiber(task); f.resume();`)
+	if !errors.Is(err, InterpretRuntimeError) {
+		t.Fatalf("Expected runtime error, got %v", err)
+	}
+
+	// the main fiber is usable again, as in the REPL
+	if err := vm.Interpret(`print f.isDone();`); err != nil {
+		t.Fatalf("Interpret failed: %v", err)
+	}
+	if out.String() != "true\n" {
+		t.Errorf("Expected output %q, got %q", "true\n", out.String())
+	}
+}
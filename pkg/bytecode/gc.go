@@ -0,0 +1,280 @@
+package bytecode
+
+import (
+	"fmt"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/heap"
+)
+
+// stressGC collects before every allocation so an object that is reachable
+// but not rooted is freed as early as possible. logGC traces allocations and
+// collections to stdout.
+var stressGC = false
+var logGC = false
+
+// GCHeapGrowFactor sets the next collection threshold as a multiple of the
+// bytes still live after a collection.
+const GCHeapGrowFactor = 2
+
+const gcInitialThreshold = 1024 * 1024
+
+// heapObject is one slot of the VM's object table. A slot whose obj is nil
+// is free, and its generation is bumped each time it is freed.
+type heapObject struct {
+	obj        Obj
+	kind       heap.Kind
+	size       int
+	generation uint32
+	marked     bool
+}
+
+// allocate adds obj to the heap, collecting garbage first when the
+// threshold has been reached. Everything obj refers to must already be
+// reachable from a root, since obj itself is not until it is returned.
+func (vm *VM) allocate(obj Obj, kind heap.Kind, size int) (ObjRef, error) {
+	if stressGC || vm.heap.Stats().BytesAllocated+size > vm.nextGC {
+		vm.collectGarbage()
+	}
+	if err := vm.heap.Allocate(kind, size); err != nil {
+		// the threshold may be above the limit, so try again with a clean heap
+		if stressGC {
+			return ObjRef{}, err
+		}
+		vm.collectGarbage()
+		if err := vm.heap.Allocate(kind, size); err != nil {
+			return ObjRef{}, err
+		}
+	}
+
+	var index uint32
+	if n := len(vm.freeSlots); n > 0 {
+		index = vm.freeSlots[n-1]
+		vm.freeSlots = vm.freeSlots[:n-1]
+	} else {
+		index = uint32(len(vm.objects))
+		vm.objects = append(vm.objects, heapObject{})
+	}
+
+	slot := &vm.objects[index]
+	slot.obj = obj
+	slot.kind = kind
+	slot.size = size
+	slot.marked = false
+	ref := ObjRef{index: index, generation: slot.generation}
+
+	if logGC {
+		fmt.Printf("%s allocate %d for %s\n", ref, size, kind)
+	}
+	return ref, nil
+}
+
+// grow charges size more bytes to the live object ref, such as a field added
+// to an instance.
+func (vm *VM) grow(ref ObjRef, size int) error {
+	if err := vm.heap.Grow(size); err != nil {
+		vm.collectGarbage()
+		if err := vm.heap.Grow(size); err != nil {
+			return err
+		}
+	}
+	vm.objects[ref.index].size += size
+	return nil
+}
+
+// deref returns the object behind ref. Following a handle to a collected
+// object is a bug in the VM, almost always a missing root.
+func (vm *VM) deref(ref ObjRef) Obj {
+	if ref.IsNil() || int(ref.index) >= len(vm.objects) {
+		panic(fmt.Sprintf("invalid object handle %s", ref))
+	}
+	slot := &vm.objects[ref.index]
+	if slot.obj == nil || slot.generation != ref.generation {
+		panic(fmt.Sprintf("use of collected object %s", ref))
+	}
+	return slot.obj
+}
+
+// copyString returns the interned string for chars, allocating it if needed.
+func (vm *VM) copyString(chars string) (ObjRef, error) {
+	if ref, ok := vm.strings[chars]; ok {
+		return ref, nil
+	}
+	ref, err := vm.allocate(&ObjString{chars: chars}, heap.String, heap.StringSize(chars))
+	if err != nil {
+		return ObjRef{}, err
+	}
+	vm.strings[chars] = ref
+	return ref, nil
+}
+
+func (vm *VM) isObjType(value Value, objType ObjType) bool {
+	return value.IsObj() && vm.deref(value.AsRef()).Type() == objType
+}
+
+func (vm *VM) asString(value Value) string {
+	return vm.deref(value.AsRef()).(*ObjString).chars
+}
+
+func (vm *VM) asFunction(ref ObjRef) *ObjFunction {
+	return vm.deref(ref).(*ObjFunction)
+}
+
+func (vm *VM) asClosure(ref ObjRef) *ObjClosure {
+	return vm.deref(ref).(*ObjClosure)
+}
+
+func (vm *VM) asUpvalue(ref ObjRef) *ObjUpvalue {
+	return vm.deref(ref).(*ObjUpvalue)
+}
+
+func (vm *VM) asClass(ref ObjRef) *ObjClass {
+	return vm.deref(ref).(*ObjClass)
+}
+
+func (vm *VM) collectGarbage() {
+	var before int
+	if logGC {
+		fmt.Printf("-- gc begin\n")
+		before = vm.heap.Stats().BytesAllocated
+	}
+
+	vm.markRoots()
+	vm.traceReferences()
+	vm.removeWhiteStrings()
+	vm.sweep()
+
+	vm.nextGC = vm.heap.Stats().BytesAllocated * GCHeapGrowFactor
+	if vm.nextGC < gcInitialThreshold {
+		vm.nextGC = gcInitialThreshold
+	}
+
+	if logGC {
+		after := vm.heap.Stats().BytesAllocated
+		fmt.Printf("-- gc end\n")
+		fmt.Printf("   collected %d bytes (from %d to %d) next at %d\n", before-after, before, after, vm.nextGC)
+	}
+}
+
+func (vm *VM) markRoots() {
+	// the running fiber reaches every fiber waiting on it through caller
+	vm.markObject(vm.fiberRef)
+	vm.markObject(vm.mainFiber)
+	for _, value := range vm.globals {
+		vm.markValue(value)
+	}
+	for compiler := vm.compiler; compiler != nil; compiler = compiler.enclosing {
+		vm.markObject(compiler.functionRef)
+	}
+}
+
+func (vm *VM) markValue(value Value) {
+	if value.IsObj() {
+		vm.markObject(value.AsRef())
+	}
+}
+
+func (vm *VM) markObject(ref ObjRef) {
+	if ref.IsNil() {
+		return
+	}
+	vm.deref(ref)
+	slot := &vm.objects[ref.index]
+	if slot.marked {
+		return
+	}
+
+	if logGC {
+		fmt.Printf("%s mark %s\n", ref, vm.format(ObjValue(ref)))
+	}
+	slot.marked = true
+	vm.grayStack = append(vm.grayStack, ref)
+}
+
+func (vm *VM) traceReferences() {
+	for len(vm.grayStack) > 0 {
+		ref := vm.grayStack[len(vm.grayStack)-1]
+		vm.grayStack = vm.grayStack[:len(vm.grayStack)-1]
+		vm.blackenObject(ref)
+	}
+}
+
+func (vm *VM) blackenObject(ref ObjRef) {
+	if logGC {
+		fmt.Printf("%s blacken %s\n", ref, vm.format(ObjValue(ref)))
+	}
+
+	switch obj := vm.deref(ref).(type) {
+	case *ObjBoundMethod:
+		vm.markValue(obj.receiver)
+		vm.markObject(obj.method)
+	case *ObjClass:
+		vm.markObject(obj.superclass)
+		for _, table := range []map[string]ObjRef{obj.methods, obj.statics, obj.getters, obj.setters} {
+			for _, method := range table {
+				vm.markObject(method)
+			}
+		}
+	case *ObjFiber:
+		vm.markObject(obj.closure)
+		vm.markObject(obj.caller)
+		for i := 0; i < obj.stackIdx; i++ {
+			vm.markValue(obj.stack[i])
+		}
+		for i := 0; i < obj.frameCount; i++ {
+			vm.markObject(obj.frames[i].closureRef)
+		}
+		for _, upvalue := range obj.openUpvalues {
+			vm.markObject(upvalue)
+		}
+	case *ObjIterator:
+		vm.markObject(obj.str)
+	case *ObjClosure:
+		vm.markObject(obj.function)
+		for _, upvalue := range obj.upvalues {
+			vm.markObject(upvalue)
+		}
+	case *ObjFunction:
+		for _, constant := range obj.chunk.constants {
+			vm.markValue(constant)
+		}
+	case *ObjInstance:
+		vm.markObject(obj.class)
+		for _, field := range obj.fields {
+			vm.markValue(field)
+		}
+	case *ObjUpvalue:
+		vm.markValue(obj.closed)
+	case *ObjNative, *ObjString:
+	}
+}
+
+// removeWhiteStrings drops unmarked strings from the intern table, which
+// holds its strings weakly.
+func (vm *VM) removeWhiteStrings() {
+	for chars, ref := range vm.strings {
+		if !vm.objects[ref.index].marked {
+			delete(vm.strings, chars)
+		}
+	}
+}
+
+func (vm *VM) sweep() {
+	for i := 1; i < len(vm.objects); i++ {
+		slot := &vm.objects[i]
+		if slot.obj == nil {
+			continue
+		}
+		if slot.marked {
+			slot.marked = false
+			continue
+		}
+
+		if logGC {
+			fmt.Printf("%s free type %d\n", ObjRef{index: uint32(i), generation: slot.generation}, slot.obj.Type())
+		}
+		vm.heap.Free(slot.kind, slot.size)
+		slot.obj = nil
+		slot.generation++
+		vm.freeSlots = append(vm.freeSlots, uint32(i))
+	}
+}
@@ -0,0 +1,107 @@
+package bytecode
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInterpretStressGC(t *testing.T) {
+	stressGC = true
+	defer func() { stressGC = false }()
+
+	for _, test := range interpretTests {
+		t.Run(test.name, func(t *testing.T) {
+			output, err := interpret(t, test.source)
+			if err != nil {
+				t.Fatalf("Interpret failed: %v", err)
+			}
+			if output != test.expected {
+				t.Errorf("Expected output %q, got %q", test.expected, output)
+			}
+		})
+	}
+}
+
+func TestStressGCFindsMissingRoots(t *testing.T) {
+	stressGC = true
+	defer func() { stressGC = false }()
+
+	vm := NewVM()
+	unrooted, err := vm.copyString("waffles")
+	if err != nil {
+		t.Fatalf("Allocation failed: %v", err)
+	}
+	if _, err := vm.copyString("tacos"); err != nil {
+		t.Fatalf("Allocation failed: %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected use of an unrooted object to panic")
+		}
+	}()
+	vm.deref(unrooted)
+}
+
+func TestGarbageIsCollected(t *testing.T) {
+	source := `class Waffle {}
+for (var i = 0; i < 1000; i = i + 1) {
+  var waffle = Waffle();
+  waffle.topping = "syrup";
+  var s = "waffle " + "number";
+}
+print "done";`
+
+	vm := NewVM()
+	var out strings.Builder
+	vm.out = &out
+	vm.SetMaxHeap(4096)
+	if err := vm.Interpret(source); err != nil {
+		t.Fatalf("Interpret failed: %v", err)
+	}
+	if out.String() != "done\n" {
+		t.Errorf("Expected output %q, got %q", "done\n", out.String())
+	}
+
+	stats := vm.HeapStats()
+	if stats.BytesAllocated > stats.MaxHeap {
+		t.Errorf("Allocated %d bytes, over the limit of %d", stats.BytesAllocated, stats.MaxHeap)
+	}
+}
+
+func TestStringsAreInterned(t *testing.T) {
+	vm := NewVM()
+	a, err := vm.copyString("waffles")
+	if err != nil {
+		t.Fatalf("Allocation failed: %v", err)
+	}
+	vm.push(ObjValue(a))
+	b, err := vm.copyString("waffles")
+	if err != nil {
+		t.Fatalf("Allocation failed: %v", err)
+	}
+	if a != b {
+		t.Errorf("Expected equal strings to share a handle, got %s and %s", a, b)
+	}
+}
+
+func TestHostFunctionsStressGC(t *testing.T) {
+	stressGC = true
+	defer func() { stressGC = false }()
+
+	vm := NewVM()
+	var out strings.Builder
+	vm.out = &out
+	if err := vm.DefineNative("repeat", strings.Repeat); err != nil {
+		t.Fatalf("DefineNative failed: %v", err)
+	}
+
+	source := `var a = "ab";
+print repeat(a + "c", 2) + repeat("d", 3);`
+	if err := vm.Interpret(source); err != nil {
+		t.Fatalf("Interpret failed: %v", err)
+	}
+	if out.String() != "abcabcddd\n" {
+		t.Errorf("Expected output %q, got %q", "abcabcddd\n", out.String())
+	}
+}
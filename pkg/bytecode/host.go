@@ -0,0 +1,148 @@
+package bytecode
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/heap"
+	"github.com/mkeesey/craftinginterpreters/pkg/native"
+)
+
+// Object is a heap object handed out of the VM. The VM may collect the
+// object once nothing in the script refers to it, so only its type and how
+// it prints are kept.
+type Object struct {
+	Type ObjType
+	repr string
+}
+
+func (o Object) String() string {
+	return o.repr
+}
+
+// TypeName names the kind of object for the type native.
+func (o Object) TypeName() string {
+	switch o.Type {
+	case OBJ_FUNCTION, OBJ_NATIVE, OBJ_CLOSURE, OBJ_BOUND_METHOD:
+		return "function"
+	case OBJ_CLASS:
+		return "class"
+	case OBJ_INSTANCE:
+		return "instance"
+	case OBJ_FIBER:
+		return "fiber"
+	case OBJ_ITERATOR:
+		return "iterator"
+	}
+	return "object"
+}
+
+// DefineGlobal defines or redefines a global variable from Go. value must be
+// nil, a bool, a float64 or a string.
+func (vm *VM) DefineGlobal(name string, value interface{}) error {
+	v, err := vm.importValue(value)
+	if err != nil {
+		return err
+	}
+	vm.globals[name] = v
+	return nil
+}
+
+// DefineNative defines a global function that calls fn, a Go function whose
+// parameters and results are converted as described by native.Wrap. An
+// error returned by fn becomes a runtime error at the call.
+func (vm *VM) DefineNative(name string, fn interface{}) error {
+	wrapped, err := native.Wrap(name, fn)
+	if err != nil {
+		return err
+	}
+	ref, err := vm.allocate(&ObjNative{name: name, host: wrapped}, heap.Function, heap.FunctionSize)
+	if err != nil {
+		return err
+	}
+	vm.globals[name] = ObjValue(ref)
+	return nil
+}
+
+// Listless tells stdlib.Install that the VM has no lists, so natives that
+// return them are left out.
+func (vm *VM) Listless() {}
+
+// callHost calls a Go function with the arguments on top of the stack,
+// replacing them and the callee with its result.
+func (vm *VM) callHost(fn *native.Func, argCount int) bool {
+	if arity := fn.Arity(); arity >= 0 && argCount != arity {
+		vm.runtimeError("Expected %d arguments but got %d.", arity, argCount)
+		return false
+	}
+
+	args := make([]interface{}, argCount)
+	for i, arg := range vm.fiber.stack[vm.fiber.stackIdx-argCount : vm.fiber.stackIdx] {
+		args[i] = vm.export(arg)
+	}
+	result, err := fn.Call(args)
+	if err != nil {
+		vm.runtimeError("%s", err)
+		return false
+	}
+	// the arguments stay on the stack while the result is allocated
+	value, err := vm.importValue(result)
+	if errors.Is(err, heap.ErrOutOfMemory) {
+		vm.runtimeError("%s", err)
+		return false
+	} else if err != nil {
+		vm.runtimeError("Can't convert %T returned by '%s' to a Lox value.", result, fn.Name())
+		return false
+	}
+
+	vm.fiber.stackIdx -= argCount + 1
+	vm.push(value)
+	return true
+}
+
+// Global returns the value of a global variable, converted as by Eval.
+func (vm *VM) Global(name string) (interface{}, bool) {
+	value, ok := vm.globals[name]
+	if !ok {
+		return nil, false
+	}
+	return vm.export(value), true
+}
+
+// export converts value to its Go equivalent.
+func (vm *VM) export(value Value) interface{} {
+	switch value.Type {
+	case VAL_NIL:
+		return nil
+	case VAL_BOOL:
+		return value.AsBool()
+	case VAL_NUMBER:
+		return value.AsNumber()
+	}
+
+	obj := vm.deref(value.AsRef())
+	if str, ok := obj.(*ObjString); ok {
+		return str.chars
+	}
+	return Object{Type: obj.Type(), repr: vm.format(value)}
+}
+
+// importValue converts a Go value to a VM value, allocating strings.
+func (vm *VM) importValue(value interface{}) (Value, error) {
+	switch v := value.(type) {
+	case nil:
+		return NilValue(), nil
+	case bool:
+		return BoolValue(v), nil
+	case float64:
+		return NumberValue(v), nil
+	case string:
+		ref, err := vm.copyString(v)
+		if err != nil {
+			return NilValue(), err
+		}
+		return ObjValue(ref), nil
+	default:
+		return NilValue(), fmt.Errorf("can't convert %T to a Lox value", value)
+	}
+}
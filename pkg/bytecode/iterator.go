@@ -0,0 +1,66 @@
+package bytecode
+
+import (
+	"unicode/utf8"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/heap"
+)
+
+// invokeString calls a method on the string below the arguments. Strings
+// only have iterator, which for-in loops call.
+func (vm *VM) invokeString(name string, argCount int) bool {
+	if name != "iterator" {
+		vm.runtimeError("Undefined property '%s'.", name)
+		return false
+	}
+	if argCount != 0 {
+		vm.runtimeError("Expected 0 arguments but got %d.", argCount)
+		return false
+	}
+
+	str := vm.peek(0).AsRef()
+	size := heap.InstanceSize + heap.StringSize(vm.asString(ObjValue(str)))
+	ref, ok := vm.newObject(&ObjIterator{str: str}, heap.Instance, size)
+	if !ok {
+		return false
+	}
+	vm.pop()
+	vm.push(ObjValue(ref))
+	return true
+}
+
+// invokeIterator calls hasNext or next on the string iterator below the
+// arguments.
+func (vm *VM) invokeIterator(name string, argCount int) bool {
+	if name != "hasNext" && name != "next" {
+		vm.runtimeError("Undefined property '%s'.", name)
+		return false
+	}
+	if argCount != 0 {
+		vm.runtimeError("Expected 0 arguments but got %d.", argCount)
+		return false
+	}
+
+	it := vm.deref(vm.peek(0).AsRef()).(*ObjIterator)
+	chars := vm.asString(ObjValue(it.str))
+	if name == "hasNext" {
+		vm.pop()
+		vm.push(BoolValue(it.offset < len(chars)))
+		return true
+	}
+
+	if it.offset >= len(chars) {
+		vm.runtimeError("Iterator has no more elements.")
+		return false
+	}
+	_, size := utf8.DecodeRuneInString(chars[it.offset:])
+	// the iterator stays on the stack while the character is allocated
+	ref, ok := vm.newString(chars[it.offset : it.offset+size])
+	if !ok {
+		return false
+	}
+	it.offset += size
+	vm.pop()
+	vm.push(ObjValue(ref))
+	return true
+}
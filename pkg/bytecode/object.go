@@ -0,0 +1,201 @@
+package bytecode
+
+import (
+	"fmt"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/native"
+)
+
+type ObjType int
+
+const (
+	OBJ_STRING ObjType = iota
+	OBJ_FUNCTION
+	OBJ_NATIVE
+	OBJ_CLOSURE
+	OBJ_UPVALUE
+	OBJ_CLASS
+	OBJ_INSTANCE
+	OBJ_BOUND_METHOD
+	OBJ_FIBER
+	OBJ_ITERATOR
+)
+
+// ObjRef is a handle to an object owned by a VM's heap. Objects refer to each
+// other through handles rather than Go pointers so the collector can see and
+// free everything. The generation detects use of a handle whose object has
+// been collected and whose slot was reused.
+type ObjRef struct {
+	index      uint32
+	generation uint32
+}
+
+// IsNil reports whether the handle refers to nothing. Slot zero of the heap
+// is never used.
+func (r ObjRef) IsNil() bool {
+	return r.index == 0
+}
+
+func (r ObjRef) String() string {
+	return fmt.Sprintf("<obj %d>", r.index)
+}
+
+type Obj interface {
+	Type() ObjType
+}
+
+type ObjString struct {
+	chars string
+}
+
+func (o *ObjString) Type() ObjType {
+	return OBJ_STRING
+}
+
+type ObjFunction struct {
+	arity        int
+	upvalueCount int
+	chunk        *Chunk
+	name         string
+}
+
+func (o *ObjFunction) Type() ObjType {
+	return OBJ_FUNCTION
+}
+
+func (o *ObjFunction) String() string {
+	if o.name == "" {
+		return "<script>"
+	}
+	return fmt.Sprintf("<fn %s>", o.name)
+}
+
+type NativeFn func(args []Value) Value
+
+// primitiveFn is a native that works on the VM directly, taking its
+// arguments from the stack and pushing its own result. Switching fibers
+// needs this. It reports failure like call does.
+type primitiveFn func(vm *VM, argCount int) bool
+
+// ObjNative is a builtin implemented by exactly one of function, primitive
+// or host, a Go function registered with DefineNative.
+type ObjNative struct {
+	name      string
+	arity     int
+	function  NativeFn
+	primitive primitiveFn
+	host      *native.Func
+}
+
+func (o *ObjNative) Type() ObjType {
+	return OBJ_NATIVE
+}
+
+type ObjClosure struct {
+	function ObjRef
+	upvalues []ObjRef
+}
+
+func (o *ObjClosure) Type() ObjType {
+	return OBJ_CLOSURE
+}
+
+// ObjUpvalue points at a stack slot while the captured variable is still
+// live, and at its own closed field once the slot has been popped.
+type ObjUpvalue struct {
+	location *Value
+	slot     int
+	closed   Value
+}
+
+func (o *ObjUpvalue) Type() ObjType {
+	return OBJ_UPVALUE
+}
+
+type ObjClass struct {
+	name       string
+	superclass ObjRef
+	methods    map[string]ObjRef
+	// statics are the class methods, called with the class as receiver
+	statics map[string]ObjRef
+	getters map[string]ObjRef
+	setters map[string]ObjRef
+	// root is the shape of an instance with no fields
+	root *shape
+}
+
+func (o *ObjClass) Type() ObjType {
+	return OBJ_CLASS
+}
+
+type ObjInstance struct {
+	class  ObjRef
+	shape  *shape
+	fields []Value
+}
+
+func (o *ObjInstance) Type() ObjType {
+	return OBJ_INSTANCE
+}
+
+func (o *ObjInstance) setField(name string, value Value) {
+	if slot, ok := o.shape.slots[name]; ok {
+		o.fields[slot] = value
+		return
+	}
+	o.shape = o.shape.with(name)
+	o.fields = append(o.fields, value)
+}
+
+type ObjBoundMethod struct {
+	receiver Value
+	method   ObjRef
+}
+
+func (o *ObjBoundMethod) Type() ObjType {
+	return OBJ_BOUND_METHOD
+}
+
+type fiberState int
+
+const (
+	FIBER_NEW fiberState = iota
+	// FIBER_RUNNING covers the fiber executing and every fiber waiting on
+	// a resume it made, none of which may be resumed again.
+	FIBER_RUNNING
+	FIBER_SUSPENDED
+	FIBER_DONE
+)
+
+// ObjFiber is a coroutine with its own value stack and frame stack. The VM
+// runs one fiber at a time; resuming a fiber suspends its caller until the
+// fiber yields or returns.
+type ObjFiber struct {
+	// closure is the function a new fiber starts by calling
+	closure      ObjRef
+	frames       [FramesMax]CallFrame
+	frameCount   int
+	stack        []Value
+	stackIdx     int
+	openUpvalues []ObjRef
+	// caller is the fiber that resumed this one, nil for the main fiber
+	caller ObjRef
+	state  fiberState
+}
+
+func (o *ObjFiber) Type() ObjType {
+	return OBJ_FIBER
+}
+
+// ObjIterator is what iterator() returns for a string: it steps through the
+// string's characters for for-in loops, through the same hasNext and next
+// methods instances implement.
+type ObjIterator struct {
+	str ObjRef
+	// offset is the byte offset of the next character
+	offset int
+}
+
+func (o *ObjIterator) Type() ObjType {
+	return OBJ_ITERATOR
+}
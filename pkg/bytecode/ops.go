@@ -1,5 +1,11 @@
 package bytecode
 
+import (
+	"math"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/ast"
+)
+
 func greater(a, b float64) Value {
 	return BoolValue(a > b)
 }
@@ -8,6 +14,14 @@ func less(a, b float64) Value {
 	return BoolValue(a < b)
 }
 
+func greaterEqual(a, b float64) Value {
+	return BoolValue(a >= b)
+}
+
+func lessEqual(a, b float64) Value {
+	return BoolValue(a <= b)
+}
+
 func add(a, b float64) Value {
 	return NumberValue(a + b)
 }
@@ -23,3 +37,15 @@ func multiply(a, b float64) Value {
 func divide(a, b float64) Value {
 	return NumberValue(a / b)
 }
+
+func floorDivide(a, b float64) Value {
+	return NumberValue(ast.FloorDivide(a, b))
+}
+
+func modulo(a, b float64) Value {
+	return NumberValue(ast.Modulo(a, b))
+}
+
+func power(a, b float64) Value {
+	return NumberValue(math.Pow(a, b))
+}
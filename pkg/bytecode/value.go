@@ -8,6 +8,7 @@ const (
 	VAL_BOOL ValueType = iota
 	VAL_NIL
 	VAL_NUMBER
+	VAL_OBJ
 )
 
 func BoolValue(b bool) Value {
@@ -22,12 +23,21 @@ func NumberValue(n float64) Value {
 	return Value{Type: VAL_NUMBER, Value: n}
 }
 
+func ObjValue(ref ObjRef) Value {
+	return Value{Type: VAL_OBJ, Value: ref}
+}
+
 type Value struct {
 	Type  ValueType
 	Value any
 }
 
+// String formats the value without access to the heap, so objects are shown
+// by handle. Use VM.format to print an object's contents.
 func (v Value) String() string {
+	if v.IsNil() {
+		return "nil"
+	}
 	return fmt.Sprintf("%v", v.Value)
 }
 
@@ -43,6 +53,10 @@ func (v Value) IsNumber() bool {
 	return v.Type == VAL_NUMBER
 }
 
+func (v Value) IsObj() bool {
+	return v.Type == VAL_OBJ
+}
+
 func (v Value) AsBool() bool {
 	return v.Value.(bool)
 }
@@ -51,8 +65,14 @@ func (v Value) AsNumber() float64 {
 	return v.Value.(float64)
 }
 
+func (v Value) AsRef() ObjRef {
+	return v.Value.(ObjRef)
+}
+
 type ValueArray []Value
 
+// valuesEqual compares objects by handle. Strings are interned, so equal
+// strings share a handle.
 func valuesEqual(a, b Value) bool {
 	if a.Type != b.Type {
 		return false
@@ -64,6 +84,8 @@ func valuesEqual(a, b Value) bool {
 		return true
 	case VAL_NUMBER:
 		return a.AsNumber() == b.AsNumber()
+	case VAL_OBJ:
+		return a.AsRef() == b.AsRef()
 	default:
 		return false
 	}
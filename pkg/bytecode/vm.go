@@ -2,103 +2,398 @@ package bytecode
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/ast"
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/heap"
+	"github.com/mkeesey/craftinginterpreters/pkg/stdlib"
+	loxtoken "github.com/mkeesey/craftinginterpreters/pkg/token"
 )
 
 var Debug = false
 
 var ErrInterpretError = fmt.Errorf("interpret error")
 var ErrRuntimeError = fmt.Errorf("runtime error")
+var ErrCompileError = fmt.Errorf("compile error")
 var InterpretRuntimeError = fmt.Errorf("interpret runtime error")
 
-const StackMax = 256
+const FramesMax = 64
+const StackMax = FramesMax * 256
 
-type VM struct {
-	chunk    *Chunk
-	stack    [StackMax]Value
+type CallFrame struct {
+	closureRef ObjRef
+	// closure and function are cached from closureRef, which keeps them alive
+	closure  *ObjClosure
+	function *ObjFunction
 	ip       int
-	stackIdx int
+	// index of the frame's first stack slot
+	slots int
+	// strCalled is set while the frame waits on a __str__ method, whose
+	// result the instruction that called it runs again on
+	strCalled bool
+	// discardResult is set on a setter's frame: the assignment that called
+	// it evaluates to the assigned value, not what the setter returns
+	discardResult bool
+	// callResult is set on the frame of a getter an invoke read: what it
+	// returns is called with the callArgs arguments below its receiver
+	callResult bool
+	callArgs   int
+}
+
+type VM struct {
+	// fiber is the running fiber, cached from fiberRef
+	fiber     *ObjFiber
+	fiberRef  ObjRef
+	mainFiber ObjRef
+	globals   map[string]Value
+	// classEpoch changes whenever any class gains a method or a superclass,
+	// invalidating every cached method lookup.
+	classEpoch uint64
+
+	heap      *heap.Heap
+	objects   []heapObject
+	freeSlots []uint32
+	grayStack []ObjRef
+	nextGC    int
+	// strings interns every string so equal strings share a handle
+	strings map[string]ObjRef
+	// compiler is the innermost function being compiled, whose functions
+	// are roots until the script starts running
+	compiler *astCompiler
+
+	out    io.Writer
+	errOut io.Writer
+	// interrupt stops the running script once closed
+	interrupt <-chan struct{}
 }
 
 func NewVM() *VM {
 	vm := &VM{
-		chunk:    nil,
-		stack:    [StackMax]Value{},
-		ip:       0,
-		stackIdx: 0,
+		globals: make(map[string]Value),
+		heap:    heap.New(0),
+		// slot zero is reserved so the zero ObjRef is never a live object
+		objects: make([]heapObject, 1),
+		nextGC:  gcInitialThreshold,
+		strings: make(map[string]ObjRef),
+		out:     os.Stdout,
+		errOut:  os.Stderr,
+	}
+	main, err := vm.allocate(newFiber(ObjRef{}), heap.Fiber, heap.FiberSize)
+	if err != nil {
+		panic(err)
 	}
+	vm.mainFiber = main
 	vm.resetStack()
+
+	vm.defineNative("clock", 0, clockNative)
+	vm.definePrimitive("Fiber", fiberPrimitive)
+	vm.definePrimitive("yield", yieldPrimitive)
+	if err := stdlib.Install(vm); err != nil {
+		panic(err)
+	}
 	return vm
 }
 
+// resetStack abandons every fiber and empties the main one.
 func (vm *VM) resetStack() {
-	vm.stackIdx = 0
+	vm.switchFiber(vm.mainFiber)
+	vm.fiber.stackIdx = 0
+	vm.fiber.frameCount = 0
+	vm.fiber.openUpvalues = nil
+	vm.fiber.caller = ObjRef{}
+	vm.fiber.state = FIBER_RUNNING
 }
 
 func (vm *VM) Free() {
+	vm.globals = make(map[string]Value)
+	vm.resetStack()
+	vm.collectGarbage()
+}
+
+// SetMaxHeap limits the estimated bytes of live strings, instances,
+// closures, upvalues, functions and classes. Zero means no limit.
+func (vm *VM) SetMaxHeap(bytes int) {
+	vm.heap.SetMaxHeap(bytes)
+}
+
+func (vm *VM) HeapStats() heap.Stats {
+	return vm.heap.Stats()
+}
+
+// SetOutput redirects print statements, which go to stdout by default.
+func (vm *VM) SetOutput(w io.Writer) {
+	vm.out = w
+}
+
+// SetErrorOutput redirects compile and runtime errors, which go to stderr by
+// default.
+func (vm *VM) SetErrorOutput(w io.Writer) {
+	vm.errOut = w
+}
+
+// SetInterrupt makes the running script stop with a runtime error once done
+// is closed. It is checked on each loop iteration and function call.
+func (vm *VM) SetInterrupt(done <-chan struct{}) {
+	vm.interrupt = done
 }
 
 func (vm *VM) Interpret(source string) error {
-	chunk := NewChunk()
+	_, err := vm.interpret(source, false)
+	return err
+}
+
+// Eval runs source like Interpret. If the last statement is an expression
+// statement, its value is returned as a Go value: nil, bool, float64, string
+// or an Object.
+func (vm *VM) Eval(source string) (interface{}, error) {
+	result, err := vm.interpret(source, true)
+	if err != nil {
+		return nil, err
+	}
+	return vm.export(result), nil
+}
 
-	err := compile(source, chunk)
+// interpret compiles and runs source. With keepResult, a trailing expression
+// statement's value is returned rather than discarded.
+func (vm *VM) interpret(source string, keepResult bool) (Value, error) {
+	reporter := failure.NewReporter(vm.errOut)
+	function, err := vm.compile(strings.NewReader(source), reporter, keepResult)
 	if err != nil {
-		return fmt.Errorf("Interpret: %w", err)
+		if err != ErrCompileError {
+			fmt.Fprintf(vm.errOut, "%s\n", err)
+		}
+		return NilValue(), ErrCompileError
 	}
 
-	vm.chunk = chunk
-	vm.ip = 0
+	// the function is only reachable from the stack until its closure exists
+	vm.push(ObjValue(function))
+	closure, ok := vm.newClosure(function)
+	if !ok {
+		return NilValue(), InterpretRuntimeError
+	}
+	vm.pop()
+	vm.push(ObjValue(closure))
+	if !vm.call(closure, 0) {
+		return NilValue(), InterpretRuntimeError
+	}
 
-	return vm.run()
+	if err := vm.run(); err != nil {
+		return NilValue(), err
+	}
+	// the script leaves its return value on the stack
+	return vm.pop(), nil
 }
 
 func (vm *VM) run() error {
+	frame := &vm.fiber.frames[vm.fiber.frameCount-1]
+
 	for {
-		if vm.ip >= len(vm.chunk.code) {
+		code := frame.function.chunk.code
+		if frame.ip >= len(code) {
 			return ErrInterpretError
 		}
 
 		if Debug {
 			fmt.Printf("         ")
-			for i := 0; i < vm.stackIdx; i++ {
-				fmt.Printf("[ %s ]", vm.stack[i])
+			for i := 0; i < vm.fiber.stackIdx; i++ {
+				fmt.Printf("[ %s ]", vm.format(vm.fiber.stack[i]))
 			}
 			fmt.Printf("\n")
-			disassembleInstruction(vm.chunk, vm.ip)
+			vm.disassembleInstruction(frame.function.chunk, frame.ip)
 		}
 
-		instruction := OpCode(readByte(vm.chunk.code, &vm.ip))
+		instruction := OpCode(readByte(code, &frame.ip))
 
 		switch instruction {
 		case OP_CONSTANT:
-			constantIndex := readByte(vm.chunk.code, &vm.ip)
-			if constantIndex >= uint8(len(vm.chunk.constants)) {
-				return ErrInterpretError
-			}
-			constant := vm.chunk.constants[constantIndex]
-			vm.push(constant)
+			vm.push(vm.readConstant(frame))
 		case OP_NIL:
 			vm.push(NilValue())
 		case OP_TRUE:
 			vm.push(BoolValue(true))
 		case OP_FALSE:
 			vm.push(BoolValue(false))
+		case OP_POP:
+			vm.pop()
+		case OP_GET_LOCAL:
+			slot := int(readByte(code, &frame.ip))
+			vm.push(vm.fiber.stack[frame.slots+slot])
+		case OP_SET_LOCAL:
+			slot := int(readByte(code, &frame.ip))
+			vm.fiber.stack[frame.slots+slot] = vm.peek(0)
+		case OP_GET_GLOBAL:
+			name := vm.asString(vm.readConstant(frame))
+			value, ok := vm.globals[name]
+			if !ok {
+				vm.runtimeError("Undefined variable '%s'.", name)
+				return InterpretRuntimeError
+			}
+			vm.push(value)
+		case OP_DEFINE_GLOBAL:
+			name := vm.asString(vm.readConstant(frame))
+			vm.globals[name] = vm.peek(0)
+			vm.pop()
+		case OP_SET_GLOBAL:
+			name := vm.asString(vm.readConstant(frame))
+			if _, ok := vm.globals[name]; !ok {
+				vm.runtimeError("Undefined variable '%s'.", name)
+				return InterpretRuntimeError
+			}
+			vm.globals[name] = vm.peek(0)
+		case OP_GET_UPVALUE:
+			slot := readByte(code, &frame.ip)
+			vm.push(*vm.asUpvalue(frame.closure.upvalues[slot]).location)
+		case OP_SET_UPVALUE:
+			slot := readByte(code, &frame.ip)
+			*vm.asUpvalue(frame.closure.upvalues[slot]).location = vm.peek(0)
+		case OP_GET_PROPERTY:
+			name := vm.asString(vm.readConstant(frame))
+			cache := vm.readInlineCache(frame)
+			if !vm.getProperty(name, cache) {
+				return InterpretRuntimeError
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+		case OP_SET_PROPERTY:
+			name := vm.asString(vm.readConstant(frame))
+			cache := vm.readInlineCache(frame)
+			if !vm.setProperty(name, cache) {
+				return InterpretRuntimeError
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+		case OP_GET_SUPER:
+			name := vm.asString(vm.readConstant(frame))
+			cache := vm.readInlineCache(frame)
+			superclass := vm.pop().AsRef()
+			method := vm.findMethod(superclass, nil, name, cache)
+			if method.IsNil() {
+				vm.runtimeError("Undefined property '%s'.", name)
+				return InterpretRuntimeError
+			}
+			bound, ok := vm.newBoundMethod(vm.peek(0), method)
+			if !ok {
+				return InterpretRuntimeError
+			}
+			vm.fiber.stack[vm.fiber.stackIdx-1] = ObjValue(bound)
 		case OP_EQUAL:
+			if instance, ok := vm.instanceAt(1); ok && !vm.lookupMethod(instance.class, "__eq__").IsNil() {
+				if err := vm.operator("__eq__", 1); err != nil {
+					return err
+				}
+				frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+				break
+			}
 			b := vm.pop()
 			a := vm.pop()
 			vm.push(BoolValue(valuesEqual(a, b)))
+		case OP_INDEX:
+			if !vm.isObjType(vm.peek(1), OBJ_INSTANCE) {
+				vm.runtimeError("Only lists and maps can be indexed.")
+				return InterpretRuntimeError
+			}
+			if err := vm.operator("__index__", 1); err != nil {
+				return err
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
 		case OP_GREATER:
-			vm.binaryOp(greater)
+			if err := vm.binaryOp("__gt__", greater); err != nil {
+				return err
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
 		case OP_LESS:
-			vm.binaryOp(less)
+			if err := vm.binaryOp("__lt__", less); err != nil {
+				return err
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+		case OP_GREATER_EQUAL:
+			if err := vm.binaryOp("__ge__", greaterEqual); err != nil {
+				return err
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+		case OP_LESS_EQUAL:
+			if err := vm.binaryOp("__le__", lessEqual); err != nil {
+				return err
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
 		case OP_ADD:
-			vm.binaryOp(add)
+			if vm.isObjType(vm.peek(1), OBJ_INSTANCE) {
+				if err := vm.operator("__add__", 1); err != nil {
+					return err
+				}
+				frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+			} else if vm.isObjType(vm.peek(0), OBJ_STRING) && vm.isObjType(vm.peek(1), OBJ_STRING) {
+				// both operands stay on the stack until the result exists
+				result, ok := vm.newString(vm.asString(vm.peek(1)) + vm.asString(vm.peek(0)))
+				if !ok {
+					return InterpretRuntimeError
+				}
+				vm.pop()
+				vm.pop()
+				vm.push(ObjValue(result))
+			} else if vm.peek(0).IsNumber() && vm.peek(1).IsNumber() {
+				vm.binaryOp("__add__", add)
+			} else {
+				vm.runtimeError("Operands must be two numbers or two strings.")
+				return InterpretRuntimeError
+			}
 		case OP_SUBTRACT:
-			vm.binaryOp(subtract)
+			if err := vm.binaryOp("__sub__", subtract); err != nil {
+				return err
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
 		case OP_MULTIPLY:
-			vm.binaryOp(multiply)
+			if err := vm.binaryOp("__mul__", multiply); err != nil {
+				return err
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
 		case OP_DIVIDE:
-			vm.binaryOp(divide)
+			if err := vm.binaryOp("__div__", divide); err != nil {
+				return err
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+		case OP_FLOOR_DIVIDE:
+			if err := vm.binaryOp("__floordiv__", floorDivide); err != nil {
+				return err
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+		case OP_MODULO:
+			if err := vm.binaryOp("__mod__", modulo); err != nil {
+				return err
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+		case OP_POWER:
+			if err := vm.binaryOp("__pow__", power); err != nil {
+				return err
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+		case OP_BIT_AND:
+			if err := vm.bitwiseOp("__and__", loxtoken.AMPERSAND); err != nil {
+				return err
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+		case OP_BIT_OR:
+			if err := vm.bitwiseOp("__or__", loxtoken.PIPE); err != nil {
+				return err
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+		case OP_BIT_XOR:
+			if err := vm.bitwiseOp("__xor__", loxtoken.CARET); err != nil {
+				return err
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+		case OP_SHIFT_LEFT:
+			if err := vm.bitwiseOp("__lshift__", loxtoken.LESS_LESS); err != nil {
+				return err
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+		case OP_SHIFT_RIGHT:
+			if err := vm.bitwiseOp("__rshift__", loxtoken.GREATER_GREATER); err != nil {
+				return err
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
 		case OP_NOT:
 			vm.push(isFalsy(vm.pop()))
 		case OP_NEGATE:
@@ -107,9 +402,164 @@ func (vm *VM) run() error {
 				return InterpretRuntimeError
 			}
 			vm.push(NumberValue(-(vm.pop().AsNumber())))
+		case OP_BIT_NOT:
+			if !vm.peek(0).IsNumber() {
+				vm.runtimeError("Operand must be a number.")
+				return InterpretRuntimeError
+			}
+			result, err := ast.Complement(vm.peek(0).AsNumber())
+			if err != nil {
+				vm.runtimeError("%s", err.Error())
+				return InterpretRuntimeError
+			}
+			vm.pop()
+			vm.push(NumberValue(result))
+		case OP_PRINT:
+			if called, err := vm.callStr(frame); err != nil {
+				return err
+			} else if called {
+				frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+				break
+			}
+			fmt.Fprintf(vm.out, "%s\n", vm.format(vm.pop()))
+		case OP_TO_STRING:
+			if called, err := vm.callStr(frame); err != nil {
+				return err
+			} else if called {
+				frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+				break
+			}
+			if !vm.isObjType(vm.peek(0), OBJ_STRING) {
+				// the value stays on the stack until its string exists
+				str, ok := vm.newString(vm.format(vm.peek(0)))
+				if !ok {
+					return InterpretRuntimeError
+				}
+				vm.fiber.stack[vm.fiber.stackIdx-1] = ObjValue(str)
+			}
+		case OP_JUMP:
+			offset := readShort(code, &frame.ip)
+			frame.ip += int(offset)
+		case OP_JUMP_IF_FALSE:
+			offset := readShort(code, &frame.ip)
+			if isFalsy(vm.peek(0)).AsBool() {
+				frame.ip += int(offset)
+			}
+		case OP_LOOP:
+			offset := readShort(code, &frame.ip)
+			if vm.interrupted() {
+				return InterpretRuntimeError
+			}
+			frame.ip -= int(offset)
+		case OP_CALL:
+			argCount := int(readByte(code, &frame.ip))
+			if !vm.callValue(vm.peek(argCount), argCount) {
+				return InterpretRuntimeError
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+		case OP_INVOKE:
+			name := vm.asString(vm.readConstant(frame))
+			argCount := int(readByte(code, &frame.ip))
+			cache := vm.readInlineCache(frame)
+			if !vm.invoke(name, argCount, cache) {
+				return InterpretRuntimeError
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+		case OP_SUPER_INVOKE:
+			name := vm.asString(vm.readConstant(frame))
+			argCount := int(readByte(code, &frame.ip))
+			cache := vm.readInlineCache(frame)
+			superclass := vm.pop().AsRef()
+			method := vm.findMethod(superclass, nil, name, cache)
+			if method.IsNil() {
+				vm.runtimeError("Undefined property '%s'.", name)
+				return InterpretRuntimeError
+			}
+			if !vm.call(method, argCount) {
+				return InterpretRuntimeError
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+		case OP_CLOSURE:
+			ref, ok := vm.newClosure(vm.readConstant(frame).AsRef())
+			if !ok {
+				return InterpretRuntimeError
+			}
+			vm.push(ObjValue(ref))
+			closure := vm.asClosure(ref)
+			for i := range closure.upvalues {
+				isLocal := readByte(code, &frame.ip)
+				index := int(readByte(code, &frame.ip))
+				if isLocal == 1 {
+					closure.upvalues[i], ok = vm.captureUpvalue(frame.slots + index)
+					if !ok {
+						return InterpretRuntimeError
+					}
+				} else {
+					closure.upvalues[i] = frame.closure.upvalues[index]
+				}
+			}
+		case OP_CLOSE_UPVALUE:
+			vm.closeUpvalues(vm.fiber.stackIdx - 1)
+			vm.pop()
 		case OP_RETURN:
-			fmt.Printf("%s\n", vm.pop())
-			return nil
+			result := vm.pop()
+			vm.closeUpvalues(frame.slots)
+			vm.fiber.frameCount--
+			if vm.fiber.frameCount == 0 {
+				vm.pop()
+				if vm.fiber.caller.IsNil() {
+					vm.push(result)
+					return nil
+				}
+				vm.finishFiber(result)
+				frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+				break
+			}
+
+			vm.fiber.stackIdx = frame.slots
+			if frame.callResult {
+				vm.fiber.stack[vm.fiber.stackIdx-frame.callArgs-1] = result
+				if !vm.callValue(result, frame.callArgs) {
+					return InterpretRuntimeError
+				}
+			} else if !frame.discardResult {
+				vm.push(result)
+			}
+			frame = &vm.fiber.frames[vm.fiber.frameCount-1]
+		case OP_CLASS:
+			class, ok := vm.newClass(vm.asString(vm.readConstant(frame)))
+			if !ok {
+				return InterpretRuntimeError
+			}
+			vm.push(ObjValue(class))
+		case OP_INHERIT:
+			if !vm.isObjType(vm.peek(1), OBJ_CLASS) {
+				vm.runtimeError("Superclass must be a class.")
+				return InterpretRuntimeError
+			}
+			subclass := vm.asClass(vm.peek(0).AsRef())
+			subclass.superclass = vm.peek(1).AsRef()
+			vm.classEpoch++
+			vm.pop()
+		case OP_METHOD:
+			name := vm.asString(vm.readConstant(frame))
+			class := vm.asClass(vm.peek(1).AsRef())
+			class.methods[name] = vm.peek(0).AsRef()
+			vm.classEpoch++
+			vm.pop()
+		case OP_CLASS_METHOD, OP_GETTER, OP_SETTER:
+			name := vm.asString(vm.readConstant(frame))
+			class := vm.asClass(vm.peek(1).AsRef())
+			table := class.statics
+			switch instruction {
+			case OP_GETTER:
+				table = class.getters
+			case OP_SETTER:
+				table = class.setters
+			}
+			table[name] = vm.peek(0).AsRef()
+			vm.classEpoch++
+			vm.pop()
 		default:
 			return ErrInterpretError
 		}
@@ -125,30 +575,468 @@ func readByte(code []byte, ip *int) byte {
 	return b
 }
 
+func readShort(code []byte, ip *int) uint16 {
+	high := uint16(readByte(code, ip))
+	low := uint16(readByte(code, ip))
+	return high<<8 | low
+}
+
+func (vm *VM) readConstant(frame *CallFrame) Value {
+	constantIndex := readByte(frame.function.chunk.code, &frame.ip)
+	return frame.function.chunk.constants[constantIndex]
+}
+
+func (vm *VM) readInlineCache(frame *CallFrame) *inlineCache {
+	index := readShort(frame.function.chunk.code, &frame.ip)
+	return &frame.function.chunk.caches[index]
+}
+
 func (vm *VM) push(value Value) {
-	if vm.stackIdx >= StackMax {
-		panic("Stack overflow")
+	if vm.fiber.stackIdx == len(vm.fiber.stack) {
+		vm.growStack()
 	}
-	vm.stack[vm.stackIdx] = value
-	vm.stackIdx++
+	vm.fiber.stack[vm.fiber.stackIdx] = value
+	vm.fiber.stackIdx++
 }
 
 func (vm *VM) pop() Value {
-	if vm.stackIdx == 0 {
+	if vm.fiber.stackIdx == 0 {
 		panic("Stack underflow")
 	}
-	vm.stackIdx--
-	return vm.stack[vm.stackIdx]
+	vm.fiber.stackIdx--
+	return vm.fiber.stack[vm.fiber.stackIdx]
 }
 
 func (vm *VM) peek(distance int) Value {
-	if vm.stackIdx == 0 {
+	if vm.fiber.stackIdx == 0 {
 		panic("Stack underflow")
 	}
-	return vm.stack[vm.stackIdx-1-distance]
+	return vm.fiber.stack[vm.fiber.stackIdx-1-distance]
+}
+
+func (vm *VM) callValue(callee Value, argCount int) bool {
+	if callee.IsObj() {
+		switch obj := vm.deref(callee.AsRef()).(type) {
+		case *ObjClosure:
+			return vm.call(callee.AsRef(), argCount)
+		case *ObjBoundMethod:
+			vm.fiber.stack[vm.fiber.stackIdx-argCount-1] = obj.receiver
+			return vm.call(obj.method, argCount)
+		case *ObjClass:
+			// the class stays in its stack slot until the instance replaces it
+			instance, ok := vm.newInstance(callee.AsRef())
+			if !ok {
+				return false
+			}
+			vm.fiber.stack[vm.fiber.stackIdx-argCount-1] = ObjValue(instance)
+			if initializer := vm.lookupMethod(callee.AsRef(), "init"); !initializer.IsNil() {
+				return vm.call(initializer, argCount)
+			} else if argCount != 0 {
+				vm.runtimeError("Expected 0 arguments but got %d.", argCount)
+				return false
+			}
+			return true
+		case *ObjNative:
+			if obj.primitive != nil {
+				return obj.primitive(vm, argCount)
+			}
+			if obj.host != nil {
+				return vm.callHost(obj.host, argCount)
+			}
+			if argCount != obj.arity {
+				vm.runtimeError("Expected %d arguments but got %d.", obj.arity, argCount)
+				return false
+			}
+			result := obj.function(vm.fiber.stack[vm.fiber.stackIdx-argCount : vm.fiber.stackIdx])
+			vm.fiber.stackIdx -= argCount + 1
+			vm.push(result)
+			return true
+		}
+	}
+
+	vm.runtimeError("Can only call functions and classes.")
+	return false
+}
+
+func (vm *VM) call(ref ObjRef, argCount int) bool {
+	if vm.interrupted() {
+		return false
+	}
+	closure := vm.asClosure(ref)
+	function := vm.asFunction(closure.function)
+	if argCount != function.arity {
+		vm.runtimeError("Expected %d arguments but got %d.", function.arity, argCount)
+		return false
+	}
+
+	if vm.fiber.frameCount == FramesMax {
+		vm.runtimeError("Stack overflow.")
+		return false
+	}
+
+	frame := &vm.fiber.frames[vm.fiber.frameCount]
+	vm.fiber.frameCount++
+	frame.closureRef = ref
+	frame.closure = closure
+	frame.function = function
+	frame.ip = 0
+	frame.slots = vm.fiber.stackIdx - argCount - 1
+	frame.strCalled = false
+	frame.discardResult = false
+	frame.callResult = false
+	return true
+}
+
+// instanceAt returns the instance distance slots down the stack, if there is
+// one.
+func (vm *VM) instanceAt(distance int) (*ObjInstance, bool) {
+	value := vm.peek(distance)
+	if !vm.isObjType(value, OBJ_INSTANCE) {
+		return nil, false
+	}
+	return vm.deref(value.AsRef()).(*ObjInstance), true
+}
+
+// getProperty replaces the instance on top of the stack with the value of
+// its field, what its getter returns, or a method bound to it. A class is
+// replaced with one of its class methods bound to it.
+func (vm *VM) getProperty(name string, cache *inlineCache) bool {
+	if vm.isObjType(vm.peek(0), OBJ_CLASS) {
+		method := vm.lookup(vm.peek(0).AsRef(), name, statics)
+		if method.IsNil() {
+			vm.runtimeError("Undefined property '%s'.", name)
+			return false
+		}
+		bound, ok := vm.newBoundMethod(vm.peek(0), method)
+		if !ok {
+			return false
+		}
+		vm.fiber.stack[vm.fiber.stackIdx-1] = ObjValue(bound)
+		return true
+	}
+
+	instance, ok := vm.instanceAt(0)
+	if !ok {
+		vm.runtimeError("Only instances have properties.")
+		return false
+	}
+
+	if inlineCaching {
+		if slot, ok := cache.fieldHit(instance); ok {
+			vm.fiber.stack[vm.fiber.stackIdx-1] = instance.fields[slot]
+			return true
+		}
+	}
+	if slot, ok := instance.shape.slots[name]; ok {
+		cache.fillField(instance.shape, slot)
+		vm.fiber.stack[vm.fiber.stackIdx-1] = instance.fields[slot]
+		return true
+	}
+	if getter := vm.lookup(instance.class, name, getters); !getter.IsNil() {
+		return vm.call(getter, 0)
+	}
+
+	method := vm.findMethod(instance.class, instance.shape, name, cache)
+	if method.IsNil() {
+		vm.runtimeError("Undefined property '%s'.", name)
+		return false
+	}
+	bound, ok := vm.newBoundMethod(vm.peek(0), method)
+	if !ok {
+		return false
+	}
+	vm.fiber.stack[vm.fiber.stackIdx-1] = ObjValue(bound)
+	return true
+}
+
+// setProperty assigns the value on top of the stack to the instance's field
+// or passes it to the instance's setter, leaving the value in place of both.
+func (vm *VM) setProperty(name string, cache *inlineCache) bool {
+	instance, ok := vm.instanceAt(1)
+	if !ok {
+		vm.runtimeError("Only instances have fields.")
+		return false
+	}
+	ref := vm.peek(1).AsRef()
+	value := vm.peek(0)
+
+	// a site only caches shapes whose class has no setter for name
+	hit := inlineCaching && cache.shape == instance.shape && cache.slot >= 0
+	if !hit {
+		if setter := vm.lookup(instance.class, name, setters); !setter.IsNil() {
+			// leave the value under the setter's frame as the result
+			vm.push(value)
+			vm.fiber.stack[vm.fiber.stackIdx-3] = value
+			vm.fiber.stack[vm.fiber.stackIdx-2] = ObjValue(ref)
+			if !vm.call(setter, 1) {
+				return false
+			}
+			vm.fiber.frames[vm.fiber.frameCount-1].discardResult = true
+			return true
+		}
+	}
+
+	if hit {
+		if cache.next == nil {
+			instance.fields[cache.slot] = value
+		} else {
+			if !vm.growObject(ref, heap.FieldSize) {
+				return false
+			}
+			instance.fields = append(instance.fields, value)
+			instance.shape = cache.next
+		}
+	} else if slot, ok := instance.shape.slots[name]; ok {
+		instance.fields[slot] = value
+		cache.fillField(instance.shape, slot)
+	} else {
+		if !vm.growObject(ref, heap.FieldSize) {
+			return false
+		}
+		before := instance.shape
+		instance.setField(name, value)
+		cache.fillTransition(before, instance.shape, len(instance.fields)-1)
+	}
+
+	vm.pop()
+	vm.pop()
+	vm.push(value)
+	return true
+}
+
+// invoke calls the method name on the receiver below the arguments without
+// creating a bound method. A field holding a function shadows the method,
+// and so does what a getter returns. A class receiver calls a class method.
+func (vm *VM) invoke(name string, argCount int, cache *inlineCache) bool {
+	switch receiver := vm.peek(argCount); {
+	case vm.isObjType(receiver, OBJ_CLASS):
+		method := vm.lookup(receiver.AsRef(), name, statics)
+		if method.IsNil() {
+			vm.runtimeError("Undefined property '%s'.", name)
+			return false
+		}
+		return vm.call(method, argCount)
+	case vm.isObjType(receiver, OBJ_FIBER):
+		return vm.invokeFiber(name, argCount)
+	case vm.isObjType(receiver, OBJ_STRING):
+		return vm.invokeString(name, argCount)
+	case vm.isObjType(receiver, OBJ_ITERATOR):
+		return vm.invokeIterator(name, argCount)
+	}
+
+	instance, ok := vm.instanceAt(argCount)
+	if !ok {
+		vm.runtimeError("Only instances have methods.")
+		return false
+	}
+
+	if inlineCaching {
+		if method, ok := cache.methodHit(instance.shape, ObjRef{}, vm.classEpoch); ok {
+			return vm.call(method, argCount)
+		}
+	}
+	if slot, ok := instance.shape.slots[name]; ok {
+		value := instance.fields[slot]
+		vm.fiber.stack[vm.fiber.stackIdx-argCount-1] = value
+		return vm.callValue(value, argCount)
+	}
+	if getter := vm.lookup(instance.class, name, getters); !getter.IsNil() {
+		vm.push(vm.peek(argCount))
+		if !vm.call(getter, 0) {
+			return false
+		}
+		frame := &vm.fiber.frames[vm.fiber.frameCount-1]
+		frame.callResult = true
+		frame.callArgs = argCount
+		return true
+	}
+
+	method := vm.findMethod(instance.class, instance.shape, name, cache)
+	if method.IsNil() {
+		vm.runtimeError("Undefined property '%s'.", name)
+		return false
+	}
+	return vm.call(method, argCount)
+}
+
+// findMethod looks name up on class and its superclasses, consulting and
+// filling the call site's cache. Lookups through an instance are keyed on
+// the instance's shape, super lookups on the class alone.
+func (vm *VM) findMethod(class ObjRef, shape *shape, name string, cache *inlineCache) ObjRef {
+	key := class
+	if shape != nil {
+		key = ObjRef{}
+	}
+
+	if inlineCaching {
+		if method, ok := cache.methodHit(shape, key, vm.classEpoch); ok {
+			return method
+		}
+	}
+
+	method := vm.lookupMethod(class, name)
+	if !method.IsNil() {
+		cache.fillMethod(shape, key, vm.classEpoch, method)
+	}
+	return method
+}
+
+// lookup finds name in the table of class or of its nearest superclass that
+// has it.
+func (vm *VM) lookup(class ObjRef, name string, table func(*ObjClass) map[string]ObjRef) ObjRef {
+	for !class.IsNil() {
+		obj := vm.asClass(class)
+		if method, ok := table(obj)[name]; ok {
+			return method
+		}
+		class = obj.superclass
+	}
+	return ObjRef{}
+}
+
+func (vm *VM) lookupMethod(class ObjRef, name string) ObjRef {
+	return vm.lookup(class, name, methods)
+}
+
+func methods(c *ObjClass) map[string]ObjRef { return c.methods }
+func statics(c *ObjClass) map[string]ObjRef { return c.statics }
+func getters(c *ObjClass) map[string]ObjRef { return c.getters }
+func setters(c *ObjClass) map[string]ObjRef { return c.setters }
+
+// captureUpvalue reuses an open upvalue for slot if one exists.
+func (vm *VM) captureUpvalue(slot int) (ObjRef, bool) {
+	i := len(vm.fiber.openUpvalues)
+	for i > 0 && vm.asUpvalue(vm.fiber.openUpvalues[i-1]).slot > slot {
+		i--
+	}
+	if i > 0 && vm.asUpvalue(vm.fiber.openUpvalues[i-1]).slot == slot {
+		return vm.fiber.openUpvalues[i-1], true
+	}
+
+	created, ok := vm.newObject(&ObjUpvalue{location: &vm.fiber.stack[slot], slot: slot}, heap.Environment, heap.EnvironmentSize)
+	if !ok {
+		return ObjRef{}, false
+	}
+	vm.fiber.openUpvalues = append(vm.fiber.openUpvalues, ObjRef{})
+	copy(vm.fiber.openUpvalues[i+1:], vm.fiber.openUpvalues[i:])
+	vm.fiber.openUpvalues[i] = created
+	return created, true
+}
+
+func (vm *VM) closeUpvalues(lastSlot int) {
+	for len(vm.fiber.openUpvalues) > 0 {
+		last := len(vm.fiber.openUpvalues) - 1
+		upvalue := vm.asUpvalue(vm.fiber.openUpvalues[last])
+		if upvalue.slot < lastSlot {
+			break
+		}
+		upvalue.closed = *upvalue.location
+		upvalue.location = &upvalue.closed
+		vm.fiber.openUpvalues = vm.fiber.openUpvalues[:last]
+	}
+}
+
+func (vm *VM) defineNative(name string, arity int, function NativeFn) {
+	native, err := vm.allocate(&ObjNative{name: name, arity: arity, function: function}, heap.Function, heap.FunctionSize)
+	if err != nil {
+		panic(err)
+	}
+	vm.globals[name] = ObjValue(native)
+}
+
+// newObject allocates obj, reporting a runtime error if the heap is full.
+func (vm *VM) newObject(obj Obj, kind heap.Kind, size int) (ObjRef, bool) {
+	ref, err := vm.allocate(obj, kind, size)
+	if err != nil {
+		vm.runtimeError("%s", err)
+		return ObjRef{}, false
+	}
+	return ref, true
+}
+
+func (vm *VM) newString(chars string) (ObjRef, bool) {
+	ref, err := vm.copyString(chars)
+	if err != nil {
+		vm.runtimeError("%s", err)
+		return ObjRef{}, false
+	}
+	return ref, true
+}
+
+func (vm *VM) newClosure(function ObjRef) (ObjRef, bool) {
+	upvalueCount := vm.asFunction(function).upvalueCount
+	closure := &ObjClosure{function: function, upvalues: make([]ObjRef, upvalueCount)}
+	return vm.newObject(closure, heap.Closure, heap.ClosureSize+heap.UpvalueSize*upvalueCount)
+}
+
+func (vm *VM) newClass(name string) (ObjRef, bool) {
+	class := &ObjClass{
+		name:    name,
+		methods: make(map[string]ObjRef),
+		statics: make(map[string]ObjRef),
+		getters: make(map[string]ObjRef),
+		setters: make(map[string]ObjRef),
+		root:    newShape(),
+	}
+	return vm.newObject(class, heap.Class, heap.ClassSize)
+}
+
+func (vm *VM) newInstance(class ObjRef) (ObjRef, bool) {
+	instance := &ObjInstance{class: class, shape: vm.asClass(class).root}
+	return vm.newObject(instance, heap.Instance, heap.InstanceSize)
+}
+
+func (vm *VM) newBoundMethod(receiver Value, method ObjRef) (ObjRef, bool) {
+	return vm.newObject(&ObjBoundMethod{receiver: receiver, method: method}, heap.Closure, heap.ClosureSize)
+}
+
+func (vm *VM) growObject(ref ObjRef, size int) bool {
+	if err := vm.grow(ref, size); err != nil {
+		vm.runtimeError("%s", err)
+		return false
+	}
+	return true
+}
+
+// format renders value the way print shows it. A nil VM has no heap, so
+// objects are shown by handle.
+func (vm *VM) format(value Value) string {
+	if vm == nil || !value.IsObj() {
+		return value.String()
+	}
+
+	switch obj := vm.deref(value.AsRef()).(type) {
+	case *ObjString:
+		return obj.chars
+	case *ObjFunction:
+		return obj.String()
+	case *ObjNative:
+		return "<native fn>"
+	case *ObjClosure:
+		return vm.asFunction(obj.function).String()
+	case *ObjUpvalue:
+		return "upvalue"
+	case *ObjClass:
+		return obj.name
+	case *ObjInstance:
+		return vm.asClass(obj.class).name + " instance"
+	case *ObjBoundMethod:
+		return vm.format(ObjValue(vm.asClosure(obj.method).function))
+	case *ObjFiber:
+		return "<fiber>"
+	case *ObjIterator:
+		return "<iterator>"
+	default:
+		return value.String()
+	}
 }
 
-func (vm *VM) binaryOp(op func(a, b float64) Value) error {
+// binaryOp applies op to the two numbers on top of the stack, or calls
+// method if the left operand is an instance.
+func (vm *VM) binaryOp(method string, op func(a, b float64) Value) error {
+	if vm.isObjType(vm.peek(1), OBJ_INSTANCE) {
+		return vm.operator(method, 1)
+	}
 	if !vm.peek(0).IsNumber() || !vm.peek(1).IsNumber() {
 		vm.runtimeError("Operands must be numbers.")
 		return InterpretRuntimeError
@@ -159,15 +1047,115 @@ func (vm *VM) binaryOp(op func(a, b float64) Value) error {
 	return nil
 }
 
+// bitwiseOp is binaryOp for the bitwise operators, which also fail on
+// numbers that aren't integers.
+func (vm *VM) bitwiseOp(method string, operator loxtoken.TokenType) error {
+	if vm.isObjType(vm.peek(1), OBJ_INSTANCE) {
+		return vm.operator(method, 1)
+	}
+	if !vm.peek(0).IsNumber() || !vm.peek(1).IsNumber() {
+		vm.runtimeError("Operands must be numbers.")
+		return InterpretRuntimeError
+	}
+	result, err := ast.Bitwise(operator, vm.peek(1).AsNumber(), vm.peek(0).AsNumber())
+	if err != nil {
+		vm.runtimeError("%s", err.Error())
+		return InterpretRuntimeError
+	}
+	vm.pop()
+	vm.pop()
+	vm.push(NumberValue(result))
+	return nil
+}
+
+// callStr calls the __str__ method of the instance on top of the stack, if
+// it is one with such a method, so that the current instruction in frame
+// runs again on what __str__ returns. When it does, callStr checks that
+// __str__ returned a string.
+func (vm *VM) callStr(frame *CallFrame) (bool, error) {
+	if frame.strCalled {
+		frame.strCalled = false
+		if !vm.isObjType(vm.peek(0), OBJ_STRING) {
+			vm.runtimeError("%s", ast.StrNotString)
+			return false, InterpretRuntimeError
+		}
+		return false, nil
+	}
+
+	instance, ok := vm.instanceAt(0)
+	if !ok {
+		return false, nil
+	}
+	method := vm.lookupMethod(instance.class, "__str__")
+	if method.IsNil() {
+		return false, nil
+	}
+	frame.ip--
+	frame.strCalled = true
+	if !vm.call(method, 0) {
+		return false, InterpretRuntimeError
+	}
+	return true, nil
+}
+
+// operator calls the method overloading an operator on the instance
+// argCount slots below the top of the stack, which stays where it is as the
+// receiver, with the operands above it as the arguments.
+func (vm *VM) operator(method string, argCount int) error {
+	instance, _ := vm.instanceAt(argCount)
+	ref := vm.lookupMethod(instance.class, method)
+	if ref.IsNil() {
+		vm.runtimeError("Undefined operator method '%s'.", method)
+		return InterpretRuntimeError
+	}
+	if !vm.call(ref, argCount) {
+		return InterpretRuntimeError
+	}
+	return nil
+}
+
+// interrupted reports a runtime error if the interrupt channel has been
+// closed.
+func (vm *VM) interrupted() bool {
+	select {
+	case <-vm.interrupt:
+		vm.runtimeError("Interrupted.")
+		return true
+	default:
+		return false
+	}
+}
+
 func (vm *VM) runtimeError(format string, args ...any) {
-	fmt.Fprintf(os.Stderr, format, args...)
-	fmt.Fprintf(os.Stderr, "\n")
+	fmt.Fprintf(vm.errOut, format, args...)
+	fmt.Fprintf(vm.errOut, "\n")
+
+	// the error unwinds through every fiber waiting on the failed one
+	for fiber := vm.fiber; fiber != nil; {
+		for i := fiber.frameCount - 1; i >= 0; i-- {
+			frame := &fiber.frames[i]
+			function := frame.function
+			line := function.chunk.lines[frame.ip-1]
+			if function.name == "" {
+				fmt.Fprintf(vm.errOut, "[line %d] in script\n", line)
+			} else {
+				fmt.Fprintf(vm.errOut, "[line %d] in %s()\n", line, function.name)
+			}
+		}
 
-	line := vm.chunk.lines[vm.ip-1]
-	fmt.Fprintf(os.Stderr, "[line %d] in script\n", line)
+		fiber.state = FIBER_DONE
+		if fiber.caller.IsNil() {
+			break
+		}
+		fiber = vm.deref(fiber.caller).(*ObjFiber)
+	}
 	vm.resetStack()
 }
 
+func clockNative(args []Value) Value {
+	return NumberValue(float64(time.Now().Unix()))
+}
+
 func isFalsy(value Value) Value {
 	if value.IsNil() {
 		return BoolValue(true)
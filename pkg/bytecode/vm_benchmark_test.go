@@ -0,0 +1,93 @@
+package bytecode
+
+import (
+	"io"
+	"testing"
+)
+
+func BenchmarkMethodCalls(b *testing.B) {
+	benchmarkInlineCaching(b, zooProgram)
+}
+
+func BenchmarkFieldAccess(b *testing.B) {
+	benchmarkInlineCaching(b, fieldProgram)
+}
+
+func benchmarkInlineCaching(b *testing.B, program string) {
+	for _, enabled := range []bool{true, false} {
+		name := "uncached"
+		if enabled {
+			name = "cached"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			defer func(previous bool) {
+				inlineCaching = previous
+			}(inlineCaching)
+			inlineCaching = enabled
+
+			for i := 0; i < b.N; i++ {
+				vm := NewVM()
+				vm.out = io.Discard
+				if err := vm.Interpret(program); err != nil {
+					b.Fatalf("Interpret failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+const zooProgram = `
+class Animal {
+  init() {
+    this.aardvark = 1;
+    this.baboon   = 1;
+    this.cat      = 1;
+  }
+  ant()    { return this.aardvark; }
+  banana() { return this.baboon; }
+  tuna()   { return this.cat; }
+}
+
+class Zoo < Animal {
+  init() {
+    super.init();
+    this.donkey   = 1;
+    this.elephant = 1;
+    this.fox      = 1;
+  }
+  hay()    { return this.donkey; }
+  grass()  { return this.elephant; }
+  mouse()  { return this.fox; }
+}
+
+var zoo = Zoo();
+var sum = 0;
+while (sum < 100000) {
+  sum = sum + zoo.ant()
+            + zoo.banana()
+            + zoo.tuna()
+            + zoo.hay()
+            + zoo.grass()
+            + zoo.mouse();
+}
+
+print sum;
+`
+
+const fieldProgram = `
+class Point {
+  init(x, y) {
+    this.x = x;
+    this.y = y;
+  }
+}
+
+var point = Point(0, 0);
+for (var i = 0; i < 50000; i = i + 1) {
+  point.x = point.x + point.y;
+  point.y = point.y + 1;
+}
+
+print point.x;
+`
@@ -0,0 +1,476 @@
+package bytecode
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func interpret(t *testing.T, source string) (string, error) {
+	t.Helper()
+	var out strings.Builder
+	vm := NewVM()
+	vm.out = &out
+	defer vm.Free()
+
+	err := vm.Interpret(source)
+	return out.String(), err
+}
+
+var interpretTests = []struct {
+	name     string
+	source   string
+	expected string
+}{
+	{
+		name:     "arithmetic",
+		source:   `print 1 + 2 * 3; print (1 + 2) * 3; print -4 / 2;`,
+		expected: "7\n9\n-2\n",
+	},
+	{
+		name:     "strings",
+		source:   `print "tacos" + " and " + "waffles"; print "a" == "a"; print "a" != "b";`,
+		expected: "tacos and waffles\ntrue\ntrue\n",
+	},
+	{
+		name:     "globals",
+		source:   `var a = 1; var b; a = a + 1; print a; print b;`,
+		expected: "2\nnil\n",
+	},
+	{
+		name:     "locals shadow globals",
+		source:   `var a = "global"; { var a = "local"; print a; } print a;`,
+		expected: "local\nglobal\n",
+	},
+	{
+		name:     "if else",
+		source:   `if (1 < 2) print "then"; else print "else"; if (nil) print "then"; else print "else";`,
+		expected: "then\nelse\n",
+	},
+	{
+		name:     "logical operators",
+		source:   `print nil or "right"; print "left" or "right"; print nil and "right"; print 1 and 2;`,
+		expected: "right\nleft\nnil\n2\n",
+	},
+	{
+		name:     "for loop",
+		source:   `for (var i = 0; i < 3; i = i + 1) print i;`,
+		expected: "0\n1\n2\n",
+	},
+	{
+		name: "recursion",
+		source: `fun fib(n) { if (n < 2) return n; return fib(n - 1) + fib(n - 2); }
+print fib(15);`,
+		expected: "610\n",
+	},
+	{
+		name: "closures",
+		source: `fun makeCounter() {
+  var i = 0;
+  fun count() {
+    i = i + 1;
+    print i;
+  }
+  return count;
+}
+var counter = makeCounter();
+counter();
+counter();`,
+		expected: "1\n2\n",
+	},
+	{
+		name: "lambdas",
+		source: `fun twice(f, x) { return f(f(x)); }
+var n = 3;
+print twice(fun (x) { return x * n; }, 2);
+fun (s) { print s; }("called at once");
+print fun () {};`,
+		expected: "18\ncalled at once\n<fn anonymous@line 5>\n",
+	},
+	{
+		name: "operator methods",
+		source: `class Money {
+  init(cents) { this.cents = cents; }
+  __add__(other) { return Money(this.cents + other.cents); }
+  __mul__(n) { return Money(this.cents * n); }
+  __lt__(other) { return this.cents < other.cents; }
+  __ge__(other) { return this.cents >= other.cents; }
+  __str__() { return "$" + str(this.cents / 100); }
+}
+var m = Money(150) + Money(50);
+print m;
+print m * 3;
+print m < Money(100);
+print m >= Money(100);`,
+		expected: "$2\n$6\nfalse\ntrue\n",
+	},
+	{
+		name: "__index__",
+		source: `class Squares {
+  __index__(i) { return i * i; }
+}
+var s = Squares();
+print s[3];
+print s[s[2]] + 1;`,
+		expected: "9\n17\n",
+	},
+	{
+		name: "for-in over the iterator protocol",
+		source: `class Countdown {
+  init(n) { this.n = n; }
+  iterator() { return this; }
+  hasNext() { return this.n > 0; }
+  next() { this.n = this.n - 1; return this.n + 1; }
+}
+for (var i in Countdown(3)) print i;`,
+		expected: "3\n2\n1\n",
+	},
+	{
+		name: "for-in over a string",
+		source: `for (var c in "héy") print c;
+for (var c in "") print "never";
+var it = "ab".iterator();
+print it.next() + it.next();
+print it.hasNext();
+print it;`,
+		expected: "h\né\ny\nab\nfalse\n<iterator>\n",
+	},
+	{
+		name: "string interpolation",
+		source: `class Cake { __str__() { return "cake"; } }
+var n = 2;
+print "${n} slices of ${Cake()}, ${n > 1} ${nil} ${"in${"ner"}"}";
+print "${n}" == "2";`,
+		expected: "2 slices of cake, true nil inner\ntrue\n",
+	},
+	{
+		name: "numeric operators and literals",
+		source: `print 7 % 3;
+print -7 % 3;
+print 7.5 % 2;
+print 7 // 2;
+print -7 // 2;
+print 2 ** 10;
+print 2 ** 3 ** 2;
+print -2 ** 2;
+print 2 ** -1;
+print 6 & 3;
+print 6 | 3;
+print 6 ^ 3;
+print ~5;
+print 1 << 10;
+print -16 >> 2;
+print 1 + 2 * 3 % 4;
+print 1 | 2 ^ 3 & 4 << 1;
+print 5 & 1 == 1;
+print 0xFF + 0b101 + 1_000;
+var half = (9 + 1) // 2; # a comment
+print half;`,
+		expected: "1\n2\n1.5\n3\n-4\n1024\n512\n-4\n0.5\n2\n7\n5\n-6\n1024\n-4\n3\n3\ntrue\n1260\n5\n",
+	},
+	{
+		name: "comments after operands",
+		source: `var x = 2;
+if (x > 1) # after a paren
+  print x;
+var y = x # after an identifier
+  + 1;
+print y + 3 # after a number
+;`,
+		expected: "2\n6\n",
+	},
+	{
+		name: "overloaded numeric operators",
+		source: `class Mod {
+  init(n) { this.n = n; }
+  __mod__(m) { return Mod(this.n % m); }
+  __lshift__(m) { return "shifted"; }
+}
+print (Mod(7) % 4).n;
+print Mod(1) << 2;`,
+		expected: "3\nshifted\n",
+	},
+	{
+		name: "string escapes",
+		source: `print "a\tb \"c\" \\ \${d} \u{e9}";
+print r"\n${d}";`,
+		expected: "a\tb \"c\" \\ ${d} \u00e9\n\\n${d}\n",
+	},
+	{
+		name: "closed upvalues are shared",
+		source: `var get;
+var set;
+{
+  var a = "before";
+  fun getter() { return a; }
+  fun setter(value) { a = value; }
+  get = getter;
+  set = setter;
+}
+set("after");
+print get();`,
+		expected: "after\n",
+	},
+	{
+		name:     "function values",
+		source:   `fun f() {} print f; print f(); print clock;`,
+		expected: "<fn f>\nnil\n<native fn>\n",
+	},
+	{
+		name: "classes",
+		source: `class Cake {
+  init(flavor) { this.flavor = flavor; }
+  taste() { return "The " + this.flavor + " cake is delicious!"; }
+}
+var cake = Cake("chocolate");
+print cake;
+print Cake;
+print cake.taste();
+var taste = cake.taste;
+print taste();`,
+		expected: "Cake instance\nCake\nThe chocolate cake is delicious!\nThe chocolate cake is delicious!\n",
+	},
+	{
+		name: "inheritance and super",
+		source: `class Doughnut {
+  cook() { return "Fry until golden brown"; }
+}
+class BostonCream < Doughnut {
+  cook() { return super.cook() + ", then fill"; }
+  bound() { var cook = super.cook; return cook(); }
+}
+print BostonCream().cook();
+print BostonCream().bound();`,
+		expected: "Fry until golden brown, then fill\nFry until golden brown\n",
+	},
+	{
+		name:     "initializer returns this",
+		source:   `class A { init() { this.x = 1; return; } } var a = A(); print a.init() == a;`,
+		expected: "true\n",
+	},
+	{
+		name: "fields shadow cached methods",
+		source: `class A { name() { return "method"; } }
+fun field() { return "field"; }
+var a = A();
+for (var i = 0; i < 2; i = i + 1) {
+  print a.name();
+  a.name = field;
+}`,
+		expected: "method\nfield\n",
+	},
+	{
+		name: "polymorphic call site",
+		source: `class A { name() { return "A"; } }
+class B < A { name() { return "B"; } }
+class C < A {}
+fun describe(item) { return item.name(); }
+print describe(A());
+print describe(B());
+print describe(C());
+print describe(B());`,
+		expected: "A\nB\nA\nB\n",
+	},
+	{
+		name: "field layouts differ per instance",
+		source: `class P {}
+fun getY(p) { return p.y; }
+var a = P();
+a.x = 1;
+a.y = 2;
+var b = P();
+b.y = 3;
+b.x = 4;
+print getY(a);
+print getY(b);
+print getY(a);`,
+		expected: "2\n3\n2\n",
+	},
+	{
+		name: "class methods",
+		source: `class Math {
+  class square(n) { return n * n; }
+  class cube(n) { return n * this.square(n); }
+}
+class More < Math {}
+print Math.square(3);
+var cube = More.cube;
+print cube(2);`,
+		expected: "9\n8\n",
+	},
+	{
+		name: "getters and setters",
+		source: `class Circle {
+  init(radius) { this.radius = radius; }
+  area { return 3 * this.radius * this.radius; }
+  set diameter(d) { this.radius = d / 2; return "ignored"; }
+  maker { return fun(n) { return n + this.radius; }; }
+}
+class Disc < Circle {}
+var c = Disc(2);
+print c.area;
+print c.diameter = 6;
+print c.radius;
+print c.area;
+print c.maker(1);
+for (var i = 0; i < 2; i = i + 1) print c.area;`,
+		expected: "12\n6\n3\n27\n4\n27\n27\n",
+	},
+	{
+		name: "break and continue",
+		source: `for (var i = 0; i < 10; i = i + 1) {
+  var skip = i == 1;
+  if (skip) continue;
+  var stop = i == 4;
+  if (stop) break;
+  print i;
+}`,
+		expected: "0\n2\n3\n",
+	},
+	{
+		name: "break closes captured locals",
+		source: `var f;
+while (true) {
+  var x = "captured";
+  fun get() { return x; }
+  f = get;
+  break;
+}
+print f();`,
+		expected: "captured\n",
+	},
+	{
+		name: "continue in nested loops",
+		source: `var n = 0;
+for (var i = 0; i < 3; i = i + 1) {
+  for (var j = 0; j < 3; j = j + 1) {
+    if (j == i) continue;
+    n = n + 1;
+  }
+}
+print n;`,
+		expected: "6\n",
+	},
+}
+
+func TestInterpret(t *testing.T) {
+	for _, test := range interpretTests {
+		t.Run(test.name, func(t *testing.T) {
+			output, err := interpret(t, test.source)
+			if err != nil {
+				t.Fatalf("Interpret failed: %v", err)
+			}
+			if output != test.expected {
+				t.Errorf("Expected output %q, got %q", test.expected, output)
+			}
+		})
+	}
+}
+
+func TestInterpretErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected error
+	}{
+		{"parse error", `print 1 +;`, ErrCompileError},
+		{"invalid escape", `print "\q";`, ErrCompileError},
+		{"resolver error", `return 1;`, ErrCompileError},
+		{"own initializer", `{ var a = a; }`, ErrCompileError},
+		{"operand types", `print 1 - "a";`, InterpretRuntimeError},
+		{"mixed add", `print 1 + "a";`, InterpretRuntimeError},
+		{"__str__ returns an instance", `class A { __str__() { return this; } } print A();`, InterpretRuntimeError},
+		{"bitwise on a fraction", `print 1.5 & 1;`, InterpretRuntimeError},
+		{"negative shift", `print 1 >> -2;`, InterpretRuntimeError},
+		{"complement of a string", `print ~"a";`, InterpretRuntimeError},
+		{"bad binary literal", `print 0b12;`, ErrCompileError},
+		{"undefined global", `print missing;`, InterpretRuntimeError},
+		{"arity", `fun f(a) {} f(1, 2);`, InterpretRuntimeError},
+		{"call non function", `"waffles"();`, InterpretRuntimeError},
+		{"stack overflow", `fun f() { f(); } f();`, InterpretRuntimeError},
+		{"undefined property", `class A {} A().missing;`, InterpretRuntimeError},
+		{"property on non instance", `var a = 1; a.b = 2;`, InterpretRuntimeError},
+		{"invoke on non instance", `"waffles".len();`, InterpretRuntimeError},
+		{"exhausted string iterator", `var it = "a".iterator(); it.next(); it.next();`, InterpretRuntimeError},
+		{"for-in over a number", `for (var x in 5) print x;`, InterpretRuntimeError},
+		{"superclass not a class", `var A = 1; class B < A {}`, InterpretRuntimeError},
+		{"this outside class", `print this;`, ErrCompileError},
+		{"list literal", `var xs = [1, 2];`, ErrCompileError},
+		{"index nil", `var xs; print xs[0];`, InterpretRuntimeError},
+		{"index without __index__", `class A {} print A()[0];`, InterpretRuntimeError},
+		{"map literal", `var m = {"a": 1};`, ErrCompileError},
+		{"break outside a loop", `if (true) break;`, ErrCompileError},
+		{"continue outside a loop", `fun f() { continue; }`, ErrCompileError},
+		{"index assignment", `class A {} A()[0] = 1;`, ErrCompileError},
+		{"throw", `throw "oops";`, ErrCompileError},
+		{"import", `import "lib.lox";`, ErrCompileError},
+		{"undefined class method", `class A { name() {} } A.name();`, InterpretRuntimeError},
+		{"setter error", `class A { set x(v) { v(); } } A().x = 1;`, InterpretRuntimeError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := interpret(t, test.source)
+			if !errors.Is(err, test.expected) {
+				t.Errorf("Expected error %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestHeapLimit(t *testing.T) {
+	source := `var s = "";
+for (var i = 0; i < 1000; i = i + 1) {
+  s = s + "waffles";
+}`
+
+	vm := NewVM()
+	vm.SetMaxHeap(4096)
+	err := vm.Interpret(source)
+	if !errors.Is(err, InterpretRuntimeError) {
+		t.Fatalf("Expected out of memory runtime error, got %v", err)
+	}
+
+	stats := vm.HeapStats()
+	if stats.BytesAllocated > stats.MaxHeap {
+		t.Errorf("Allocated %d bytes, over the limit of %d", stats.BytesAllocated, stats.MaxHeap)
+	}
+}
+
+func TestHeapStats(t *testing.T) {
+	source := `class Point { init(x) { this.x = x; } }
+var p = Point(1);
+fun outer() {
+  var a = "a";
+  fun inner() { return a + "b"; }
+  return inner;
+}
+print outer()();`
+
+	vm := NewVM()
+	vm.out = &strings.Builder{}
+	if err := vm.Interpret(source); err != nil {
+		t.Fatalf("Interpret failed: %v", err)
+	}
+	// only what the globals reach survives
+	vm.collectGarbage()
+
+	stats := vm.HeapStats()
+	if stats.Instances != 1 {
+		t.Errorf("Expected 1 instance, got %d", stats.Instances)
+	}
+	if stats.Classes != 1 {
+		t.Errorf("Expected 1 class, got %d", stats.Classes)
+	}
+	// the constants "x", "a" and "b"
+	if stats.Strings != 3 {
+		t.Errorf("Expected 3 strings, got %d", stats.Strings)
+	}
+	// init and outer
+	if stats.Closures != 2 {
+		t.Errorf("Expected 2 closures, got %d", stats.Closures)
+	}
+	if stats.Environments != 0 {
+		t.Errorf("Expected no captured variables, got %d", stats.Environments)
+	}
+}
@@ -0,0 +1,683 @@
+package closure
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/ast"
+	"github.com/mkeesey/craftinginterpreters/pkg/heap"
+	"github.com/mkeesey/craftinginterpreters/pkg/token"
+)
+
+// scope counts the slots declared so far in a local scope. Slots are handed
+// out in declaration order, the same order the resolver numbers them.
+type scope struct {
+	enclosing *scope
+	size      int
+	// first is the first variable declared, which heap errors for the
+	// scope's frame are reported at
+	first *token.Token
+}
+
+// ast.ExprVisitor[exprFn]
+// ast.StmtVisitor[stmtFn]
+type compiler struct {
+	in *Interpreter
+	// scope is nil while compiling top-level code, where variables are
+	// globals
+	scope *scope
+}
+
+func newCompiler(in *Interpreter) *compiler {
+	return &compiler{in: in}
+}
+
+func (c *compiler) statements(stmts []ast.Stmt) []stmtFn {
+	compiled := make([]stmtFn, 0, len(stmts))
+	for _, stmt := range stmts {
+		compiled = append(compiled, ast.VisitStmt[stmtFn](stmt, c))
+	}
+	return compiled
+}
+
+func (c *compiler) expr(expr ast.Expr) exprFn {
+	return ast.VisitExpr[exprFn](expr, c)
+}
+
+func (c *compiler) beginScope(size int) {
+	c.scope = &scope{enclosing: c.scope, size: size}
+}
+
+// endScope returns the finished scope.
+func (c *compiler) endScope() *scope {
+	finished := c.scope
+	c.scope = finished.enclosing
+	return finished
+}
+
+// declare returns the slot of a new local, or -1 for a global.
+func (c *compiler) declare(name *token.Token) int {
+	if c.scope == nil {
+		return -1
+	}
+	if c.scope.first == nil {
+		c.scope.first = name
+	}
+	slot := c.scope.size
+	c.scope.size++
+	return slot
+}
+
+// define returns a closure storing a declaration's value in slot, or in the
+// globals when slot is -1.
+func (c *compiler) define(name *token.Token, slot int) func(fr *frame, value Value) {
+	if slot < 0 {
+		in := c.in
+		return func(fr *frame, value Value) {
+			in.defineGlobal(name, name.Lexeme, value)
+		}
+	}
+	return func(fr *frame, value Value) {
+		fr.slots[slot] = value
+	}
+}
+
+func (c *compiler) VisitAssign(e *ast.Assign) exprFn {
+	value := c.expr(e.Value)
+
+	l, ok := c.in.locals[e]
+	if !ok {
+		in, name := c.in, e.Name
+		return func(fr *frame) Value {
+			v := value(fr)
+			if _, ok := in.globals[name.Lexeme]; !ok {
+				throw(name, "Undefined variable '"+name.Lexeme+"'.")
+			}
+			in.globals[name.Lexeme] = v
+			return v
+		}
+	}
+
+	depth, slot := l.depth, l.slot
+	switch depth {
+	case 0:
+		return func(fr *frame) Value {
+			v := value(fr)
+			fr.slots[slot] = v
+			return v
+		}
+	case 1:
+		return func(fr *frame) Value {
+			v := value(fr)
+			fr.enclosing.slots[slot] = v
+			return v
+		}
+	default:
+		return func(fr *frame) Value {
+			v := value(fr)
+			fr.ancestor(depth).slots[slot] = v
+			return v
+		}
+	}
+}
+
+func (c *compiler) VisitBinary(e *ast.Binary) exprFn {
+	left, right := c.expr(e.Left), c.expr(e.Right)
+	in, op := c.in, e.Operator
+
+	switch op.Type {
+	case token.PLUS:
+		return func(fr *frame) Value {
+			l, r := left(fr), right(fr)
+			if a, ok := l.(float64); ok {
+				if b, ok := r.(float64); ok {
+					return a + b
+				}
+			}
+			if a, ok := l.(string); ok {
+				if b, ok := r.(string); ok {
+					result := a + b
+					in.allocate(heap.String, heap.StringSize(result), op)
+					return result
+				}
+			}
+			return in.operator(op, l, r)
+		}
+	case token.EQUAL_EQUAL, token.BANG_EQUAL:
+		negate := op.Type == token.BANG_EQUAL
+		return func(fr *frame) Value {
+			l, r := left(fr), right(fr)
+			if _, ok := l.(*instance); ok {
+				return in.operator(op, l, r)
+			}
+			return (l == r) != negate
+		}
+	case token.MINUS:
+		return c.numeric(left, right, op, func(a, b float64) Value { return a - b })
+	case token.SLASH:
+		return c.numeric(left, right, op, func(a, b float64) Value { return a / b })
+	case token.STAR:
+		return c.numeric(left, right, op, func(a, b float64) Value { return a * b })
+	case token.SLASH_SLASH:
+		return c.numeric(left, right, op, func(a, b float64) Value { return ast.FloorDivide(a, b) })
+	case token.PERCENT:
+		return c.numeric(left, right, op, func(a, b float64) Value { return ast.Modulo(a, b) })
+	case token.STAR_STAR:
+		return c.numeric(left, right, op, func(a, b float64) Value { return math.Pow(a, b) })
+	case token.AMPERSAND, token.PIPE, token.CARET, token.LESS_LESS, token.GREATER_GREATER:
+		return c.numeric(left, right, op, func(a, b float64) Value {
+			result, err := ast.Bitwise(op.Type, a, b)
+			if err != nil {
+				throw(op, err.Error())
+			}
+			return result
+		})
+	case token.GREATER:
+		return c.numeric(left, right, op, func(a, b float64) Value { return a > b })
+	case token.GREATER_EQUAL:
+		return c.numeric(left, right, op, func(a, b float64) Value { return a >= b })
+	case token.LESS:
+		return c.numeric(left, right, op, func(a, b float64) Value { return a < b })
+	case token.LESS_EQUAL:
+		return c.numeric(left, right, op, func(a, b float64) Value { return a <= b })
+	}
+
+	return func(fr *frame) Value {
+		throw(op, fmt.Sprintf("unknown operator type %s.", op.Type))
+		return nil
+	}
+}
+
+// numeric compiles a binary operator on numbers, which instances on the
+// left can overload.
+func (c *compiler) numeric(left exprFn, right exprFn, op *token.Token, apply func(a, b float64) Value) exprFn {
+	in := c.in
+	return func(fr *frame) Value {
+		l, r := left(fr), right(fr)
+		if a, ok := l.(float64); ok {
+			if b, ok := r.(float64); ok {
+				return apply(a, b)
+			}
+		}
+		return in.operator(op, l, r)
+	}
+}
+
+func (c *compiler) VisitCall(e *ast.Call) exprFn {
+	callee := c.expr(e.Callee)
+	args := make([]exprFn, len(e.Arguments))
+	for i, arg := range e.Arguments {
+		args[i] = c.expr(arg)
+	}
+
+	in, paren := c.in, e.Paren
+	return func(fr *frame) Value {
+		value := callee(fr)
+		values := make([]Value, len(args))
+		for i, arg := range args {
+			values[i] = arg(fr)
+		}
+
+		return in.call(value, paren, values)
+	}
+}
+
+func (c *compiler) VisitGet(e *ast.Get) exprFn {
+	object := c.expr(e.Object)
+	in, name := c.in, e.Name
+	return func(fr *frame) Value {
+		target := object(fr)
+		if value, ok, err := ast.Property(runtime{in}, target, name); ok {
+			rethrow(err)
+			return value
+		}
+
+		switch object := target.(type) {
+		case *instance:
+			return object.get(in, name)
+		case *class:
+			return object.get(in, name)
+		case ast.PropertyAccessor:
+			value, err := object.Get(name.Lexeme)
+			if err != nil {
+				throw(name, err.Error())
+			}
+			return ast.FromHost(value)
+		}
+		throw(name, "Only instances have properties.")
+		return nil
+	}
+}
+
+func (c *compiler) VisitGrouping(e *ast.Grouping) exprFn {
+	return c.expr(e.Expression)
+}
+
+func (c *compiler) VisitInterpolation(e *ast.Interpolation) exprFn {
+	parts := make([]exprFn, len(e.Parts))
+	for i, part := range e.Parts {
+		parts[i] = c.expr(part)
+	}
+
+	in, start := c.in, e.Start
+	return func(fr *frame) Value {
+		var b strings.Builder
+		for _, part := range parts {
+			b.WriteString(in.str(start, part(fr)))
+		}
+		result := b.String()
+		in.allocate(heap.String, heap.StringSize(result), start)
+		return result
+	}
+}
+
+func (c *compiler) VisitLambda(e *ast.Lambda) exprFn {
+	proto := c.function(e.Function, false)
+
+	in, keyword := c.in, e.Keyword
+	return func(fr *frame) Value {
+		in.allocate(heap.Closure, heap.ClosureSize, keyword)
+		return &function{proto: proto, closure: fr}
+	}
+}
+
+func (c *compiler) VisitList(e *ast.List) exprFn {
+	elements := make([]exprFn, len(e.Elements))
+	for i, element := range e.Elements {
+		elements[i] = c.expr(element)
+	}
+
+	in, bracket := c.in, e.Bracket
+	return func(fr *frame) Value {
+		values := make([]Value, len(elements))
+		for i, element := range elements {
+			values[i] = element(fr)
+		}
+		list, err := ast.AllocateList(runtime{in}, values, bracket)
+		rethrow(err)
+		return list
+	}
+}
+
+func (c *compiler) VisitLiteral(e *ast.Literal) exprFn {
+	value := e.Value
+	return func(fr *frame) Value { return value }
+}
+
+func (c *compiler) VisitLogical(e *ast.Logical) exprFn {
+	left, right := c.expr(e.Left), c.expr(e.Right)
+	if e.Operator.Type == token.OR {
+		return func(fr *frame) Value {
+			if value := left(fr); isTruthy(value) {
+				return value
+			}
+			return right(fr)
+		}
+	}
+	return func(fr *frame) Value {
+		if value := left(fr); !isTruthy(value) {
+			return value
+		}
+		return right(fr)
+	}
+}
+
+func (c *compiler) VisitMap(e *ast.Map) exprFn {
+	keys := make([]exprFn, len(e.Keys))
+	values := make([]exprFn, len(e.Values))
+	for i := range e.Keys {
+		keys[i], values[i] = c.expr(e.Keys[i]), c.expr(e.Values[i])
+	}
+
+	in, brace := c.in, e.Brace
+	return func(fr *frame) Value {
+		in.allocate(heap.Map, heap.MapSize, brace)
+		m := ast.NewLoxMap()
+		for i, key := range keys {
+			k := key(fr)
+			rethrow(ast.AssignIndex(runtime{in}, brace, m, k, values[i](fr)))
+		}
+		return m
+	}
+}
+
+func (c *compiler) VisitSet(e *ast.Set) exprFn {
+	object, value := c.expr(e.Object), c.expr(e.Value)
+	in, name := c.in, e.Name
+	return func(fr *frame) Value {
+		target := object(fr)
+		instance, isInstance := target.(*instance)
+		accessor, isAccessor := target.(ast.PropertyAccessor)
+		if !isInstance && !isAccessor {
+			throw(name, "Only instances have fields.")
+		}
+
+		v := value(fr)
+		if isInstance {
+			instance.set(in, name, v)
+		} else if err := accessor.Set(name.Lexeme, v); err != nil {
+			throw(name, err.Error())
+		}
+		return v
+	}
+}
+
+func (c *compiler) VisitIndex(e *ast.Index) exprFn {
+	object, index := c.expr(e.Object), c.expr(e.Index)
+	in, bracket := c.in, e.Bracket
+	return func(fr *frame) Value {
+		value, err := ast.ReadIndex(runtime{in}, bracket, object(fr), index(fr))
+		rethrow(err)
+		return value
+	}
+}
+
+func (c *compiler) VisitSetIndex(e *ast.SetIndex) exprFn {
+	object, index, value := c.expr(e.Object), c.expr(e.Index), c.expr(e.Value)
+	in, bracket := c.in, e.Bracket
+	return func(fr *frame) Value {
+		target, key, v := object(fr), index(fr), value(fr)
+		rethrow(ast.AssignIndex(runtime{in}, bracket, target, key, v))
+		return v
+	}
+}
+
+func (c *compiler) VisitSuper(e *ast.Super) exprFn {
+	// 'super' and 'this' are each alone in their scopes
+	depth := c.in.locals[e].depth
+	in, method := c.in, e.Method
+	return func(fr *frame) Value {
+		thisFrame := fr.ancestor(depth - 1)
+		superclass := thisFrame.enclosing.slots[0].(*class)
+		if this, ok := thisFrame.slots[0].(*class); ok { // in a class method
+			return superclass.property(in, this, method)
+		}
+		return superclass.instanceProperty(in, thisFrame.slots[0].(*instance), method)
+	}
+}
+
+func (c *compiler) VisitThis(e *ast.This) exprFn {
+	return c.variable(e, e.Keyword)
+}
+
+func (c *compiler) VisitUnary(e *ast.Unary) exprFn {
+	right := c.expr(e.Right)
+	op := e.Operator
+
+	switch op.Type {
+	case token.BANG:
+		return func(fr *frame) Value { return !isTruthy(right(fr)) }
+	case token.MINUS:
+		return func(fr *frame) Value {
+			value, ok := right(fr).(float64)
+			if !ok {
+				throw(op, "Operand must be a number.")
+			}
+			return -value
+		}
+	case token.TILDE:
+		return func(fr *frame) Value {
+			value, ok := right(fr).(float64)
+			if !ok {
+				throw(op, "Operand must be a number.")
+			}
+			result, err := ast.Complement(value)
+			if err != nil {
+				throw(op, err.Error())
+			}
+			return result
+		}
+	}
+
+	return func(fr *frame) Value {
+		throw(op, fmt.Sprintf("unknown operator type %s", op.Type))
+		return nil
+	}
+}
+
+func (c *compiler) VisitExprVar(e *ast.ExprVar) exprFn {
+	return c.variable(e, e.Name)
+}
+
+// variable compiles a read of the variable the resolver found for expr. The
+// nearest scopes get their own closures so most reads skip the walk out.
+func (c *compiler) variable(expr ast.Expr, name *token.Token) exprFn {
+	l, ok := c.in.locals[expr]
+	if !ok {
+		in := c.in
+		return func(fr *frame) Value {
+			value, ok := in.globals[name.Lexeme]
+			if !ok {
+				throw(name, "Undefined variable '"+name.Lexeme+"'.")
+			}
+			return value
+		}
+	}
+
+	depth, slot := l.depth, l.slot
+	switch depth {
+	case 0:
+		return func(fr *frame) Value { return fr.slots[slot] }
+	case 1:
+		return func(fr *frame) Value { return fr.enclosing.slots[slot] }
+	default:
+		return func(fr *frame) Value { return fr.ancestor(depth).slots[slot] }
+	}
+}
+
+func (c *compiler) VisitBlock(e *ast.Block) stmtFn {
+	return c.block(e.Statements)
+}
+
+// block compiles stmts to run in a scope of their own.
+func (c *compiler) block(stmts []ast.Stmt) stmtFn {
+	c.beginScope(0)
+	body := c.statements(stmts)
+	block := c.endScope()
+
+	in, size, first := c.in, block.size, block.first
+	return func(fr *frame) (Value, jump) {
+		inner := in.newFrame(fr, make([]Value, size), first)
+		in.enter(inner)
+		for _, stmt := range body {
+			if value, j := stmt(inner); j != jumpNone {
+				in.leave()
+				return value, j
+			}
+		}
+		in.leave()
+		return nil, jumpNone
+	}
+}
+
+func (c *compiler) VisitBreak(e *ast.Break) stmtFn {
+	return func(fr *frame) (Value, jump) { return nil, jumpBreak }
+}
+
+func (c *compiler) VisitClass(e *ast.Class) stmtFn {
+	define := c.define(e.Name, c.declare(e.Name))
+
+	var superclass exprFn
+	if e.Superclass != nil {
+		superclass = c.expr(e.Superclass)
+	}
+
+	protos := make([]*prototype, len(e.Methods))
+	for i, method := range e.Methods {
+		protos[i] = c.function(method, method.Name.Lexeme == "init")
+	}
+	statics, getters, setters := c.methodTable(e.ClassMethods), c.methodTable(e.Getters), c.methodTable(e.Setters)
+
+	in, name := c.in, e.Name
+	return func(fr *frame) (Value, jump) {
+		var super *class
+		if superclass != nil {
+			var ok bool
+			super, ok = superclass(fr).(*class)
+			if !ok {
+				throw(name, "Superclass must be a class.")
+			}
+		}
+
+		// methods close over a scope holding 'super'
+		methodFrame := fr
+		if super != nil {
+			methodFrame = in.newFrame(fr, []Value{super}, name)
+		}
+
+		methods := make(map[string]*function, len(protos))
+		for i, proto := range protos {
+			in.allocate(heap.Closure, heap.ClosureSize, e.Methods[i].Name)
+			methods[proto.name] = &function{proto: proto, closure: methodFrame}
+		}
+
+		define(fr, &class{
+			name:       name.Lexeme,
+			superclass: super,
+			methods:    methods,
+			statics:    statics(methodFrame),
+			getters:    getters(methodFrame),
+			setters:    setters(methodFrame),
+		})
+		return nil, jumpNone
+	}
+}
+
+// methodTable compiles a class's methods, returning a function that makes
+// their closures over the frame holding 'super'.
+func (c *compiler) methodTable(declarations []*ast.Function) func(fr *frame) map[string]*function {
+	protos := make([]*prototype, len(declarations))
+	for i, declaration := range declarations {
+		protos[i] = c.function(declaration, false)
+	}
+
+	in := c.in
+	return func(fr *frame) map[string]*function {
+		table := make(map[string]*function, len(protos))
+		for i, proto := range protos {
+			in.allocate(heap.Closure, heap.ClosureSize, declarations[i].Name)
+			table[proto.name] = &function{proto: proto, closure: fr}
+		}
+		return table
+	}
+}
+
+// function compiles a function body in a new scope that starts with the
+// parameters.
+func (c *compiler) function(decl *ast.Function, isInitializer bool) *prototype {
+	c.beginScope(len(decl.Params))
+	body := c.statements(decl.Body)
+	locals := c.endScope()
+
+	return &prototype{
+		name:          decl.Name.Lexeme,
+		params:        len(decl.Params),
+		size:          locals.size,
+		body:          body,
+		isInitializer: isInitializer,
+	}
+}
+
+func (c *compiler) VisitContinue(e *ast.Continue) stmtFn {
+	return func(fr *frame) (Value, jump) { return nil, jumpContinue }
+}
+
+func (c *compiler) VisitExpression(e *ast.Expression) stmtFn {
+	expr := c.expr(e.Expression)
+	return func(fr *frame) (Value, jump) {
+		expr(fr)
+		return nil, jumpNone
+	}
+}
+
+func (c *compiler) VisitFunction(e *ast.Function) stmtFn {
+	define := c.define(e.Name, c.declare(e.Name))
+	proto := c.function(e, false)
+
+	in, name := c.in, e.Name
+	return func(fr *frame) (Value, jump) {
+		in.allocate(heap.Closure, heap.ClosureSize, name)
+		define(fr, &function{proto: proto, closure: fr})
+		return nil, jumpNone
+	}
+}
+
+func (c *compiler) VisitIf(e *ast.If) stmtFn {
+	condition := c.expr(e.Condition)
+	thenBranch := ast.VisitStmt[stmtFn](e.ThenBranch, c)
+	if e.ElseBranch == nil {
+		return func(fr *frame) (Value, jump) {
+			if isTruthy(condition(fr)) {
+				return thenBranch(fr)
+			}
+			return nil, jumpNone
+		}
+	}
+
+	elseBranch := ast.VisitStmt[stmtFn](e.ElseBranch, c)
+	return func(fr *frame) (Value, jump) {
+		if isTruthy(condition(fr)) {
+			return thenBranch(fr)
+		}
+		return elseBranch(fr)
+	}
+}
+
+func (c *compiler) VisitPrint(e *ast.Print) stmtFn {
+	expr := c.expr(e.Expression)
+	in, keyword := c.in, e.Keyword
+	return func(fr *frame) (Value, jump) {
+		fmt.Fprintln(in.out, in.str(keyword, expr(fr)))
+		return nil, jumpNone
+	}
+}
+
+func (c *compiler) VisitReturn(e *ast.Return) stmtFn {
+	if e.Value == nil {
+		return func(fr *frame) (Value, jump) { return nil, jumpReturn }
+	}
+	value := c.expr(e.Value)
+	return func(fr *frame) (Value, jump) { return value(fr), jumpReturn }
+}
+
+func (c *compiler) VisitStmtVar(e *ast.StmtVar) stmtFn {
+	define := c.define(e.Name, c.declare(e.Name))
+	var initializer exprFn
+	if e.Initializer != nil {
+		initializer = c.expr(e.Initializer)
+	}
+
+	return func(fr *frame) (Value, jump) {
+		var value Value
+		if initializer != nil {
+			value = initializer(fr)
+		}
+		define(fr, value)
+		return nil, jumpNone
+	}
+}
+
+func (c *compiler) VisitWhile(e *ast.While) stmtFn {
+	condition := c.expr(e.Condition)
+	body := ast.VisitStmt[stmtFn](e.Body, c)
+	increment := func(fr *frame) Value { return nil }
+	if e.Increment != nil {
+		increment = c.expr(e.Increment)
+	}
+	in, keyword := c.in, e.Keyword
+	return func(fr *frame) (Value, jump) {
+		for isTruthy(condition(fr)) {
+			in.checkInterrupt(keyword)
+			value, j := body(fr)
+			if j == jumpBreak {
+				break
+			}
+			if j == jumpReturn {
+				return value, j
+			}
+			increment(fr)
+		}
+		return nil, jumpNone
+	}
+}
@@ -0,0 +1,101 @@
+package closure
+
+import (
+	"github.com/mkeesey/craftinginterpreters/pkg/ast"
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/heap"
+)
+
+// errorClass is the class of the instances runtime errors are caught as.
+// It has no methods, so every interpreter can share it.
+var errorClass = &class{name: "Error"}
+
+func (c *compiler) VisitThrow(e *ast.Throw) stmtFn {
+	value := c.expr(e.Value)
+	keyword := e.Keyword
+	return func(fr *frame) (Value, jump) {
+		thrown := value(fr)
+		panic(failure.RuntimeError{Token: keyword, Message: ast.ThrownMessage(thrown), Thrown: true, Value: thrown})
+	}
+}
+
+func (c *compiler) VisitTry(e *ast.Try) stmtFn {
+	body := c.block(e.Body)
+	var catch func(fr *frame, err failure.RuntimeError) (Value, jump)
+	if e.CatchName != nil {
+		// the exception variable takes the first slot of the catch body's
+		// scope
+		c.beginScope(1)
+		c.scope.first = e.CatchName
+		catchBody := c.statements(e.CatchBody)
+		size := c.endScope().size
+		in, name := c.in, e.CatchName
+		catch = func(fr *frame, err failure.RuntimeError) (Value, jump) {
+			slots := make([]Value, size)
+			slots[0] = in.caught(err)
+			inner := in.newFrame(fr, slots, name)
+			in.enter(inner)
+			for _, stmt := range catchBody {
+				if value, j := stmt(inner); j != jumpNone {
+					in.leave()
+					return value, j
+				}
+			}
+			in.leave()
+			return nil, jumpNone
+		}
+	}
+	var finally stmtFn
+	if e.FinallyBody != nil {
+		finally = c.block(e.FinallyBody)
+	}
+
+	in := c.in
+	return func(fr *frame) (Value, jump) {
+		value, j, err := in.try(func() (Value, jump) { return body(fr) })
+		if err != nil && catch != nil {
+			caught := *err
+			value, j, err = in.try(func() (Value, jump) { return catch(fr, caught) })
+		}
+		if finally != nil {
+			// a finally body that jumps replaces how the try ended
+			if value, j := finally(fr); j != jumpNone {
+				return value, j
+			}
+		}
+		if err != nil {
+			panic(*err)
+		}
+		return value, j
+	}
+}
+
+// try runs stmt, recovering any runtime error a try statement can catch.
+// Fatal errors keep unwinding, skipping finally clauses too.
+func (in *Interpreter) try(stmt func() (Value, jump)) (value Value, j jump, caught *failure.RuntimeError) {
+	depth := in.depth()
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(failure.RuntimeError)
+			if !ok || err.Fatal {
+				panic(r)
+			}
+			err = in.unwind(err, depth)
+			caught = &err
+		}
+	}()
+	value, j = stmt()
+	return value, j, nil
+}
+
+// caught returns the value a catch clause binds for err: the thrown value,
+// or for errors the interpreter raised, an Error instance holding the
+// message and line.
+func (in *Interpreter) caught(err failure.RuntimeError) Value {
+	if err.Thrown {
+		return err.Value
+	}
+	fields := ast.CaughtFields(err)
+	in.allocate(heap.Instance, heap.InstanceSize+len(fields)*heap.FieldSize, err.Token)
+	return &instance{class: errorClass, fields: fields}
+}
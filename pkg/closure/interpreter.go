@@ -0,0 +1,316 @@
+// Package closure runs resolved Lox programs by compiling the AST once into
+// a tree of Go closures, then calling them. It sits between the tree-walk
+// interpreter and the bytecode VM: there is no visitor dispatch or locals
+// lookup while running, but values are still plain Go values.
+package closure
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/ast"
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/heap"
+	"github.com/mkeesey/craftinginterpreters/pkg/native"
+	"github.com/mkeesey/craftinginterpreters/pkg/stdlib"
+	"github.com/mkeesey/craftinginterpreters/pkg/token"
+)
+
+// Value is a Lox value: nil, bool, float64, string, one of the callable and
+// instance types of this package, or a list, map or other built-in value of
+// package ast.
+type Value = interface{}
+
+// frame holds the variables of one local scope by slot, in the order the
+// resolver numbered them.
+type frame struct {
+	enclosing *frame
+	slots     []Value
+}
+
+func (f *frame) ancestor(depth int) *frame {
+	for i := 0; i < depth; i++ {
+		f = f.enclosing
+	}
+	return f
+}
+
+type exprFn func(fr *frame) Value
+
+// jump is how a statement left the code around it. Only returns carry a
+// value.
+type jump int
+
+const (
+	jumpNone jump = iota
+	jumpReturn
+	jumpBreak
+	jumpContinue
+)
+
+// stmtFn runs a statement, reporting whether it executed a return, break or
+// continue.
+type stmtFn func(fr *frame) (Value, jump)
+
+// local is where the resolver found a local variable: how many scopes out
+// from the reference, and the variable's slot in that scope.
+type local struct {
+	depth int
+	slot  int
+}
+
+// ast.LocalResolver
+type Interpreter struct {
+	globals  map[string]Value
+	locals   map[ast.Expr]local
+	heap     *heap.Heap
+	reporter *failure.Reporter
+	out      io.Writer
+	// interrupt stops the program once closed
+	interrupt <-chan struct{}
+	// calls are the Lox function calls running, innermost last. Runtime
+	// errors unwind past the pops, so whoever recovers one truncates it.
+	calls []failure.Frame
+	// frames are the scopes running, innermost last, which runtime errors
+	// also unwind past
+	frames []*frame
+	// modules loads imports, which fail without it
+	modules *ast.ModuleLoader
+	// exports are the names of the exported globals
+	exports map[string]bool
+}
+
+func NewInterpreter(reporter *failure.Reporter) *Interpreter {
+	h := heap.New(0)
+	in := newInterpreter(reporter, h)
+	h.PushRoots(in.markRoots)
+	return in
+}
+
+// newInterpreter returns an interpreter with only the natives defined, which
+// charges allocations to h.
+func newInterpreter(reporter *failure.Reporter, h *heap.Heap) *Interpreter {
+	in := &Interpreter{
+		globals:  make(map[string]Value),
+		locals:   make(map[ast.Expr]local),
+		heap:     h,
+		reporter: reporter,
+		out:      os.Stdout,
+	}
+	if err := in.DefineNative("clock", clockNative); err != nil {
+		panic(err)
+	}
+	if err := stdlib.Install(in); err != nil {
+		panic(err)
+	}
+	return in
+}
+
+// SetOutput redirects print statements, which go to stdout by default.
+func (in *Interpreter) SetOutput(w io.Writer) {
+	in.out = w
+}
+
+// SetMaxHeap limits the estimated bytes of live data a script may hold. Zero
+// means no limit.
+func (in *Interpreter) SetMaxHeap(bytes int) {
+	in.heap.SetMaxHeap(bytes)
+}
+
+func (in *Interpreter) HeapStats() heap.Stats {
+	return in.heap.Stats()
+}
+
+// SetInterrupt makes the program stop with a runtime error once done is
+// closed. It is checked on each loop iteration and function call.
+func (in *Interpreter) SetInterrupt(done <-chan struct{}) {
+	in.interrupt = done
+}
+
+// DefineGlobal defines or redefines a global variable from Go. Go slices
+// become lists.
+func (in *Interpreter) DefineGlobal(name string, value Value) {
+	in.globals[name] = ast.FromHost(value)
+}
+
+// DefineNative defines a global function that calls fn, a Go function whose
+// parameters and results are converted as described by native.Wrap. An
+// error returned by fn becomes a runtime error at the call.
+func (in *Interpreter) DefineNative(name string, fn interface{}) error {
+	wrapped, err := native.Wrap(name, fn)
+	if err != nil {
+		return err
+	}
+	in.globals[name] = ast.FromHost(wrapped)
+	return nil
+}
+
+// Global returns the value of a global variable.
+func (in *Interpreter) Global(name string) (Value, bool) {
+	value, ok := in.globals[name]
+	return value, ok
+}
+
+func (in *Interpreter) ResolveLocal(expr ast.Expr, depth int, slot int) {
+	in.locals[expr] = local{depth: depth, slot: slot}
+}
+
+// Interpret compiles statements, which must already have been resolved
+// against this interpreter, and runs them. Runtime errors are reported and
+// stop the program.
+func (in *Interpreter) Interpret(statements []ast.Stmt) {
+	in.Eval(statements)
+}
+
+// Eval runs statements like Interpret. If the last statement is an
+// expression statement, its value is returned.
+func (in *Interpreter) Eval(statements []ast.Stmt) (result Value) {
+	c := newCompiler(in)
+	var last exprFn
+	if n := len(statements); n > 0 {
+		if expression, ok := statements[n-1].(*ast.Expression); ok {
+			statements = statements[:n-1]
+			last = c.expr(expression.Expression)
+		}
+	}
+	compiled := c.statements(statements)
+
+	defer func() {
+		if r := recover(); r != nil {
+			// anything other than a Lox runtime error is a bug
+			err, ok := r.(failure.RuntimeError)
+			if !ok {
+				panic(r)
+			}
+			in.reporter.RuntimeError(in.unwind(err, depth{}))
+			result = nil
+		}
+	}()
+	for _, stmt := range compiled {
+		stmt(nil)
+	}
+	if last != nil {
+		return last(nil)
+	}
+	return nil
+}
+
+// call calls callee with args, checking it is callable and takes that many
+// arguments. paren locates runtime errors.
+func (in *Interpreter) call(callee Value, paren *token.Token, args []Value) Value {
+	switch function := callee.(type) {
+	case callable:
+		checkArity(paren, function.arity(), args)
+		return function.call(in, paren, args)
+	case ast.Builtin:
+		checkArity(paren, function.Arity(), args)
+		result, err := function.Invoke(runtime{in}, paren, args)
+		rethrow(err)
+		return result
+	}
+	throw(paren, "Can only call functions and classes.")
+	return nil
+}
+
+// checkArity throws a runtime error at paren unless a function of arity
+// takes args. A negative arity accepts any count.
+func checkArity(paren *token.Token, arity int, args []Value) {
+	if arity >= 0 && len(args) != arity {
+		throw(paren, fmt.Sprintf("Expected %d arguments but got %d.", arity, len(args)))
+	}
+}
+
+// throw abandons the running program with a Lox runtime error at tok.
+// Interpret or an enclosing try statement recovers it.
+func throw(tok *token.Token, message string) {
+	panic(failure.RuntimeError{Token: tok, Message: message})
+}
+
+// throwFatal throws a runtime error that try statements can't catch.
+func throwFatal(tok *token.Token, message string) {
+	panic(failure.RuntimeError{Token: tok, Message: message, Fatal: true})
+}
+
+// depth is how many calls and scopes were running where a runtime error is
+// recovered.
+type depth struct {
+	calls  int
+	frames int
+}
+
+func (in *Interpreter) depth() depth {
+	return depth{calls: len(in.calls), frames: len(in.frames)}
+}
+
+// unwind adds the calls err unwound out of, those above d, to its stack
+// trace and drops them and the scopes above d from those running.
+func (in *Interpreter) unwind(err failure.RuntimeError, d depth) failure.RuntimeError {
+	for i := len(in.calls) - 1; i >= d.calls; i-- {
+		err.Trace = append(err.Trace, in.calls[i])
+	}
+	in.calls = in.calls[:d.calls]
+	in.frames = in.frames[:d.frames]
+	return err
+}
+
+// checkInterrupt throws a runtime error at tok if the interrupt channel has
+// been closed.
+func (in *Interpreter) checkInterrupt(tok *token.Token) {
+	select {
+	case <-in.interrupt:
+		throwFatal(tok, "Interrupted.")
+	default:
+	}
+}
+
+func (in *Interpreter) defineGlobal(tok *token.Token, name string, value Value) {
+	if len(in.globals) == 0 {
+		in.allocate(heap.Environment, heap.EnvironmentSize, tok)
+	}
+	if _, ok := in.globals[name]; !ok {
+		in.grow(heap.VariableSize, tok)
+	}
+	in.globals[name] = value
+}
+
+// newFrame creates a scope of size slots, charging for it unless it is
+// empty.
+func (in *Interpreter) newFrame(enclosing *frame, slots []Value, tok *token.Token) *frame {
+	if len(slots) > 0 {
+		in.allocate(heap.Environment, heap.EnvironmentSize+len(slots)*heap.VariableSize, tok)
+	}
+	return &frame{enclosing: enclosing, slots: slots}
+}
+
+// enter makes fr the running scope until the matching leave.
+func (in *Interpreter) enter(fr *frame) {
+	in.frames = append(in.frames, fr)
+}
+
+func (in *Interpreter) leave() {
+	in.frames = in.frames[:len(in.frames)-1]
+}
+
+func (in *Interpreter) allocate(kind heap.Kind, size int, tok *token.Token) {
+	rethrow(runtime{in}.Allocate(kind, size, tok))
+}
+
+func (in *Interpreter) grow(size int, tok *token.Token) {
+	rethrow(runtime{in}.Grow(size, tok))
+}
+
+func clockNative() float64 {
+	return float64(time.Now().Unix())
+}
+
+func isTruthy(value Value) bool {
+	if value == nil {
+		return false
+	}
+	if b, ok := value.(bool); ok {
+		return b
+	}
+	return true
+}
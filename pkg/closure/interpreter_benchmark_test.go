@@ -0,0 +1,79 @@
+package closure_test
+
+import (
+	"testing"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/ast"
+	"github.com/mkeesey/craftinginterpreters/pkg/closure"
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+)
+
+// The programs match pkg/ast's benchmarks so the two backends can be
+// compared directly.
+
+func BenchmarkFib(b *testing.B) {
+	benchmarkProgram(b, fibProgram)
+}
+
+func BenchmarkLocals(b *testing.B) {
+	benchmarkProgram(b, localsProgram)
+}
+
+func BenchmarkMethodCalls(b *testing.B) {
+	benchmarkProgram(b, methodsProgram)
+}
+
+// benchmarkProgram times resolving, compiling and running program. Scanning
+// and parsing happen once up front.
+func benchmarkProgram(b *testing.B, program string) {
+	reporter := &failure.Reporter{}
+	statements := parse(b, reporter, program)
+
+	for i := 0; i < b.N; i++ {
+		interpreter := closure.NewInterpreter(reporter)
+		ast.NewResolver(interpreter, reporter).Resolve(statements)
+		interpreter.Interpret(statements)
+		if reporter.HasFailed() {
+			b.Fatalf("Interpret failed")
+		}
+	}
+}
+
+const fibProgram = `
+fun fib(n) {
+  if (n < 2) return n;
+  return fib(n - 2) + fib(n - 1);
+}
+
+var result = fib(20);
+`
+
+const localsProgram = `
+fun sum(n) {
+  var total = 0;
+  for (var i = 0; i < n; i = i + 1) {
+    var a = i;
+    var b = a + 1;
+    total = total + a + b;
+  }
+  return total;
+}
+
+var result = sum(20000);
+`
+
+const methodsProgram = `
+class Counter {
+  init() { this.count = 0; }
+  add(n) {
+    if (n > 2) return this.add(n - 1);
+    this.count = this.count + n;
+    return this.count;
+  }
+}
+
+var counter = Counter();
+for (var i = 0; i < 5000; i = i + 1) {
+  counter.add(5);
+}
+`
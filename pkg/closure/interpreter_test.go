@@ -0,0 +1,129 @@
+package closure_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/ast"
+	"github.com/mkeesey/craftinginterpreters/pkg/closure"
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/parser"
+	"github.com/mkeesey/craftinginterpreters/pkg/scanner"
+	"github.com/stretchr/testify/require"
+)
+
+func parse(t testing.TB, reporter *failure.Reporter, source string) []ast.Stmt {
+	t.Helper()
+	tokens := scanner.NewScanner(strings.NewReader(source), reporter).ScanTokens()
+	statements, err := parser.NewParser(tokens, reporter).Parse()
+	require.NoError(t, err)
+	return statements
+}
+
+func run(t *testing.T, interpreter *closure.Interpreter, reporter *failure.Reporter, source string) {
+	t.Helper()
+	statements := parse(t, reporter, source)
+	ast.NewResolver(interpreter, reporter).Resolve(statements)
+	require.False(t, reporter.HasFailed())
+
+	interpreter.Interpret(statements)
+}
+
+func TestHeapStats(t *testing.T) {
+	reporter := &failure.Reporter{}
+	interpreter := closure.NewInterpreter(reporter)
+	run(t, interpreter, reporter, `class Point {
+  init(x) { this.x = x; }
+}
+var p = Point(1);
+var s = "a" + "b";`)
+	require.False(t, reporter.HasFailed())
+
+	stats := interpreter.HeapStats()
+	require.Equal(t, 1, stats.Instances)
+	require.Equal(t, 1, stats.Strings)
+	// the init method, and init bound to the new instance
+	require.Equal(t, 2, stats.Closures)
+	// the bound method's 'this' and the call's parameters
+	require.Equal(t, 2, stats.Environments)
+}
+
+func TestHeapLimit(t *testing.T) {
+	reporter := &failure.Reporter{}
+	interpreter := closure.NewInterpreter(reporter)
+	interpreter.SetMaxHeap(4096)
+	run(t, interpreter, reporter, `var s = "";
+for (var i = 0; i < 1000; i = i + 1) {
+  s = s + "waffles";
+}`)
+	require.True(t, reporter.HasFailed())
+
+	stats := interpreter.HeapStats()
+	require.LessOrEqual(t, stats.BytesAllocated, stats.MaxHeap)
+}
+
+// TestRuntimeErrorsUnwind checks that an error deep in a call chain stops
+// the whole program, and that the interpreter is usable afterwards.
+func TestRuntimeErrorsUnwind(t *testing.T) {
+	reporter := &failure.Reporter{}
+	interpreter := closure.NewInterpreter(reporter)
+	var out bytes.Buffer
+	interpreter.SetOutput(&out)
+
+	run(t, interpreter, reporter, `fun inner() { return nil + 1; }
+fun outer() { var x = inner(); print "unreachable"; }
+outer();
+print "after";`)
+	require.True(t, reporter.HasFailed())
+	require.Empty(t, out.String())
+
+	reporter.Reset()
+	run(t, interpreter, reporter, `print "again";`)
+	require.False(t, reporter.HasFailed())
+	require.Equal(t, "again\n", out.String())
+}
+
+// TestCompileOnce checks that globals from one Interpret call are visible to
+// code compiled by the next, as in the REPL.
+func TestCompileOnce(t *testing.T) {
+	reporter := &failure.Reporter{}
+	interpreter := closure.NewInterpreter(reporter)
+	var out bytes.Buffer
+	interpreter.SetOutput(&out)
+
+	run(t, interpreter, reporter, `fun twice(x) { return x * 2; }`)
+	run(t, interpreter, reporter, `var a = twice(21);`)
+	run(t, interpreter, reporter, `print a;`)
+	require.False(t, reporter.HasFailed())
+	require.Equal(t, "42\n", out.String())
+}
+
+// TestSharedRuntime checks that lists, maps and their methods are package
+// ast's, with callbacks into this interpreter unwinding like its own calls.
+func TestSharedRuntime(t *testing.T) {
+	reporter := &failure.Reporter{}
+	interpreter := closure.NewInterpreter(reporter)
+	statements := parse(t, reporter, `var xs = [3, 1, 2];
+xs.sort(fun(a, b) { return a < b; });
+var m = {"xs": xs};
+m;`)
+	ast.NewResolver(interpreter, reporter).Resolve(statements)
+	value := interpreter.Eval(statements)
+	require.False(t, reporter.HasFailed())
+
+	m, ok := value.(*ast.LoxMap)
+	require.True(t, ok)
+	xs, ok := m.Lookup("xs")
+	require.True(t, ok)
+	require.IsType(t, &ast.LoxList{}, xs)
+	require.Equal(t, `{"xs": [1, 2, 3]}`, m.String())
+
+	var out bytes.Buffer
+	interpreter.SetOutput(&out)
+	run(t, interpreter, reporter, `fun check(x) { if (x > 1) throw "too big"; return x; }
+try { xs.map(check); } catch (e) { print e; }
+print "after";`)
+	require.False(t, reporter.HasFailed())
+	require.Equal(t, "too big\nafter\n", out.String())
+}
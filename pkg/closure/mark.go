@@ -0,0 +1,65 @@
+package closure
+
+import (
+	"github.com/mkeesey/craftinginterpreters/pkg/ast"
+	"github.com/mkeesey/craftinginterpreters/pkg/heap"
+)
+
+// As in the tree-walk interpreter, the heap measures what the roots reach
+// when an allocation would go over the max heap, since Go's collector
+// reclaims the objects.
+
+// markRoots marks everything the interpreter can reach: its globals, the
+// scopes running and the loaded modules.
+func (in *Interpreter) markRoots(m *heap.Marker) {
+	m.Count(heap.Environment, heap.EnvironmentSize+len(in.globals)*heap.VariableSize)
+	for _, value := range in.globals {
+		markValue(m, value)
+	}
+	for _, fr := range in.frames {
+		markFrame(m, fr)
+	}
+	if in.modules != nil {
+		in.modules.Mark(m, func(value Value) { markValue(m, value) })
+	}
+}
+
+func markFrame(m *heap.Marker, fr *frame) {
+	for ; fr != nil && m.Visit(fr); fr = fr.enclosing {
+		if len(fr.slots) > 0 {
+			m.Count(heap.Environment, heap.EnvironmentSize+len(fr.slots)*heap.VariableSize)
+		}
+		for _, value := range fr.slots {
+			markValue(m, value)
+		}
+	}
+}
+
+// markValue marks value and what it references.
+func markValue(m *heap.Marker, value Value) {
+	switch value := value.(type) {
+	case *function:
+		if m.Visit(value) {
+			m.Count(heap.Closure, heap.ClosureSize)
+			markFrame(m, value.closure)
+		}
+	case *class:
+		for c := value; c != nil && m.Visit(c); c = c.superclass {
+			for _, table := range []map[string]*function{c.methods, c.statics, c.getters, c.setters} {
+				for _, method := range table {
+					markValue(m, method)
+				}
+			}
+		}
+	case *instance:
+		if m.Visit(value) {
+			m.Count(heap.Instance, heap.InstanceSize+len(value.fields)*heap.FieldSize)
+			markValue(m, value.class)
+			for _, field := range value.fields {
+				markValue(m, field)
+			}
+		}
+	default:
+		ast.Mark(m, value, func(value Value) { markValue(m, value) })
+	}
+}
@@ -0,0 +1,100 @@
+package closure
+
+import (
+	"fmt"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/ast"
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+)
+
+// SetModuleLoader lets the interpreter run import statements, which fail
+// without a loader.
+func (in *Interpreter) SetModuleLoader(loader *ast.ModuleLoader) {
+	in.modules = loader
+}
+
+func (c *compiler) VisitImport(e *ast.Import) stmtFn {
+	var bindModule func(fr *frame, value Value)
+	if e.Name != nil {
+		bindModule = c.define(e.Name, c.declare(e.Name))
+	}
+	binds := make([]func(fr *frame, value Value), len(e.Names))
+	for i, name := range e.Names {
+		binds[i] = c.define(name, c.declare(name))
+	}
+
+	in := c.in
+	return func(fr *frame) (Value, jump) {
+		m := in.importModule(e)
+		if bindModule != nil {
+			bindModule(fr, m)
+		}
+		for i, name := range e.Names {
+			value, err := m.Get(name)
+			rethrow(err)
+			binds[i](fr, value)
+		}
+		return nil, jumpNone
+	}
+}
+
+func (in *Interpreter) importModule(e *ast.Import) *ast.LoxModule {
+	if in.modules == nil {
+		throw(e.Keyword, "Can't import modules here.")
+	}
+	loaded, err := in.modules.Load(e.Path, func(file string, statements []ast.Stmt) (interface{}, error) {
+		return in.runModule(e, statements)
+	})
+	if err != nil {
+		panic(err)
+	}
+	return loaded.(*ast.LoxModule)
+}
+
+// runModule resolves, compiles and runs the statements of the module e
+// imports in globals of their own. Runtime errors are returned so the
+// loader sees the module fail.
+func (in *Interpreter) runModule(e *ast.Import, statements []ast.Stmt) (m *ast.LoxModule, err error) {
+	name := e.Path.Literal.(string)
+	child := newInterpreter(in.reporter, in.heap)
+	child.locals = in.locals
+	child.out = in.out
+	child.interrupt = in.interrupt
+	child.modules = in.modules
+	in.heap.PushRoots(child.markRoots)
+	defer in.heap.PopRoots()
+
+	ast.NewResolver(child, in.reporter).Resolve(statements)
+	if in.reporter.HasFailed() {
+		return nil, failure.RuntimeError{Token: e.Path, Message: fmt.Sprintf("Can't compile module '%s'.", name), Fatal: true}
+	}
+	compiled := newCompiler(child).statements(statements)
+
+	defer func() {
+		if r := recover(); r != nil {
+			runtimeErr, ok := r.(failure.RuntimeError)
+			if !ok {
+				panic(r)
+			}
+			frame := failure.Frame{Function: name, Module: true, File: e.Keyword.File, Line: e.Keyword.Line}
+			m, err = nil, failure.Unwind(child.unwind(runtimeErr, depth{}), frame)
+		}
+	}()
+	for _, stmt := range compiled {
+		stmt(nil)
+	}
+	return ast.NewLoxModule(name, child.globals, child.exports), nil
+}
+
+func (c *compiler) VisitExport(e *ast.Export) stmtFn {
+	declaration := ast.VisitStmt[stmtFn](e.Declaration, c)
+	in, name := c.in, ast.DeclaredName(e.Declaration).Lexeme
+	return func(fr *frame) (Value, jump) {
+		declaration(fr)
+		if in.exports == nil {
+			in.exports = make(map[string]bool)
+		}
+		in.exports[name] = true
+		return nil, jumpNone
+	}
+}
@@ -0,0 +1,215 @@
+package closure
+
+import (
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/heap"
+	"github.com/mkeesey/craftinginterpreters/pkg/token"
+)
+
+type callable interface {
+	// call invokes the callable with arguments already checked against its
+	// arity. The callee may keep args as its own frame. paren is the call
+	// site's closing parenthesis, used to locate runtime errors.
+	call(in *Interpreter, paren *token.Token, args []Value) Value
+	// arity is negative for variadic callables, which check their own
+	// argument count.
+	arity() int
+}
+
+// prototype is everything about a function fixed at compile time.
+type prototype struct {
+	name   string
+	params int
+	// size is the number of slots in the function's frame: its parameters
+	// followed by the locals declared directly in its body
+	size          int
+	body          []stmtFn
+	isInitializer bool
+}
+
+type function struct {
+	proto   *prototype
+	closure *frame
+}
+
+func (f *function) call(in *Interpreter, paren *token.Token, args []Value) Value {
+	in.checkInterrupt(paren)
+	slots := args
+	if f.proto.size > len(args) {
+		slots = make([]Value, f.proto.size)
+		copy(slots, args)
+	}
+	fr := in.newFrame(f.closure, slots, paren)
+
+	in.calls = append(in.calls, failure.Call(f.proto.name, paren))
+	in.enter(fr)
+	value := f.run(fr)
+	in.leave()
+	in.calls = in.calls[:len(in.calls)-1]
+	return value
+}
+
+// run runs f's body in fr, returning what the call evaluates to.
+func (f *function) run(fr *frame) Value {
+	for _, stmt := range f.proto.body {
+		if value, j := stmt(fr); j == jumpReturn {
+			if f.proto.isInitializer {
+				break
+			}
+			return value
+		}
+	}
+	if f.proto.isInitializer { // initializers always return 'this'
+		return f.closure.slots[0]
+	}
+	return nil
+}
+
+func (f *function) arity() int {
+	return f.proto.params
+}
+
+func (f *function) String() string {
+	return "<fn " + f.proto.name + ">"
+}
+
+func (f *function) TypeName() string {
+	return "function"
+}
+
+// bind binds f to this, an instance or, for class methods, the class,
+// charging for the closure and the frame holding 'this'.
+func (f *function) bind(in *Interpreter, this Value, tok *token.Token) *function {
+	in.allocate(heap.Closure, heap.ClosureSize, tok)
+	frame := in.newFrame(f.closure, []Value{this}, tok)
+	return &function{proto: f.proto, closure: frame}
+}
+
+type class struct {
+	name       string
+	superclass *class
+	methods    map[string]*function
+	// statics are the class methods, bound to the class when called
+	statics map[string]*function
+	getters map[string]*function
+	setters map[string]*function
+}
+
+func (c *class) call(in *Interpreter, paren *token.Token, args []Value) Value {
+	in.allocate(heap.Instance, heap.InstanceSize, paren)
+	instance := &instance{class: c, fields: make(map[string]Value)}
+	if initializer := c.findMethod("init"); initializer != nil {
+		initializer.bind(in, instance, paren).call(in, paren, args)
+	}
+	return instance
+}
+
+func (c *class) arity() int {
+	if initializer := c.findMethod("init"); initializer != nil {
+		return initializer.arity()
+	}
+	return 0
+}
+
+func (c *class) String() string {
+	return c.name
+}
+
+func (c *class) TypeName() string {
+	return "class"
+}
+
+func (c *class) findMethod(name string) *function {
+	return c.find(name, methods)
+}
+
+// find looks name up in the table of c or of its nearest superclass that
+// has it.
+func (c *class) find(name string, table func(*class) map[string]*function) *function {
+	for class := c; class != nil; class = class.superclass {
+		if method, ok := table(class)[name]; ok {
+			return method
+		}
+	}
+	return nil
+}
+
+func methods(c *class) map[string]*function { return c.methods }
+func statics(c *class) map[string]*function { return c.statics }
+func getters(c *class) map[string]*function { return c.getters }
+func setters(c *class) map[string]*function { return c.setters }
+
+// get reads a class method, bound to the class.
+func (c *class) get(in *Interpreter, name *token.Token) Value {
+	return c.property(in, c, name)
+}
+
+// property reads name from c's class methods for this, which is c or a
+// subclass.
+func (c *class) property(in *Interpreter, this *class, name *token.Token) Value {
+	if method := c.find(name.Lexeme, statics); method != nil {
+		return method.bind(in, this, name)
+	}
+	throw(name, "Undefined property '"+name.Lexeme+"'.")
+	return nil
+}
+
+// instanceProperty reads name from c's getters and methods for instance,
+// whose class is c or a subclass. Getters are called, methods are bound.
+func (c *class) instanceProperty(in *Interpreter, instance *instance, name *token.Token) Value {
+	if getter := c.find(name.Lexeme, getters); getter != nil {
+		return getter.bind(in, instance, name).call(in, name, nil)
+	}
+	if method := c.findMethod(name.Lexeme); method != nil {
+		return method.bind(in, instance, name)
+	}
+	throw(name, "Undefined property '"+name.Lexeme+"'.")
+	return nil
+}
+
+type instance struct {
+	class  *class
+	fields map[string]Value
+}
+
+func (i *instance) get(in *Interpreter, name *token.Token) Value {
+	if value, ok := i.fields[name.Lexeme]; ok {
+		return value
+	}
+	return i.class.instanceProperty(in, i, name)
+}
+
+// set calls the setter for name if the class has one, or else assigns the
+// field.
+func (i *instance) set(in *Interpreter, name *token.Token, value Value) {
+	if setter := i.class.find(name.Lexeme, setters); setter != nil {
+		setter.bind(in, i, name).call(in, name, []Value{value})
+		return
+	}
+	if _, ok := i.fields[name.Lexeme]; !ok {
+		in.grow(heap.FieldSize, name)
+	}
+	i.fields[name.Lexeme] = value
+}
+
+// ClassName is the name of the instance's class.
+func (i *instance) ClassName() string {
+	return i.class.name
+}
+
+// Fields returns a copy of the instance's fields.
+func (i *instance) Fields() map[string]Value {
+	fields := make(map[string]Value, len(i.fields))
+	for name, value := range i.fields {
+		fields[name] = value
+	}
+	return fields
+}
+
+func (i *instance) String() string {
+	return i.class.name + " instance"
+}
+
+func (i *instance) TypeName() string {
+	return "instance"
+}
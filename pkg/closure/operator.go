@@ -0,0 +1,30 @@
+package closure
+
+import (
+	"github.com/mkeesey/craftinginterpreters/pkg/ast"
+	"github.com/mkeesey/craftinginterpreters/pkg/token"
+)
+
+// operator applies op to operands the fast paths in VisitBinary don't
+// handle: an instance on the left calls the method overloading op, and
+// anything else is an error. Instances without an __eq__ method compare by
+// identity.
+func (in *Interpreter) operator(op *token.Token, left Value, right Value) Value {
+	if _, ok := left.(*instance); !ok {
+		if op.Type == token.PLUS {
+			throw(op, "Operands must be two numbers or two strings.")
+		}
+		throw(op, "Operands must be numbers.")
+	}
+	result, err := ast.Operator(runtime{in}, op, left, right)
+	rethrow(err)
+	return result
+}
+
+// str formats value for print, calling __str__ on instances that define
+// it, which must return a string.
+func (in *Interpreter) str(tok *token.Token, value Value) string {
+	str, err := ast.Str(runtime{in}, tok, value)
+	rethrow(err)
+	return str
+}
@@ -0,0 +1,68 @@
+package closure
+
+import (
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/heap"
+	"github.com/mkeesey/craftinginterpreters/pkg/token"
+)
+
+// runtime runs the built-in values package ast shares between backends,
+// such as lists and maps, on the interpreter. They report runtime errors by
+// returning them, so it turns the interpreter's thrown errors into returned
+// ones and rethrow turns them back.
+type runtime struct {
+	in *Interpreter
+}
+
+func (rt runtime) Call(callee Value, paren *token.Token, args []Value) (Value, error) {
+	return rt.catch(func() Value { return rt.in.call(callee, paren, args) })
+}
+
+func (rt runtime) Method(value Value, name string, tok *token.Token) (Value, error) {
+	instance, ok := value.(*instance)
+	if !ok {
+		return nil, nil
+	}
+	method := instance.class.findMethod(name)
+	if method == nil {
+		return nil, nil
+	}
+	return rt.catch(func() Value { return method.bind(rt.in, instance, tok) })
+}
+
+// catch runs f, returning the runtime error it throws.
+func (rt runtime) catch(f func() Value) (result Value, err error) {
+	depth := rt.in.depth()
+	defer func() {
+		if r := recover(); r != nil {
+			runtimeErr, ok := r.(failure.RuntimeError)
+			if !ok {
+				panic(r)
+			}
+			result, err = nil, rt.in.unwind(runtimeErr, depth)
+		}
+	}()
+	return f(), nil
+}
+
+func (rt runtime) Allocate(kind heap.Kind, size int, tok *token.Token) error {
+	if err := rt.in.heap.Allocate(kind, size); err != nil {
+		return failure.RuntimeError{Token: tok, Message: err.Error()}
+	}
+	return nil
+}
+
+func (rt runtime) Grow(size int, tok *token.Token) error {
+	if err := rt.in.heap.Grow(size); err != nil {
+		return failure.RuntimeError{Token: tok, Message: err.Error()}
+	}
+	return nil
+}
+
+// rethrow throws err, returned by package ast, as a runtime error of this
+// interpreter.
+func rethrow(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
@@ -1,7 +1,9 @@
 package failure
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
@@ -11,61 +13,143 @@ import (
 type RuntimeError struct {
 	Token   *token.Token
 	Message string
+	// Thrown is set for errors raised by a throw statement, which threw
+	// Value
+	Thrown bool
+	Value  interface{}
+	// Fatal errors, such as interrupts, can't be caught
+	Fatal bool
+	// Trace lists the calls the error unwound out of, innermost first
+	Trace []Frame
 }
 
 func (r RuntimeError) Error() string {
 	return r.Message
 }
 
+// Frame is a call in a stack trace.
+type Frame struct {
+	// Function is the name of the function called, or for the top-level
+	// code of an imported module, the module's name
+	Function string
+	Module   bool
+	// File and Line locate the call
+	File string
+	Line int
+}
+
+// Call returns the frame for a call of function at tok.
+func Call(function string, tok *token.Token) Frame {
+	return Frame{Function: function, File: tok.File, Line: tok.Line}
+}
+
+func (f Frame) String() string {
+	if f.Module {
+		return "module " + f.Function
+	}
+	return f.Function + "()"
+}
+
+// Unwind adds frame to err's stack trace, if err is a RuntimeError.
+func Unwind(err error, frame Frame) error {
+	runtimeErr, ok := err.(RuntimeError)
+	if !ok {
+		return err
+	}
+	runtimeErr.Trace = append(runtimeErr.Trace, frame)
+	return runtimeErr
+}
+
+// location describes a line of source, naming its file if it has one.
+func location(file string, line int) string {
+	if file == "" {
+		return fmt.Sprintf("line %d", line)
+	}
+	return fmt.Sprintf("%s:%d", file, line)
+}
+
 func Error(line int, message string) error {
 	return Report(line, "", message)
 }
 
 func TokenError(tok *token.Token, message string) error {
 	if tok.Type == token.EOF {
-		return Report(tok.Line, "at end", message)
+		return report(tok.File, tok.Line, "at end", message)
 	} else {
-		return Report(tok.Line, fmt.Sprintf("at '%s'", tok.Lexeme), message)
+		return report(tok.File, tok.Line, fmt.Sprintf("at '%s'", tok.Lexeme), message)
 	}
 }
 
 func Report(line int, where string, message string) error {
+	return report("", line, where, message)
+}
+
+func report(file string, line int, where string, message string) error {
 	whereStr := strings.TrimSuffix(where, "\n")
-	return fmt.Errorf("[line %d] Error %s: %s", line, whereStr, message)
+	return fmt.Errorf("[%s] Error %s: %s", location(file, line), whereStr, message)
 }
 
 func Wrap(line int, message string, err error) error {
 	return fmt.Errorf("[line %d] Error %s: %w", line, message, err)
 }
 
+// Reporter prints compile and runtime errors and remembers whether there
+// were any. The zero value prints to stderr.
 type Reporter struct {
 	hasFailed bool
+	out       io.Writer
+}
+
+// NewReporter returns a Reporter that prints errors to out.
+func NewReporter(out io.Writer) *Reporter {
+	return &Reporter{out: out}
+}
+
+func (r *Reporter) output() io.Writer {
+	if r.out == nil {
+		return os.Stderr
+	}
+	return r.out
 }
 
 func (r *Reporter) Error(line int, message string) {
 	r.Report(line, "", message)
 }
 
+// FileError reports an error on a line of file.
+func (r *Reporter) FileError(file string, line int, message string) {
+	r.report(file, line, "", message)
+}
+
+// ColumnError reports an error at a column of a line of file.
+func (r *Reporter) ColumnError(file string, line int, column int, message string) {
+	r.report(file, line, fmt.Sprintf("at column %d", column), message)
+}
+
 func (r *Reporter) TokenError(tok *token.Token, message string) {
 	if tok.Type == token.EOF {
-		r.Report(tok.Line, "at end", message)
+		r.report(tok.File, tok.Line, "at end", message)
 	} else {
-		r.Report(tok.Line, fmt.Sprintf("at '%s'", tok.Lexeme), message)
+		r.report(tok.File, tok.Line, fmt.Sprintf("at '%s'", tok.Lexeme), message)
 	}
 }
 
 func (r *Reporter) Report(line int, where string, message string) {
+	r.report("", line, where, message)
+}
+
+func (r *Reporter) report(file string, line int, where string, message string) {
 	whereStr := strings.TrimSuffix(where, "\n")
 	if len(whereStr) > 0 {
-		fmt.Fprintf(os.Stderr, "[line %d] Error %s: %s\n", line, whereStr, message)
+		fmt.Fprintf(r.output(), "[%s] Error %s: %s\n", location(file, line), whereStr, message)
 	} else {
-		fmt.Fprintf(os.Stderr, "[line %d] Error: %s\n", line, message)
+		fmt.Fprintf(r.output(), "[%s] Error: %s\n", location(file, line), message)
 	}
 	r.hasFailed = true
 }
 
 func (r *Reporter) ReportErr(line int, message string, err error) {
-	fmt.Fprintf(os.Stderr, "[line %d] Error %s: %s\n", line, message, err)
+	fmt.Fprintf(r.output(), "[line %d] Error %s: %s\n", line, message, err)
 	r.hasFailed = true
 }
 
@@ -74,13 +158,21 @@ func (r *Reporter) Panic(line int, err error) {
 	panic(fmt.Sprintf("line %d: %s", line, err))
 }
 
-func (r *Reporter) RuntimeError(panicmsg any) {
+func (r *Reporter) RuntimeError(err error) {
 	r.hasFailed = true
 
-	if runtimeErr, ok := panicmsg.(RuntimeError); ok {
-		fmt.Fprintf(os.Stderr, "%s\n[line %d]\n", runtimeErr.Message, runtimeErr.Token.Line)
+	var runtimeErr RuntimeError
+	if errors.As(err, &runtimeErr) {
+		fmt.Fprintf(r.output(), "%s\n", runtimeErr.Message)
+		// each line is in the code the next frame called
+		file, line := runtimeErr.Token.File, runtimeErr.Token.Line
+		for _, frame := range runtimeErr.Trace {
+			fmt.Fprintf(r.output(), "[%s] in %s\n", location(file, line), frame)
+			file, line = frame.File, frame.Line
+		}
+		fmt.Fprintf(r.output(), "[%s] in script\n", location(file, line))
 	} else {
-		fmt.Fprintf(os.Stderr, "Error: %s\n", panicmsg)
+		fmt.Fprintf(r.output(), "Error: %s\n", err)
 	}
 }
 
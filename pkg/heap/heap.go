@@ -0,0 +1,232 @@
+package heap
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// ErrOutOfMemory is returned when an allocation would take the heap past its
+// limit. Its text is the message of the Lox runtime error.
+var ErrOutOfMemory = errors.New("Out of memory.")
+
+type Kind int
+
+const (
+	String Kind = iota
+	Instance
+	Closure
+	Environment
+	Function
+	Class
+	Fiber
+	List
+	Map
+)
+
+func (k Kind) String() string {
+	switch k {
+	case String:
+		return "string"
+	case Instance:
+		return "instance"
+	case Closure:
+		return "closure"
+	case Environment:
+		return "environment"
+	case Function:
+		return "function"
+	case Class:
+		return "class"
+	case Fiber:
+		return "fiber"
+	case List:
+		return "list"
+	case Map:
+		return "map"
+	default:
+		return "unknown"
+	}
+}
+
+// Estimated sizes in bytes. Lox objects are Go values, so these are not exact
+// but are stable across runs, which keeps limits deterministic.
+const (
+	StringHeaderSize = 16
+	InstanceSize     = 32
+	FieldSize        = 32
+	ClosureSize      = 32
+	UpvalueSize      = 8
+	EnvironmentSize  = 32
+	VariableSize     = 32
+	FunctionSize     = 64
+	ClassSize        = 48
+	FiberSize        = 128
+	ListSize         = 32
+	ElementSize      = 16
+	MapSize          = 48
+	EntrySize        = 32
+)
+
+func StringSize(s string) int {
+	return StringHeaderSize + len(s)
+}
+
+// Stats is a snapshot of what a script has allocated. Objects that have died
+// are counted until the heap frees or measures them.
+type Stats struct {
+	// BytesAllocated is the estimated size of everything charged to the heap.
+	BytesAllocated int
+	// MaxHeap is the configured limit, or zero when there is none.
+	MaxHeap int
+
+	// Objects of each kind currently charged to the heap.
+	Strings      int
+	Instances    int
+	Closures     int
+	Environments int
+	Functions    int
+	Classes      int
+	Fibers       int
+	Lists        int
+	Maps         int
+}
+
+// Heap accounts for Lox-level allocations and enforces the configured limit.
+// The zero value is an unlimited heap.
+//
+// The bytecode VM frees what its collector reclaims. The tree-walking
+// interpreters can't see Go's collector reclaim their objects, so they add
+// roots instead: when an allocation would go over the limit, the heap
+// measures what the roots can still reach and counts only that.
+type Heap struct {
+	stats Stats
+	// roots mark the live objects of each interpreter using the heap, the
+	// one running last
+	roots []func(m *Marker)
+}
+
+func New(maxHeap int) *Heap {
+	return &Heap{stats: Stats{MaxHeap: maxHeap}}
+}
+
+// Allocate charges size bytes for a new object of kind.
+func (h *Heap) Allocate(kind Kind, size int) error {
+	if err := h.Grow(size); err != nil {
+		return err
+	}
+
+	*h.stats.count(kind)++
+	return nil
+}
+
+// Grow charges size bytes to an object that already exists, such as a field
+// added to an instance.
+func (h *Heap) Grow(size int) error {
+	if h.over(size) && len(h.roots) > 0 {
+		h.measure()
+	}
+	if h.over(size) {
+		return ErrOutOfMemory
+	}
+	h.stats.BytesAllocated += size
+	return nil
+}
+
+// Free returns the size bytes of a collected object of kind to the heap.
+func (h *Heap) Free(kind Kind, size int) {
+	h.stats.BytesAllocated -= size
+	*h.stats.count(kind)--
+}
+
+// PushRoots adds the roots of an interpreter starting to use the heap, such
+// as one running an imported module.
+func (h *Heap) PushRoots(roots func(m *Marker)) {
+	h.roots = append(h.roots, roots)
+}
+
+// PopRoots removes the roots added last, once their interpreter has
+// finished.
+func (h *Heap) PopRoots() {
+	h.roots = h.roots[:len(h.roots)-1]
+}
+
+func (h *Heap) over(size int) bool {
+	return h.stats.MaxHeap > 0 && h.stats.BytesAllocated+size > h.stats.MaxHeap
+}
+
+// measure replaces the counts with those of the objects the roots reach.
+func (h *Heap) measure() {
+	m := &Marker{stats: Stats{MaxHeap: h.stats.MaxHeap}, seen: make(map[interface{}]bool)}
+	for _, roots := range h.roots {
+		roots(m)
+	}
+	h.stats = m.stats
+}
+
+// Marker counts the live objects of an interpreter as its roots walk them.
+// Each object is counted at the size it was charged.
+type Marker struct {
+	stats Stats
+	seen  map[interface{}]bool
+}
+
+// Visit reports whether object, a pointer, is reached for the first time.
+// Only then are it and what it references counted.
+func (m *Marker) Visit(object interface{}) bool {
+	if m.seen[object] {
+		return false
+	}
+	m.seen[object] = true
+	return true
+}
+
+// String counts s unless a copy of it, which shares its bytes, has been.
+func (m *Marker) String(s string) {
+	if s == "" {
+		return
+	}
+	type chars struct {
+		data *byte
+		len  int
+	}
+	if m.Visit(chars{unsafe.StringData(s), len(s)}) {
+		m.Count(String, StringSize(s))
+	}
+}
+
+// Count counts a live object of kind that takes size bytes.
+func (m *Marker) Count(kind Kind, size int) {
+	m.stats.BytesAllocated += size
+	*m.stats.count(kind)++
+}
+
+func (s *Stats) count(kind Kind) *int {
+	switch kind {
+	case String:
+		return &s.Strings
+	case Instance:
+		return &s.Instances
+	case Closure:
+		return &s.Closures
+	case Environment:
+		return &s.Environments
+	case Function:
+		return &s.Functions
+	case Class:
+		return &s.Classes
+	case List:
+		return &s.Lists
+	case Map:
+		return &s.Maps
+	default:
+		return &s.Fibers
+	}
+}
+
+func (h *Heap) SetMaxHeap(maxHeap int) {
+	h.stats.MaxHeap = maxHeap
+}
+
+func (h *Heap) Stats() Stats {
+	return h.stats
+}
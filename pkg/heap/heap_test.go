@@ -0,0 +1,63 @@
+package heap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeap(t *testing.T) {
+	t.Run("unlimited", func(t *testing.T) {
+		h := &Heap{}
+		require.NoError(t, h.Allocate(String, 1<<30))
+		require.NoError(t, h.Allocate(Instance, InstanceSize))
+		require.NoError(t, h.Grow(FieldSize))
+
+		stats := h.Stats()
+		require.Equal(t, 1<<30+InstanceSize+FieldSize, stats.BytesAllocated)
+		require.Equal(t, 1, stats.Strings)
+		require.Equal(t, 1, stats.Instances)
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		h := New(100)
+		require.NoError(t, h.Allocate(Closure, 60))
+		require.ErrorIs(t, h.Allocate(Closure, 60), ErrOutOfMemory)
+		require.ErrorIs(t, h.Grow(41), ErrOutOfMemory)
+		require.NoError(t, h.Grow(40))
+
+		stats := h.Stats()
+		require.Equal(t, 100, stats.BytesAllocated)
+		require.Equal(t, 1, stats.Closures)
+	})
+
+	t.Run("free", func(t *testing.T) {
+		h := New(100)
+		require.NoError(t, h.Allocate(Class, 60))
+		h.Free(Class, 60)
+		require.NoError(t, h.Allocate(Class, 60))
+
+		stats := h.Stats()
+		require.Equal(t, 60, stats.BytesAllocated)
+		require.Equal(t, 1, stats.Classes)
+	})
+
+	t.Run("roots", func(t *testing.T) {
+		h := New(100)
+		live := "waffles"
+		h.PushRoots(func(m *Marker) {
+			m.String(live)
+			m.String(live)
+		})
+		require.NoError(t, h.Allocate(String, 60))
+		// measuring finds only live, so the garbage doesn't count
+		require.NoError(t, h.Allocate(String, 60))
+
+		stats := h.Stats()
+		require.Equal(t, StringSize(live)+60, stats.BytesAllocated)
+		require.Equal(t, 2, stats.Strings)
+
+		h.PopRoots()
+		require.ErrorIs(t, h.Allocate(String, 60), ErrOutOfMemory)
+	})
+}
@@ -0,0 +1,130 @@
+package lox
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/ast"
+	"github.com/mkeesey/craftinginterpreters/pkg/bytecode"
+	"github.com/mkeesey/craftinginterpreters/pkg/closure"
+	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/parser"
+	"github.com/mkeesey/craftinginterpreters/pkg/scanner"
+)
+
+// astInterpreter is what the tree-walk and closure interpreters have in
+// common.
+type astInterpreter interface {
+	ast.LocalResolver
+	Eval(statements []ast.Stmt) interface{}
+	DefineGlobal(name string, value interface{})
+	DefineNative(name string, fn interface{}) error
+	Global(name string) (interface{}, bool)
+	SetModuleLoader(loader *ast.ModuleLoader)
+	SetOutput(w io.Writer)
+	SetInterrupt(done <-chan struct{})
+	SetMaxHeap(bytes int)
+}
+
+type astBackend struct {
+	interpreter astInterpreter
+	reporter    *failure.Reporter
+	stderr      io.Writer
+}
+
+func newASTBackend(opts Options, stderr io.Writer) *astBackend {
+	reporter := failure.NewReporter(stderr)
+	var interpreter astInterpreter
+	if opts.Backend == Closures {
+		interpreter = closure.NewInterpreter(reporter)
+	} else {
+		interpreter = ast.NewInterpreter(reporter)
+	}
+	interpreter.SetOutput(opts.Stdout)
+	interpreter.SetMaxHeap(opts.MaxHeap)
+	interpreter.SetModuleLoader(ast.NewModuleLoader(opts.ModulePaths, func(file string) ([]ast.Stmt, error) {
+		return parser.ParseFile(file, reporter)
+	}))
+	return &astBackend{interpreter: interpreter, reporter: reporter, stderr: stderr}
+}
+
+func (b *astBackend) eval(file string, source string) (Value, error) {
+	b.reporter.Reset()
+	tokens := scanner.NewFileScanner(strings.NewReader(source), file, b.reporter).ScanTokens()
+	statements, err := parser.NewParser(tokens, b.reporter).Parse()
+	if err != nil {
+		fmt.Fprintln(b.stderr, err)
+		return nil, ErrCompile
+	}
+	if b.reporter.HasFailed() {
+		return nil, ErrCompile
+	}
+
+	ast.NewResolver(b.interpreter, b.reporter).Resolve(statements)
+	if b.reporter.HasFailed() {
+		return nil, ErrCompile
+	}
+
+	value := b.interpreter.Eval(statements)
+	if b.reporter.HasFailed() {
+		return nil, ErrRuntime
+	}
+	return value, nil
+}
+
+func (b *astBackend) define(name string, value Value) error {
+	b.interpreter.DefineGlobal(name, value)
+	return nil
+}
+
+func (b *astBackend) defineNative(name string, fn interface{}) error {
+	return b.interpreter.DefineNative(name, fn)
+}
+
+func (b *astBackend) get(name string) (Value, bool) {
+	return b.interpreter.Global(name)
+}
+
+func (b *astBackend) setInterrupt(done <-chan struct{}) {
+	b.interpreter.SetInterrupt(done)
+}
+
+type vmBackend struct {
+	vm *bytecode.VM
+}
+
+func newVMBackend(opts Options, stderr io.Writer) *vmBackend {
+	vm := bytecode.NewVM()
+	vm.SetOutput(opts.Stdout)
+	vm.SetErrorOutput(stderr)
+	vm.SetMaxHeap(opts.MaxHeap)
+	return &vmBackend{vm: vm}
+}
+
+func (b *vmBackend) eval(file string, source string) (Value, error) {
+	value, err := b.vm.Eval(source)
+	if errors.Is(err, bytecode.ErrCompileError) {
+		return nil, ErrCompile
+	} else if err != nil {
+		return nil, ErrRuntime
+	}
+	return value, nil
+}
+
+func (b *vmBackend) define(name string, value Value) error {
+	return b.vm.DefineGlobal(name, value)
+}
+
+func (b *vmBackend) defineNative(name string, fn interface{}) error {
+	return b.vm.DefineNative(name, fn)
+}
+
+func (b *vmBackend) get(name string) (Value, bool) {
+	return b.vm.Global(name)
+}
+
+func (b *vmBackend) setInterrupt(done <-chan struct{}) {
+	b.vm.SetInterrupt(done)
+}
@@ -0,0 +1,374 @@
+package lox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/native"
+)
+
+// instance is a Lox instance whose fields can be decoded. The tree-walk and
+// closure backends' instances implement it.
+type instance interface {
+	ClassName() string
+	Fields() map[string]interface{}
+}
+
+// list is a Lox list, as the tree-walk and closure backends implement it.
+type list interface {
+	Elements() []interface{}
+}
+
+// dict is a Lox map, as the tree-walk and closure backends implement it.
+type dict interface {
+	Keys() []interface{}
+	Lookup(key interface{}) (interface{}, bool)
+}
+
+// DecodeError is a value that could not be decoded into its Go type. Path
+// locates the value, such as server.ports[1].
+type DecodeError struct {
+	Path    string
+	Message string
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("lox: %s %s", e.Path, e.Message)
+}
+
+// Unmarshal runs script on a new tree-walk interpreter and decodes the
+// result into v, as Interpreter.Unmarshal does. Errors in the script are
+// returned rather than printed.
+func Unmarshal(script string, v interface{}) error {
+	l := New(Options{Stderr: io.Discard})
+	return l.Unmarshal(context.Background(), script, v)
+}
+
+// Unmarshal runs script and decodes its result into v, which must be a
+// non-nil pointer. The value of the expression statement ending the script
+// is decoded, unless v points to a struct and the value is not an instance
+// or map, as when a script ends by assigning a field. Then each field of the
+// struct is decoded from the global of the same name.
+//
+// Struct fields are matched by their `lox:"name"` tag, or by their Go name.
+// A tag of "-" skips the field, and Lox fields with no matching Go field are
+// ignored, as are Go fields with no matching Lox field. Instances and maps
+// decode into structs and Go maps, lists into slices and arrays, and numbers
+// into any Go number type that holds them exactly. A value that contains
+// itself, such as an instance with a field referring back to it, is an
+// error. The bytecode backend only exports snapshots of its instances, so
+// they can't be decoded.
+func (l *Interpreter) Unmarshal(ctx context.Context, script string, v interface{}) error {
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return fmt.Errorf("lox: Unmarshal needs a non-nil pointer, not %T", v)
+	}
+
+	result, err := l.Eval(ctx, script)
+	if err != nil {
+		return err
+	}
+	elem := target.Elem()
+	_, isInstance := result.(instance)
+	_, isDict := result.(dict)
+	d := &decoder{visiting: make(map[interface{}]bool)}
+	if elem.Kind() != reflect.Struct || isInstance || isDict {
+		return d.decode(result, elem, "result")
+	}
+	return d.decodeStruct(elem, "", func(name string) (interface{}, bool) {
+		return l.Get(name)
+	})
+}
+
+// decoder decodes one Lox value into Go.
+type decoder struct {
+	// visiting holds the instances, lists and maps being decoded, from the
+	// root down to the current value, so that cycles can be detected
+	visiting map[interface{}]bool
+}
+
+// enter marks value as being decoded until leave is called, failing if it
+// already is, which means it contains itself.
+func (d *decoder) enter(value interface{}, path string) (leave func(), err error) {
+	switch value.(type) {
+	case instance, list, dict:
+	default:
+		return func() {}, nil
+	}
+	if reflect.ValueOf(value).Kind() != reflect.Pointer {
+		return func() {}, nil
+	}
+	if d.visiting[value] {
+		return nil, &DecodeError{Path: path, Message: "refers back to a value containing it."}
+	}
+	d.visiting[value] = true
+	return func() { delete(d.visiting, value) }, nil
+}
+
+// decode stores value in target, which must be settable.
+func (d *decoder) decode(value interface{}, target reflect.Value, path string) error {
+	leave, err := d.enter(value, path)
+	if err != nil {
+		return err
+	}
+	defer leave()
+	return d.decodeValue(value, target, path)
+}
+
+// decodeValue is decode for a value already marked as being decoded.
+func (d *decoder) decodeValue(value interface{}, target reflect.Value, path string) error {
+	switch target.Kind() {
+	case reflect.Interface:
+		if target.NumMethod() > 0 {
+			break
+		}
+		generic, err := d.toGeneric(value, path)
+		if err != nil {
+			return err
+		}
+		target.Set(reflect.ValueOf(generic))
+		return nil
+	case reflect.Pointer:
+		if value == nil {
+			target.Set(reflect.Zero(target.Type()))
+			return nil
+		}
+		if target.IsNil() {
+			target.Set(reflect.New(target.Type().Elem()))
+		}
+		return d.decodeValue(value, target.Elem(), path)
+	case reflect.Struct:
+		switch object := value.(type) {
+		case instance:
+			fields := object.Fields()
+			return d.decodeStruct(target, path+".", func(name string) (interface{}, bool) {
+				value, ok := fields[name]
+				return value, ok
+			})
+		case dict:
+			return d.decodeStruct(target, path+".", func(name string) (interface{}, bool) {
+				return object.Lookup(name)
+			})
+		}
+		return mismatch(path, "an instance or map", value)
+	case reflect.Map:
+		return d.decodeMap(value, target, path)
+	case reflect.Slice, reflect.Array:
+		return d.decodeSlice(value, target, path)
+	}
+
+	converted, err := native.ToGo(value, target.Type())
+	if err != nil {
+		return mismatch(path, native.Describe(target.Type()), value)
+	}
+	target.Set(converted)
+	return nil
+}
+
+// decodeStruct decodes each field of target that lookup finds. prefix
+// starts the path of every field.
+func (d *decoder) decodeStruct(target reflect.Value, prefix string, lookup func(name string) (interface{}, bool)) error {
+	t := target.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("lox"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" && field.Anonymous && field.Type.Kind() == reflect.Struct {
+			// embedded structs share the enclosing instance's fields
+			if err := d.decodeStruct(target.Field(i), prefix, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := d.decode(value, target.Field(i), prefix+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *decoder) decodeMap(value interface{}, target reflect.Value, path string) error {
+	t := target.Type()
+	entries := make(map[interface{}]interface{})
+	if object, ok := value.(instance); ok {
+		for name, field := range object.Fields() {
+			entries[name] = field
+		}
+	} else if object, ok := value.(dict); ok {
+		for _, key := range object.Keys() {
+			entries[key], _ = object.Lookup(key)
+		}
+	} else if v := reflect.ValueOf(value); v.Kind() == reflect.Map {
+		iter := v.MapRange()
+		for iter.Next() {
+			entries[native.FromGo(iter.Key())] = native.FromGo(iter.Value())
+		}
+	} else {
+		return mismatch(path, "an instance or map", value)
+	}
+
+	result := reflect.MakeMapWithSize(t, len(entries))
+	for key, entry := range entries {
+		keyPath := fmt.Sprintf("%s[%s]", path, formatKey(key))
+		goKey, err := native.ToGo(key, t.Key())
+		if err != nil {
+			return &DecodeError{Path: keyPath, Message: fmt.Sprintf("key must be %s.", native.Describe(t.Key()))}
+		}
+		elem := reflect.New(t.Elem()).Elem()
+		if err := d.decode(entry, elem, keyPath); err != nil {
+			return err
+		}
+		result.SetMapIndex(goKey, elem)
+	}
+	target.Set(result)
+	return nil
+}
+
+func (d *decoder) decodeSlice(value interface{}, target reflect.Value, path string) error {
+	if l, ok := value.(list); ok {
+		value = l.Elements()
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return mismatch(path, "a list", value)
+	}
+
+	n := v.Len()
+	if target.Kind() == reflect.Array {
+		if n != target.Len() {
+			return &DecodeError{Path: path, Message: fmt.Sprintf("must have %d elements, not %d.", target.Len(), n)}
+		}
+	} else {
+		target.Set(reflect.MakeSlice(target.Type(), n, n))
+	}
+	for i := 0; i < n; i++ {
+		if err := d.decode(native.FromGo(v.Index(i)), target.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toGeneric converts instances and Lox maps to Go maps and lists to slices,
+// recursively, for decoding into an interface{}.
+func (d *decoder) toGeneric(value interface{}, path string) (interface{}, error) {
+	switch v := value.(type) {
+	case instance:
+		fields := v.Fields()
+		generic := make(map[string]interface{}, len(fields))
+		for name, field := range fields {
+			converted, err := d.generic(field, path+"."+name)
+			if err != nil {
+				return nil, err
+			}
+			generic[name] = converted
+		}
+		return generic, nil
+	case list:
+		elements := v.Elements()
+		for i, element := range elements {
+			converted, err := d.generic(element, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = converted
+		}
+		return elements, nil
+	case dict:
+		keys := v.Keys()
+		generic := make(map[string]interface{}, len(keys))
+		for _, key := range keys {
+			name, ok := key.(string)
+			if !ok {
+				return d.toGenericAnyKeys(v, path)
+			}
+			entry, _ := v.Lookup(key)
+			converted, err := d.generic(entry, fmt.Sprintf("%s[%s]", path, formatKey(key)))
+			if err != nil {
+				return nil, err
+			}
+			generic[name] = converted
+		}
+		return generic, nil
+	}
+	return value, nil
+}
+
+// generic is toGeneric for a value nested in the one being converted.
+func (d *decoder) generic(value interface{}, path string) (interface{}, error) {
+	leave, err := d.enter(value, path)
+	if err != nil {
+		return nil, err
+	}
+	defer leave()
+	return d.toGeneric(value, path)
+}
+
+// toGenericAnyKeys converts a map with keys that aren't all strings.
+func (d *decoder) toGenericAnyKeys(object dict, path string) (map[interface{}]interface{}, error) {
+	keys := object.Keys()
+	generic := make(map[interface{}]interface{}, len(keys))
+	for _, key := range keys {
+		entry, _ := object.Lookup(key)
+		converted, err := d.generic(entry, fmt.Sprintf("%s[%s]", path, formatKey(key)))
+		if err != nil {
+			return nil, err
+		}
+		generic[key] = converted
+	}
+	return generic, nil
+}
+
+func mismatch(path string, expected string, value interface{}) error {
+	return &DecodeError{Path: path, Message: fmt.Sprintf("must be %s, not %s.", expected, describeValue(value))}
+}
+
+// describeValue names the type of a Lox value for error messages.
+func describeValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "a boolean"
+	case float64:
+		return "a number"
+	case string:
+		return "a string"
+	case instance:
+		return "a " + v.ClassName() + " instance"
+	case list:
+		return "a list"
+	case dict:
+		return "a map"
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	case reflect.Map:
+		return "a map"
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func formatKey(key interface{}) string {
+	if s, ok := key.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprintf("%v", key)
+}
@@ -0,0 +1,209 @@
+package lox_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/lox"
+	"github.com/stretchr/testify/require"
+)
+
+type listener struct {
+	Host string `lox:"host"`
+	Port uint16 `lox:"port"`
+}
+
+type config struct {
+	Name     string             `lox:"name"`
+	Debug    bool               `lox:"debug"`
+	Workers  int                `lox:"workers"`
+	Ratio    float64            `lox:"ratio"`
+	Listen   *listener          `lox:"listen"`
+	Limits   map[string]float64 `lox:"limits"`
+	Extra    interface{}        `lox:"extra"`
+	Ports    []int              `lox:"ports"`
+	Internal string             `lox:"-"`
+}
+
+func TestUnmarshalResult(t *testing.T) {
+	var cfg config
+	cfg.Internal = "kept"
+	err := lox.Unmarshal(`
+class Listener {
+  init(host, port) {
+    this.host = host;
+    this.port = port;
+  }
+}
+class Limits {}
+class Config {
+  init() {
+    this.name = "waffles";
+    this.debug = true;
+    this.workers = 2 * 4;
+    this.ratio = 0.5;
+    this.listen = Listener("localhost", 8080);
+    this.limits = Limits();
+    this.limits.memory = 64;
+    this.limits.cpu = 1.5;
+    this.extra = Limits();
+    this.extra.nested = [1, "two"];
+    this.ports = [80, 443];
+    this.Internal = "overwritten";
+    this.unused = nil;
+  }
+}
+Config();
+`, &cfg)
+	require.NoError(t, err)
+	require.Equal(t, config{
+		Name:     "waffles",
+		Debug:    true,
+		Workers:  8,
+		Ratio:    0.5,
+		Listen:   &listener{Host: "localhost", Port: 8080},
+		Limits:   map[string]float64{"memory": 64, "cpu": 1.5},
+		Extra:    map[string]interface{}{"nested": []interface{}{1.0, "two"}},
+		Ports:    []int{80, 443},
+		Internal: "kept",
+	}, cfg)
+}
+
+func TestUnmarshalGlobals(t *testing.T) {
+	for _, backend := range []lox.Backend{lox.TreeWalk, lox.Closures} {
+		t.Run(backend.String(), func(t *testing.T) {
+			l, _, _ := newInterpreter(backend)
+			require.NoError(t, l.Define("ports", []int{80, 443}))
+
+			var cfg struct {
+				Name   string   `lox:"name"`
+				Ports  []uint16 `lox:"ports"`
+				Listen listener `lox:"listen"`
+				Absent string   `lox:"absent"`
+			}
+			cfg.Absent = "untouched"
+			err := l.Unmarshal(context.Background(), `
+var name = "tacos";
+class Listener {}
+var listen = Listener();
+listen.host = "0.0.0.0";
+listen.port = 53;
+`, &cfg)
+			require.NoError(t, err)
+			require.Equal(t, "tacos", cfg.Name)
+			require.Equal(t, []uint16{80, 443}, cfg.Ports)
+			require.Equal(t, listener{Host: "0.0.0.0", Port: 53}, cfg.Listen)
+			require.Equal(t, "untouched", cfg.Absent)
+		})
+	}
+}
+
+func TestUnmarshalMaps(t *testing.T) {
+	for _, backend := range []lox.Backend{lox.TreeWalk, lox.Closures} {
+		t.Run(backend.String(), func(t *testing.T) {
+			l, _, _ := newInterpreter(backend)
+			var cfg struct {
+				Listen  listener           `lox:"listen"`
+				Limits  map[string]float64 `lox:"limits"`
+				Weights map[int]string     `lox:"weights"`
+				Extra   interface{}        `lox:"extra"`
+			}
+			err := l.Unmarshal(context.Background(), `
+var listen = {"host": "localhost", "port": 8080, "ignored": true};
+var limits = {"memory": 64, "cpu": 1.5};
+var weights = {1: "light", 10: "heavy"};
+var extra = {"tags": ["a", "b"], 2: nil};
+`, &cfg)
+			require.NoError(t, err)
+			require.Equal(t, listener{Host: "localhost", Port: 8080}, cfg.Listen)
+			require.Equal(t, map[string]float64{"memory": 64, "cpu": 1.5}, cfg.Limits)
+			require.Equal(t, map[int]string{1: "light", 10: "heavy"}, cfg.Weights)
+			require.Equal(t, map[interface{}]interface{}{"tags": []interface{}{"a", "b"}, 2.0: nil}, cfg.Extra)
+
+			var limits map[string]int
+			err = l.Unmarshal(context.Background(), `limits;`, &limits)
+			require.EqualError(t, err, `lox: result["cpu"] must be an integer, not a number.`)
+		})
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		err    string
+	}{
+		{"field", `class C { init() { this.workers = "many"; } } C();`, "lox: result.workers must be an integer, not a string."},
+		{"fraction", `class C { init() { this.workers = 1.5; } } C();`, "lox: result.workers must be an integer, not a number."},
+		{"nested", `
+class L { init() { this.port = -1; } }
+class C { init() { this.listen = L(); } }
+C();`, "lox: result.listen.port must be a non-negative integer, not a number."},
+		{"map value", `
+class Limits { init() { this.memory = true; } }
+class C { init() { this.limits = Limits(); } }
+C();`, `lox: result.limits["memory"] must be a number, not a boolean.`},
+		{"list element", `class C { init() { this.ports = [80, "443"]; } } C();`, "lox: result.ports[1] must be an integer, not a string."},
+		{"list", `class C { init() { this.ports = 80; } } C();`, "lox: result.ports must be a list, not a number."},
+		{"instance", `
+class L {}
+class C { init() { this.name = L(); } }
+C();`, "lox: result.name must be a string, not a L instance."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg config
+			err := lox.Unmarshal(tt.script, &cfg)
+			require.EqualError(t, err, tt.err)
+			var decodeErr *lox.DecodeError
+			require.True(t, errors.As(err, &decodeErr))
+		})
+	}
+
+	var n int
+	require.EqualError(t, lox.Unmarshal(`"waffles";`, &n), "lox: result must be an integer, not a string.")
+
+	var cfg config
+	require.Error(t, lox.Unmarshal(`var x = 1;`, cfg))
+	require.ErrorIs(t, lox.Unmarshal(`var x = ;`, &cfg), lox.ErrCompile)
+	require.ErrorIs(t, lox.Unmarshal(`nil + 1;`, &cfg), lox.ErrRuntime)
+}
+
+type node struct {
+	Name string
+	Next *node
+}
+
+func TestUnmarshalCycles(t *testing.T) {
+	cycle := `
+class Node { init(name) { this.Name = name; } }
+var a = Node("a");
+var b = Node("b");
+a.Next = b;
+b.Next = a;
+a;`
+
+	var n node
+	err := lox.Unmarshal(cycle, &n)
+	require.EqualError(t, err, "lox: result.Next.Next refers back to a value containing it.")
+	var decodeErr *lox.DecodeError
+	require.True(t, errors.As(err, &decodeErr))
+
+	var generic interface{}
+	err = lox.Unmarshal(cycle, &generic)
+	require.EqualError(t, err, "lox: result.Next.Next refers back to a value containing it.")
+
+	var list []interface{}
+	err = lox.Unmarshal(`var l = [1]; l.append(l); l;`, &list)
+	require.EqualError(t, err, "lox: result[1] refers back to a value containing it.")
+
+	// A value reached twice without containing itself is not a cycle.
+	var shared struct{ Left, Right node }
+	require.NoError(t, lox.Unmarshal(`
+class Node { init(name) { this.Name = name; } }
+class Pair { init(n) { this.Left = n; this.Right = n; } }
+Pair(Node("leaf"));`, &shared))
+	require.Equal(t, "leaf", shared.Left.Name)
+	require.Equal(t, "leaf", shared.Right.Name)
+}
@@ -0,0 +1,231 @@
+// Package lox embeds Lox in Go programs. It wires the scanner, parser,
+// resolver and one of the backends together so a host only has to create an
+// Interpreter and hand it source.
+package lox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/ast"
+	"github.com/mkeesey/craftinginterpreters/pkg/native"
+)
+
+type Backend int
+
+const (
+	// TreeWalk walks the resolved AST.
+	TreeWalk Backend = iota
+	// Closures compiles the resolved AST into Go closures before running it.
+	Closures
+	// Bytecode compiles to bytecode for the VM. The VM has no lists, maps
+	// or exceptions and doesn't load modules, so scripts using list or map
+	// literals, index assignment, throw, try, import or export fail to
+	// compile on it. Indexing works only on instances with an __index__
+	// method, and stdlib.Install leaves out the natives that return lists.
+	Bytecode
+)
+
+func (b Backend) String() string {
+	switch b {
+	case TreeWalk:
+		return "treewalk"
+	case Closures:
+		return "closures"
+	case Bytecode:
+		return "bytecode"
+	default:
+		return "unknown"
+	}
+}
+
+// Options configures an Interpreter. The zero value walks the AST and uses
+// the process's stdout and stderr.
+type Options struct {
+	// Backend picks how scripts run. Not every backend supports the whole
+	// language; see Bytecode.
+	Backend Backend
+	// Stdout receives print statements.
+	Stdout io.Writer
+	// Stderr receives compile and runtime error reports.
+	Stderr io.Writer
+	// MaxHeap limits the estimated bytes of live data scripts may hold. Zero
+	// means no limit.
+	MaxHeap int
+	// ModulePaths are the directories searched for imported modules not
+	// found next to the importing file. The Bytecode backend ignores them.
+	ModulePaths []string
+}
+
+// Value is a Lox value as seen from Go: nil, bool, float64, string, or the
+// backend's own representation of a function, class or instance.
+type Value = interface{}
+
+var (
+	ErrCompile = errors.New("compile error")
+	ErrRuntime = errors.New("runtime error")
+)
+
+// Error is a compile or runtime error in a script. It wraps ErrCompile or
+// ErrRuntime, and its message is what the interpreter reported to Stderr.
+type Error struct {
+	kind    error
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.kind.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.kind
+}
+
+// backend runs source on one of the interpreters. Errors have already been
+// reported when eval returns ErrCompile or ErrRuntime.
+type backend interface {
+	eval(file string, source string) (Value, error)
+	define(name string, value Value) error
+	defineNative(name string, fn interface{}) error
+	get(name string) (Value, bool)
+	setInterrupt(done <-chan struct{})
+}
+
+// Interpreter runs Lox source, keeping globals from one evaluation to the
+// next. It is not safe for concurrent use.
+type Interpreter struct {
+	backend backend
+	// reports holds what the current evaluation reported to Stderr
+	reports bytes.Buffer
+}
+
+func New(opts Options) *Interpreter {
+	if opts.Stdout == nil {
+		opts.Stdout = os.Stdout
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = os.Stderr
+	}
+
+	l := &Interpreter{}
+	stderr := io.MultiWriter(opts.Stderr, &l.reports)
+	switch opts.Backend {
+	case Bytecode:
+		l.backend = newVMBackend(opts, stderr)
+	default:
+		l.backend = newASTBackend(opts, stderr)
+	}
+	return l
+}
+
+// Eval runs src. If its last statement is an expression statement, Eval
+// returns that expression's value. Cancelling ctx stops the script at its
+// next loop iteration or function call, and Eval returns ctx's error.
+func (l *Interpreter) Eval(ctx context.Context, src string) (Value, error) {
+	return l.eval(ctx, "", src)
+}
+
+// eval runs src, which was read from file if that isn't empty.
+func (l *Interpreter) eval(ctx context.Context, file string, src string) (Value, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	l.reports.Reset()
+	l.backend.setInterrupt(ctx.Done())
+	defer l.backend.setInterrupt(nil)
+
+	value, err := l.backend.eval(file, src)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, &Error{kind: err, Message: strings.TrimSpace(l.reports.String())}
+	}
+	return value, nil
+}
+
+// RunFile runs the script at path. Errors name the file, and modules it
+// imports are found relative to it.
+func (l *Interpreter) RunFile(ctx context.Context, path string) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	_, err = l.eval(ctx, path, string(src))
+	return err
+}
+
+// Define defines or redefines the global variable name. Go integer and float
+// types are converted to Lox numbers. A Go function becomes a native Lox
+// function: its parameters and results are converted by reflection, a
+// variadic function accepts any number of trailing arguments, and a non-nil
+// error it returns, or a native.Error it panics with, becomes a runtime
+// error at the call. A pointer to a
+// struct is wrapped with native.NewObject so scripts can use its exported
+// fields and methods; wrap it yourself to choose what is visible. The
+// bytecode backend only accepts functions and primitive values.
+func (l *Interpreter) Define(name string, value Value) error {
+	var err error
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Func {
+		err = l.backend.defineNative(name, value)
+	} else if _, ok := value.(ast.PropertyAccessor); !ok && isStructPointer(v) {
+		var object *native.Object
+		if object, err = native.NewObject(value, native.Visibility{}); err == nil {
+			err = l.backend.define(name, object)
+		}
+	} else {
+		err = l.backend.define(name, normalize(value))
+	}
+	if err != nil {
+		return fmt.Errorf("can't define %s: %w", name, err)
+	}
+	return nil
+}
+
+// Get returns the value of the global variable name.
+func (l *Interpreter) Get(name string) (Value, bool) {
+	return l.backend.get(name)
+}
+
+func isStructPointer(v reflect.Value) bool {
+	return v.Kind() == reflect.Pointer && !v.IsNil() && v.Elem().Kind() == reflect.Struct
+}
+
+// normalize converts Go numbers to the float64 every backend uses.
+func normalize(value Value) Value {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	default:
+		return value
+	}
+}
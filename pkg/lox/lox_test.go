@@ -0,0 +1,623 @@
+package lox_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/lox"
+	"github.com/mkeesey/craftinginterpreters/pkg/native"
+	"github.com/stretchr/testify/require"
+)
+
+var backends = []lox.Backend{lox.TreeWalk, lox.Closures, lox.Bytecode}
+
+func newInterpreter(backend lox.Backend) (*lox.Interpreter, *bytes.Buffer, *bytes.Buffer) {
+	var stdout, stderr bytes.Buffer
+	l := lox.New(lox.Options{Backend: backend, Stdout: &stdout, Stderr: &stderr})
+	return l, &stdout, &stderr
+}
+
+func TestEval(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.String(), func(t *testing.T) {
+			l, stdout, _ := newInterpreter(backend)
+			ctx := context.Background()
+
+			value, err := l.Eval(ctx, `var a = "taco"; print a + "s"; a + "s";`)
+			require.NoError(t, err)
+			require.Equal(t, "tacos", value)
+			require.Equal(t, "tacos\n", stdout.String())
+
+			// globals persist between evaluations
+			value, err = l.Eval(ctx, `fun twice(x) { return x * 2; } twice(21);`)
+			require.NoError(t, err)
+			require.Equal(t, 42.0, value)
+
+			value, err = l.Eval(ctx, `var b = 1;`)
+			require.NoError(t, err)
+			require.Nil(t, value)
+
+			value, err = l.Eval(ctx, `twice;`)
+			require.NoError(t, err)
+			require.Equal(t, "<fn twice>", value.(interface{ String() string }).String())
+		})
+	}
+}
+
+func TestDefineGet(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.String(), func(t *testing.T) {
+			l, stdout, _ := newInterpreter(backend)
+			require.NoError(t, l.Define("count", 3))
+			require.NoError(t, l.Define("name", "waffles"))
+			require.NoError(t, l.Define("enabled", true))
+
+			_, err := l.Eval(context.Background(), `
+if (enabled) print name;
+var total = count * 2;`)
+			require.NoError(t, err)
+			require.Equal(t, "waffles\n", stdout.String())
+
+			total, ok := l.Get("total")
+			require.True(t, ok)
+			require.Equal(t, 6.0, total)
+
+			_, ok = l.Get("missing")
+			require.False(t, ok)
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.String(), func(t *testing.T) {
+			l, stdout, stderr := newInterpreter(backend)
+			ctx := context.Background()
+
+			_, err := l.Eval(ctx, `print "before"; print 1 +;`)
+			require.ErrorIs(t, err, lox.ErrCompile)
+			require.Empty(t, stdout.String())
+			require.NotEmpty(t, stderr.String())
+
+			_, err = l.Eval(ctx, `{ var a = 1; var a = 2; }`)
+			require.ErrorIs(t, err, lox.ErrCompile)
+
+			stderr.Reset()
+			_, err = l.Eval(ctx, `print "before"; print "a" + 1;`)
+			require.ErrorIs(t, err, lox.ErrRuntime)
+			require.Contains(t, err.Error(), "Operands must be two numbers or two strings.")
+			require.Contains(t, stderr.String(), "Operands must be two numbers or two strings.")
+			require.Equal(t, "before\n", stdout.String())
+
+			// a failed evaluation leaves the interpreter usable
+			value, err := l.Eval(ctx, `1 + 1;`)
+			require.NoError(t, err)
+			require.Equal(t, 2.0, value)
+		})
+	}
+}
+
+func TestBytecodeUnsupported(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{`print "before"; var xs = [1];`, "[line 1] Error at '[': The bytecode VM doesn't support lists.\n"},
+		{`var m = {};`, "[line 1] Error at '{': The bytecode VM doesn't support maps.\n"},
+		{`class A {} A()[0] = 1;`, "[line 1] Error at '[': The bytecode VM doesn't support index assignment.\n"},
+		{`try { print 1; } catch (e) {}`, "[line 1] Error at 'try': The bytecode VM doesn't support exceptions.\n"},
+		{`import "lib.lox";`, "[line 1] Error at 'import': The bytecode VM doesn't support modules.\n"},
+	}
+
+	for _, test := range tests {
+		l, stdout, stderr := newInterpreter(lox.Bytecode)
+		_, err := l.Eval(context.Background(), test.src)
+		require.ErrorIs(t, err, lox.ErrCompile, test.src)
+		require.Equal(t, test.expected, stderr.String())
+		require.Empty(t, stdout.String())
+	}
+}
+
+func TestStackTrace(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.String(), func(t *testing.T) {
+			l, _, stderr := newInterpreter(backend)
+			_, err := l.Eval(context.Background(), `
+fun inner() {
+  return 1 - "a";
+}
+fun outer() { inner(); }
+outer();`)
+			require.ErrorIs(t, err, lox.ErrRuntime)
+			require.Equal(t, "Operands must be numbers.\n"+
+				"[line 3] in inner()\n"+
+				"[line 5] in outer()\n"+
+				"[line 6] in script\n", stderr.String())
+		})
+	}
+}
+
+func TestStackTraceNamesLambdas(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.String(), func(t *testing.T) {
+			l, _, stderr := newInterpreter(backend)
+			_, err := l.Eval(context.Background(), `
+var fail = fun () {
+  return 1 - "a";
+};
+fail();`)
+			require.ErrorIs(t, err, lox.ErrRuntime)
+			require.Equal(t, "Operands must be numbers.\n"+
+				"[line 3] in anonymous@line 2()\n"+
+				"[line 5] in script\n", stderr.String())
+		})
+	}
+}
+
+func TestOperatorOverloading(t *testing.T) {
+	src := `
+class Vec {
+  init(x, y) { this.x = x; this.y = y; }
+  __add__(other) { return Vec(this.x + other.x, this.y + other.y); }
+  __sub__(other) { return Vec(this.x - other.x, this.y - other.y); }
+  __eq__(other) { return this.x == other.x and this.y == other.y; }
+  __lt__(other) { return this.x < other.x; }
+  __gt__(other) { return this.x > other.x; }
+  __le__(other) { return this.x <= other.x; }
+  __ge__(other) { return this.x >= other.x; }
+  __str__() { return "(" + str(this.x) + ", " + str(this.y) + ")"; }
+}
+class Plain {}
+var a = Vec(1, 2);
+var b = Vec(3, 4);
+print a + b;
+print b - a;
+print a + b == Vec(4, 6);
+print a != Vec(1, 2);
+print a < b;
+print a <= b;
+print a >= b;
+print a > b;
+var p = Plain();
+print p == p;
+print p != Plain();
+print p;`
+
+	for _, backend := range backends {
+		t.Run(backend.String(), func(t *testing.T) {
+			l, stdout, stderr := newInterpreter(backend)
+			_, err := l.Eval(context.Background(), src)
+			require.NoError(t, err, stderr.String())
+			require.Equal(t, "(4, 6)\n(2, 2)\ntrue\nfalse\ntrue\ntrue\nfalse\nfalse\ntrue\ntrue\nPlain instance\n", stdout.String())
+
+			_, err = l.Eval(context.Background(), `Plain() * 2;`)
+			require.ErrorIs(t, err, lox.ErrRuntime)
+			require.Equal(t, "Undefined operator method '__mul__'.\n[line 1] in script\n", stderr.String())
+
+			// each comparison names its own method
+			stderr.Reset()
+			_, err = l.Eval(context.Background(), `class Less { __lt__(other) { return true; } } Less() <= Less();`)
+			require.ErrorIs(t, err, lox.ErrRuntime)
+			require.Equal(t, "Undefined operator method '__le__'.\n[line 1] in script\n", stderr.String())
+		})
+	}
+}
+
+func TestClassMembers(t *testing.T) {
+	src := `
+class Shape {
+  class unit() { return this(1); }
+  init(side) { this.side = side; }
+  area { return this.side * this.side; }
+  set perimeter(p) { this.side = p / 4; }
+}
+class Square < Shape {}
+var s = Square.unit();
+print s.area;
+print s.perimeter = 12;
+print s.area;`
+
+	for _, backend := range backends {
+		t.Run(backend.String(), func(t *testing.T) {
+			l, stdout, stderr := newInterpreter(backend)
+			_, err := l.Eval(context.Background(), src)
+			require.NoError(t, err, stderr.String())
+			require.Equal(t, "1\n12\n9\n", stdout.String())
+
+			_, err = l.Eval(context.Background(), `s.unit();`)
+			require.ErrorIs(t, err, lox.ErrRuntime)
+			require.Equal(t, "Undefined property 'unit'.\n[line 1] in script\n", stderr.String())
+		})
+	}
+}
+
+func TestStrMustReturnString(t *testing.T) {
+	src := `
+class Self { __str__() { return this; } }
+class Number { __str__() { return 1; } }`
+
+	for _, backend := range backends {
+		t.Run(backend.String(), func(t *testing.T) {
+			l, _, stderr := newInterpreter(backend)
+			_, err := l.Eval(context.Background(), src)
+			require.NoError(t, err, stderr.String())
+
+			for _, stmt := range []string{`print Self();`, `print "${Number()}";`} {
+				stderr.Reset()
+				_, err = l.Eval(context.Background(), stmt)
+				require.ErrorIs(t, err, lox.ErrRuntime, stmt)
+				require.Contains(t, stderr.String(), "__str__ must return a string.\n")
+			}
+		})
+	}
+}
+
+func TestMaxHeap(t *testing.T) {
+	// Each string is garbage by the next iteration, so only live data counts
+	// toward the max heap.
+	garbage := `
+for (var i = 0; i < 20000; i = i + 1) {
+  var s = "item " + "x";
+}`
+	live := `
+var s = "waffles";
+for (var i = 0; i < 30; i = i + 1) {
+  s = s + s;
+}`
+
+	for _, backend := range backends {
+		t.Run(backend.String(), func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			l := lox.New(lox.Options{Backend: backend, Stdout: &stdout, Stderr: &stderr, MaxHeap: 1000000})
+			_, err := l.Eval(context.Background(), garbage)
+			require.NoError(t, err, stderr.String())
+
+			_, err = l.Eval(context.Background(), live)
+			require.ErrorIs(t, err, lox.ErrRuntime)
+			require.Contains(t, stderr.String(), "Out of memory.")
+		})
+	}
+}
+
+func TestCatchOutOfMemory(t *testing.T) {
+	// the bytecode VM doesn't support exceptions
+	src := `
+try {
+  var s = "waffles";
+  for (var i = 0; i < 30; i = i + 1) {
+    s = s + s;
+  }
+} catch (e) {
+  print e.message;
+}
+print "after";`
+
+	for _, backend := range []lox.Backend{lox.TreeWalk, lox.Closures} {
+		t.Run(backend.String(), func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			l := lox.New(lox.Options{Backend: backend, Stdout: &stdout, Stderr: &stderr, MaxHeap: 1000000})
+			_, err := l.Eval(context.Background(), src)
+			require.NoError(t, err, stderr.String())
+			require.Equal(t, "Out of memory.\nafter\n", stdout.String())
+		})
+	}
+}
+
+func TestEvalCancel(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.String(), func(t *testing.T) {
+			l, _, _ := newInterpreter(backend)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			_, err := l.Eval(ctx, `while (true) {}`)
+			require.True(t, errors.Is(err, context.DeadlineExceeded), "got %v", err)
+
+			ctx, cancel = context.WithCancel(context.Background())
+			cancel()
+			_, err = l.Eval(ctx, `print "never";`)
+			require.ErrorIs(t, err, context.Canceled)
+
+			value, err := l.Eval(context.Background(), `"still works";`)
+			require.NoError(t, err)
+			require.Equal(t, "still works", value)
+		})
+	}
+}
+
+func TestEvalCancelCantBeCaught(t *testing.T) {
+	for _, backend := range []lox.Backend{lox.TreeWalk, lox.Closures} {
+		t.Run(backend.String(), func(t *testing.T) {
+			l, stdout, _ := newInterpreter(backend)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			_, err := l.Eval(ctx, `
+while (true) {
+  try {
+    while (true) {}
+  } catch (e) {
+    print "caught";
+  } finally {
+    print "finally";
+  }
+}`)
+			require.True(t, errors.Is(err, context.DeadlineExceeded), "got %v", err)
+			require.Empty(t, stdout.String())
+		})
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.lox")
+	require.NoError(t, os.WriteFile(path, []byte(`print "from a file";`), 0o644))
+
+	for _, backend := range backends {
+		t.Run(backend.String(), func(t *testing.T) {
+			l, stdout, _ := newInterpreter(backend)
+			require.NoError(t, l.RunFile(context.Background(), path))
+			require.Equal(t, "from a file\n", stdout.String())
+
+			require.Error(t, l.RunFile(context.Background(), filepath.Join(t.TempDir(), "missing.lox")))
+		})
+	}
+}
+
+func writeModules(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(src), 0o644))
+	}
+}
+
+func TestModules(t *testing.T) {
+	dir := t.TempDir()
+	lib := t.TempDir()
+	writeModules(t, dir, map[string]string{
+		"main.lox": `
+import "math.lox" as m;
+import { square, count } from "math.lox";
+import "effects.lox";
+import "shared.lox" as shared;
+print m.square(3);
+print square(4);
+print count;
+print m.pi;
+print shared.name;
+print m;`,
+		"math.lox": `
+print "loading math";
+export var pi = 3;
+export fun square(n) { return n * n; }
+export var count = 1;
+var hidden = "secret";`,
+		"effects.lox": `print "effects";`,
+	})
+	writeModules(t, lib, map[string]string{
+		"shared.lox": `export var name = "from the search path";`,
+	})
+
+	for _, backend := range []lox.Backend{lox.TreeWalk, lox.Closures} {
+		t.Run(backend.String(), func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			l := lox.New(lox.Options{Backend: backend, Stdout: &stdout, Stderr: &stderr, ModulePaths: []string{lib}})
+			require.NoError(t, l.RunFile(context.Background(), filepath.Join(dir, "main.lox")), stderr.String())
+			require.Equal(t, "loading math\neffects\n9\n16\n1\n3\nfrom the search path\n<module math.lox>\n", stdout.String())
+		})
+	}
+}
+
+func TestModuleErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeModules(t, dir, map[string]string{
+		"a.lox":       `import "b.lox";`,
+		"b.lox":       `import "a.lox";`,
+		"hidden.lox":  `import "lib.lox" as lib; print lib.hidden;`,
+		"lib.lox":     `var hidden = 1;`,
+		"missing.lox": `import "nowhere.lox";`,
+		"trace.lox":   `import "fails.lox" as f; f.fail();`,
+		"fails.lox": `
+export fun fail() {
+  return 1 - "a";
+}`,
+	})
+
+	for _, backend := range []lox.Backend{lox.TreeWalk, lox.Closures} {
+		t.Run(backend.String(), func(t *testing.T) {
+			tests := []struct {
+				file     string
+				expected string
+			}{
+				{"a.lox", "Import cycle: b.lox -> a.lox -> b.lox."},
+				{"hidden.lox", "Module 'lib.lox' has no export 'hidden'."},
+				{"missing.lox", "Can't find module 'nowhere.lox'."},
+				{"trace.lox", "Operands must be numbers.\n" +
+					"[" + filepath.Join(dir, "fails.lox") + ":3] in fail()\n" +
+					"[" + filepath.Join(dir, "trace.lox") + ":1] in script\n"},
+			}
+			for _, tt := range tests {
+				var stdout, stderr bytes.Buffer
+				l := lox.New(lox.Options{Backend: backend, Stdout: &stdout, Stderr: &stderr})
+				err := l.RunFile(context.Background(), filepath.Join(dir, tt.file))
+				require.ErrorIs(t, err, lox.ErrRuntime, tt.file)
+				require.Contains(t, stderr.String(), tt.expected, tt.file)
+			}
+		})
+	}
+}
+
+func TestDefineNative(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.String(), func(t *testing.T) {
+			l, stdout, _ := newInterpreter(backend)
+			require.NoError(t, l.Define("startsWith", func(s, prefix string) bool {
+				return len(s) >= len(prefix) && s[:len(prefix)] == prefix
+			}))
+			require.NoError(t, l.Define("sum", func(values ...float64) float64 {
+				total := 0.0
+				for _, v := range values {
+					total += v
+				}
+				return total
+			}))
+			require.NoError(t, l.Define("check", func(n int) (int, error) {
+				if n < 0 {
+					return 0, errors.New("n must not be negative.")
+				}
+				return n * 2, nil
+			}))
+
+			value, err := l.Eval(context.Background(), `
+print startsWith("waffles", "waf");
+print sum();
+print sum(1, 2, 3);
+check(21);`)
+			require.NoError(t, err)
+			require.Equal(t, "true\n0\n6\n", stdout.String())
+			require.Equal(t, 42.0, value)
+
+			_, err = l.Eval(context.Background(), `
+fun f() {
+  return check(-1);
+}
+f();`)
+			require.ErrorIs(t, err, lox.ErrRuntime)
+			require.Contains(t, err.Error(), "n must not be negative.")
+			require.Contains(t, err.Error(), "[line 3]")
+
+			_, err = l.Eval(context.Background(), `startsWith("a");`)
+			require.ErrorIs(t, err, lox.ErrRuntime)
+			require.Contains(t, err.Error(), "Expected 2 arguments but got 1.")
+
+			_, err = l.Eval(context.Background(), `sum(1, "two");`)
+			require.ErrorIs(t, err, lox.ErrRuntime)
+			require.Contains(t, err.Error(), "Argument 2 to 'sum' must be a number.")
+
+			require.Error(t, l.Define("bad", func() (int, int) { return 0, 0 }))
+		})
+	}
+}
+
+func TestDefineNativePanic(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.String(), func(t *testing.T) {
+			l, _, stderr := newInterpreter(backend)
+			require.NoError(t, l.Define("explode", func() { panic(native.Error{Message: "boom"}) }))
+
+			_, err := l.Eval(context.Background(), `
+var x = 1;
+explode();`)
+			require.ErrorIs(t, err, lox.ErrRuntime)
+			require.Equal(t, "boom\n[line 3] in script\n", stderr.String())
+		})
+	}
+}
+
+type request struct {
+	Path    string
+	Retries int
+	Token   string `lox:"-"`
+	headers map[string]string
+}
+
+func (r *request) Header(name string) string {
+	return r.headers[name]
+}
+
+func (r *request) SetHeader(name, value string) {
+	r.headers[name] = value
+}
+
+func TestDefineObject(t *testing.T) {
+	for _, backend := range []lox.Backend{lox.TreeWalk, lox.Closures} {
+		t.Run(backend.String(), func(t *testing.T) {
+			l, stdout, _ := newInterpreter(backend)
+			req := &request{Path: "/menu", Token: "secret", headers: map[string]string{"Accept": "text/plain"}}
+			require.NoError(t, l.Define("req", req))
+
+			_, err := l.Eval(context.Background(), `
+print req.Path;
+print req.Header("Accept");
+req.Retries = req.Retries + 2;
+req.SetHeader("X-Topping", "syrup");
+var header = req.Header;
+print header("X-Topping");
+print req;`)
+			require.NoError(t, err)
+			require.Equal(t, "/menu\ntext/plain\nsyrup\nrequest instance\n", stdout.String())
+			require.Equal(t, 2, req.Retries)
+			require.Equal(t, "syrup", req.headers["X-Topping"])
+
+			_, err = l.Eval(context.Background(), `print req.Token;`)
+			require.ErrorIs(t, err, lox.ErrRuntime)
+			require.Contains(t, err.Error(), "Undefined property 'Token'.")
+
+			_, err = l.Eval(context.Background(), `req.Retries = "many";`)
+			require.ErrorIs(t, err, lox.ErrRuntime)
+			require.Contains(t, err.Error(), "Property 'Retries' must be an integer.")
+
+			// hosts choose what is visible by wrapping the struct themselves
+			readOnly, err := native.NewObject(req, native.Visibility{Fields: []string{"Path"}, Methods: []string{}, ReadOnly: true})
+			require.NoError(t, err)
+			require.NoError(t, l.Define("view", readOnly))
+			_, err = l.Eval(context.Background(), `view.Path = "/";`)
+			require.ErrorIs(t, err, lox.ErrRuntime)
+			require.Contains(t, err.Error(), "Property 'Path' is read-only.")
+			_, err = l.Eval(context.Background(), `view.Header("Accept");`)
+			require.ErrorIs(t, err, lox.ErrRuntime)
+		})
+	}
+
+	l, _, _ := newInterpreter(lox.Bytecode)
+	require.Error(t, l.Define("req", &request{}))
+}
+
+type client struct {
+	Name string
+}
+
+type proxied struct {
+	Client   client
+	Upstream *client
+	Missing  *client
+	Tags     []string
+}
+
+func TestDefineNestedObject(t *testing.T) {
+	for _, backend := range []lox.Backend{lox.TreeWalk, lox.Closures} {
+		t.Run(backend.String(), func(t *testing.T) {
+			l, stdout, _ := newInterpreter(backend)
+			req := &proxied{Client: client{Name: "waffle"}, Upstream: &client{Name: "pancake"}, Tags: []string{"a"}}
+			require.NoError(t, l.Define("req", req))
+
+			_, err := l.Eval(context.Background(), `
+print req.Client.Name;
+req.Client.Name = "crepe";
+req.Upstream.Name = req.Upstream.Name + "s";
+print req.Missing;
+var tags = req.Tags;
+tags.append("b");
+print tags;`)
+			require.NoError(t, err)
+			require.Equal(t, "waffle\nnil\n[\"a\", \"b\"]\n", stdout.String())
+			require.Equal(t, "crepe", req.Client.Name)
+			require.Equal(t, "pancakes", req.Upstream.Name)
+			// slice fields are copies
+			require.Equal(t, []string{"a"}, req.Tags)
+
+			readOnly, err := native.NewObject(req, native.Visibility{ReadOnly: true})
+			require.NoError(t, err)
+			require.NoError(t, l.Define("view", readOnly))
+			_, err = l.Eval(context.Background(), `view.Client.Name = "toast";`)
+			require.ErrorIs(t, err, lox.ErrRuntime)
+			require.Contains(t, err.Error(), "Property 'Name' is read-only.")
+		})
+	}
+}
@@ -0,0 +1,234 @@
+// Package native adapts Go functions into Lox natives. Arity and argument
+// conversion are derived from the function's type by reflection, so every
+// backend can register a plain Go function like func(float64, string) (bool,
+// error).
+package native
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Error is panicked by a Go function that has no error result, or is deep in
+// a call it can't return from, to stop with a Lox runtime error. Call
+// recovers it; any other panic is a bug in the Go code and is left alone.
+type Error struct {
+	Message string
+}
+
+func (e Error) Error() string {
+	return e.Message
+}
+
+// Func is a Go function callable from Lox.
+type Func struct {
+	name     string
+	fn       reflect.Value
+	params   []reflect.Type
+	variadic bool
+	// returnsValue and returnsError describe the results, which are at most
+	// a value followed by an error
+	returnsValue bool
+	returnsError bool
+}
+
+// Wrap adapts fn, which must be a function whose results are nothing, a
+// value, an error, or a value and an error.
+func Wrap(name string, fn interface{}) (*Func, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("native %s: %T is not a function", name, fn)
+	}
+	t := v.Type()
+
+	f := &Func{name: name, fn: v, variadic: t.IsVariadic()}
+	for i := 0; i < t.NumIn(); i++ {
+		f.params = append(f.params, t.In(i))
+	}
+
+	switch t.NumOut() {
+	case 0:
+	case 1:
+		if t.Out(0) == errorType {
+			f.returnsError = true
+		} else {
+			f.returnsValue = true
+		}
+	case 2:
+		if t.Out(1) != errorType {
+			return nil, fmt.Errorf("native %s: second result must be an error, not %s", name, t.Out(1))
+		}
+		f.returnsValue = true
+		f.returnsError = true
+	default:
+		return nil, fmt.Errorf("native %s: too many results", name)
+	}
+	return f, nil
+}
+
+func (f *Func) Name() string {
+	return f.name
+}
+
+// Arity is the number of arguments the function takes, or -1 if it is
+// variadic. Variadic functions check their own argument count in Call.
+func (f *Func) Arity() int {
+	if f.variadic {
+		return -1
+	}
+	return len(f.params)
+}
+
+// Call converts args to the function's parameter types, calls it, and
+// converts its result back to a Lox value. A non-nil error returned by the
+// function is returned as is, and its message becomes the Lox runtime
+// error. So does an Error the function panics with.
+func (f *Func) Call(args []interface{}) (result interface{}, err error) {
+	fixed := len(f.params)
+	if f.variadic {
+		fixed--
+		if len(args) < fixed {
+			return nil, fmt.Errorf("Expected at least %d arguments but got %d.", fixed, len(args))
+		}
+	} else if len(args) != fixed {
+		return nil, fmt.Errorf("Expected %d arguments but got %d.", fixed, len(args))
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var param reflect.Type
+		if i < fixed {
+			param = f.params[i]
+		} else {
+			param = f.params[fixed].Elem()
+		}
+
+		value, err := ToGo(arg, param)
+		if err != nil {
+			return nil, fmt.Errorf("Argument %d to '%s' %s", i+1, f.name, err)
+		}
+		in[i] = value
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(Error)
+			if !ok {
+				panic(r)
+			}
+			result, err = nil, e
+		}
+	}()
+	out := f.fn.Call(in)
+	if f.returnsError {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			return nil, err
+		}
+	}
+	if f.returnsValue {
+		return FromGo(out[0]), nil
+	}
+	return nil, nil
+}
+
+// ToGo converts a Lox value to typ. Numbers convert to any Go number type
+// that holds them exactly; other values must be assignable to typ. The
+// error completes the sentence "Argument 1 ...".
+func ToGo(value interface{}, typ reflect.Type) (reflect.Value, error) {
+	if value == nil {
+		switch typ.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func:
+			return reflect.Zero(typ), nil
+		}
+		return reflect.Value{}, fmt.Errorf("must be %s.", Describe(typ))
+	}
+
+	if n, ok := value.(float64); ok {
+		switch typ.Kind() {
+		case reflect.Float32, reflect.Float64:
+			v := reflect.ValueOf(n).Convert(typ)
+			if v.Float() != n && !math.IsNaN(n) {
+				return reflect.Value{}, fmt.Errorf("must be %s.", Describe(typ))
+			}
+			return v, nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			v := reflect.New(typ).Elem()
+			if n != math.Trunc(n) || n < math.MinInt64 || n >= math.MaxInt64 || v.OverflowInt(int64(n)) {
+				return reflect.Value{}, fmt.Errorf("must be %s.", Describe(typ))
+			}
+			v.SetInt(int64(n))
+			return v, nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			v := reflect.New(typ).Elem()
+			if n != math.Trunc(n) || n < 0 || n >= math.MaxUint64 || v.OverflowUint(uint64(n)) {
+				return reflect.Value{}, fmt.Errorf("must be %s.", Describe(typ))
+			}
+			v.SetUint(uint64(n))
+			return v, nil
+		}
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Type().AssignableTo(typ) {
+		return v, nil
+	}
+	if v.Kind() == typ.Kind() && (v.Kind() == reflect.String || v.Kind() == reflect.Bool) {
+		// named string and bool types
+		return v.Convert(typ), nil
+	}
+	return reflect.Value{}, fmt.Errorf("must be %s.", Describe(typ))
+}
+
+// FromGo converts a Go value to a Lox value. Numbers become float64 and nil
+// pointers, maps, slices and interfaces become nil; anything else is
+// returned as is.
+func FromGo(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return FromGo(v.Elem())
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		if v.IsNil() {
+			return nil
+		}
+	}
+	return v.Interface()
+}
+
+// Describe names typ the way a Lox programmer would think of it, such as "a
+// number" or "an integer".
+func Describe(typ reflect.Type) string {
+	switch typ.Kind() {
+	case reflect.Float32:
+		return "a single-precision number"
+	case reflect.Float64:
+		return "a number"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "an integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "a non-negative integer"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	default:
+		return "a " + typ.String()
+	}
+}
@@ -0,0 +1,158 @@
+package native_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/native"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrapRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   interface{}
+	}{
+		{"not a function", 42},
+		{"nil function", (func())(nil)},
+		{"second result not error", func() (int, int) { return 0, 0 }},
+		{"too many results", func() (int, int, error) { return 0, 0, nil }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := native.Wrap("f", test.fn)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestCall(t *testing.T) {
+	repeat, err := native.Wrap("repeat", func(s string, n int) string { return strings.Repeat(s, n) })
+	require.NoError(t, err)
+	require.Equal(t, 2, repeat.Arity())
+
+	result, err := repeat.Call([]interface{}{"ab", 3.0})
+	require.NoError(t, err)
+	require.Equal(t, "ababab", result)
+
+	_, err = repeat.Call([]interface{}{"ab", 1.5})
+	require.EqualError(t, err, "Argument 2 to 'repeat' must be an integer.")
+	_, err = repeat.Call([]interface{}{3.0, 3.0})
+	require.EqualError(t, err, "Argument 1 to 'repeat' must be a string.")
+	_, err = repeat.Call([]interface{}{"ab"})
+	require.EqualError(t, err, "Expected 2 arguments but got 1.")
+}
+
+func TestResults(t *testing.T) {
+	nothing, err := native.Wrap("nothing", func() {})
+	require.NoError(t, err)
+	result, err := nothing.Call(nil)
+	require.NoError(t, err)
+	require.Nil(t, result)
+
+	count, err := native.Wrap("count", func() uint8 { return 7 })
+	require.NoError(t, err)
+	result, err = count.Call(nil)
+	require.NoError(t, err)
+	require.Equal(t, 7.0, result)
+
+	failing, err := native.Wrap("failing", func(fail bool) (string, error) {
+		if fail {
+			return "", errors.New("it failed")
+		}
+		return "fine", nil
+	})
+	require.NoError(t, err)
+	result, err = failing.Call([]interface{}{false})
+	require.NoError(t, err)
+	require.Equal(t, "fine", result)
+	_, err = failing.Call([]interface{}{true})
+	require.EqualError(t, err, "it failed")
+
+	onlyError, err := native.Wrap("onlyError", func() error { return nil })
+	require.NoError(t, err)
+	result, err = onlyError.Call(nil)
+	require.NoError(t, err)
+	require.Nil(t, result)
+
+	nilPointer, err := native.Wrap("nilPointer", func() *strings.Builder { return nil })
+	require.NoError(t, err)
+	result, err = nilPointer.Call(nil)
+	require.NoError(t, err)
+	require.Nil(t, result)
+}
+
+func TestPanic(t *testing.T) {
+	abort, err := native.Wrap("abort", func(n int) int {
+		if n < 0 {
+			panic(native.Error{Message: "n must not be negative."})
+		}
+		return n
+	})
+	require.NoError(t, err)
+	result, err := abort.Call([]interface{}{1.0})
+	require.NoError(t, err)
+	require.Equal(t, 1.0, result)
+	_, err = abort.Call([]interface{}{-1.0})
+	require.EqualError(t, err, "n must not be negative.")
+
+	// any other panic is a bug in the Go function, so it isn't hidden
+	explode, err := native.Wrap("explode", func(index int) int { return []int{1}[index] })
+	require.NoError(t, err)
+	require.Panics(t, func() { explode.Call([]interface{}{3.0}) })
+}
+
+func TestVariadic(t *testing.T) {
+	join, err := native.Wrap("join", func(sep string, parts ...string) string { return strings.Join(parts, sep) })
+	require.NoError(t, err)
+	require.Equal(t, -1, join.Arity())
+
+	result, err := join.Call([]interface{}{"-", "a", "b", "c"})
+	require.NoError(t, err)
+	require.Equal(t, "a-b-c", result)
+
+	result, err = join.Call([]interface{}{"-"})
+	require.NoError(t, err)
+	require.Equal(t, "", result)
+
+	_, err = join.Call(nil)
+	require.EqualError(t, err, "Expected at least 1 arguments but got 0.")
+	_, err = join.Call([]interface{}{"-", "a", 2.0})
+	require.EqualError(t, err, "Argument 3 to 'join' must be a string.")
+}
+
+func TestToGo(t *testing.T) {
+	anything, err := native.Wrap("anything", func(v interface{}) interface{} { return v })
+	require.NoError(t, err)
+	for _, value := range []interface{}{nil, true, 1.5, "s"} {
+		result, err := anything.Call([]interface{}{value})
+		require.NoError(t, err)
+		require.Equal(t, value, result)
+	}
+
+	small, err := native.Wrap("small", func(n int8, u uint) {})
+	require.NoError(t, err)
+	_, err = small.Call([]interface{}{200.0, 1.0})
+	require.EqualError(t, err, "Argument 1 to 'small' must be an integer.")
+	_, err = small.Call([]interface{}{1.0, -1.0})
+	require.EqualError(t, err, "Argument 2 to 'small' must be a non-negative integer.")
+	_, err = small.Call([]interface{}{nil, 1.0})
+	require.EqualError(t, err, "Argument 1 to 'small' must be an integer.")
+
+	single, err := native.Wrap("single", func(f float32) float32 { return f })
+	require.NoError(t, err)
+	result, err := single.Call([]interface{}{0.5})
+	require.NoError(t, err)
+	require.Equal(t, 0.5, result)
+	_, err = single.Call([]interface{}{0.1})
+	require.EqualError(t, err, "Argument 1 to 'single' must be a single-precision number.")
+
+	type mode string
+	named, err := native.Wrap("named", func(m mode) string { return string(m) + "!" })
+	require.NoError(t, err)
+	result, err = named.Call([]interface{}{"fast"})
+	require.NoError(t, err)
+	require.Equal(t, "fast!", result)
+}
@@ -0,0 +1,230 @@
+package native
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Visibility decides which exported fields and methods of a struct scripts
+// can see. Fields can also be controlled with struct tags: `lox:"name"`
+// renames a field, `lox:"-"` hides it and `lox:",readonly"` stops scripts
+// assigning to it. Structs nested in the struct share its Visibility, so
+// Fields and Methods may also name their fields and methods.
+type Visibility struct {
+	// Fields lists the visible fields by Lox name. Nil means every exported
+	// field.
+	Fields []string
+	// Methods lists the visible methods. Nil means every exported method.
+	Methods []string
+	// ReadOnly stops scripts assigning to any field.
+	ReadOnly bool
+}
+
+type field struct {
+	index    []int
+	readOnly bool
+}
+
+// Object exposes a Go struct pointer to Lox. Reading a field converts it
+// with FromGo, assigning one converts the value with ToGo, and reading a
+// method gives a Func bound to the struct. A field holding a struct, or a
+// non-nil pointer to one, reads as another Object with the same Visibility,
+// so scripts can reach and assign its fields in place. Slice and map fields
+// read as copies, so a script changing their elements doesn't change the
+// struct.
+type Object struct {
+	ptr        reflect.Value
+	visibility Visibility
+	fields     map[string]field
+	methods    map[string]*Func
+}
+
+// NewObject wraps ptr, which must be a non-nil pointer to a struct.
+func NewObject(ptr interface{}, visibility Visibility) (*Object, error) {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%T is not a pointer to a struct", ptr)
+	}
+
+	// a name need only exist in the struct or in one nested in it
+	fields, methods := make(map[string]bool), make(map[string]bool)
+	declared(v.Type(), fields, methods, make(map[reflect.Type]bool))
+	if err := check(fields, visibility.Fields, "field", v.Type()); err != nil {
+		return nil, err
+	}
+	if err := check(methods, visibility.Methods, "method", v.Type()); err != nil {
+		return nil, err
+	}
+	return newObject(v, visibility), nil
+}
+
+// newObject wraps v, a non-nil pointer to a struct. Names in visibility the
+// struct doesn't have are ignored, since a nested struct shares the
+// Visibility of the one holding it.
+func newObject(v reflect.Value, visibility Visibility) *Object {
+	o := &Object{ptr: v, visibility: visibility, fields: make(map[string]field), methods: make(map[string]*Func)}
+	for _, f := range reflect.VisibleFields(v.Elem().Type()) {
+		name, options, ok := fieldName(f)
+		if !ok {
+			continue
+		}
+		o.fields[name] = field{index: f.Index, readOnly: visibility.ReadOnly || options == "readonly"}
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumMethod(); i++ {
+		method := t.Method(i)
+		fn, err := Wrap(method.Name, v.Method(i).Interface())
+		if err != nil {
+			// methods Lox can't call are left out rather than refused
+			continue
+		}
+		o.methods[method.Name] = fn
+	}
+
+	if visibility.Fields != nil {
+		o.fields = only(o.fields, visibility.Fields)
+	}
+	if visibility.Methods != nil {
+		o.methods = only(o.methods, visibility.Methods)
+	}
+	return o
+}
+
+// fieldName returns the Lox name and tag options of a struct field, or false
+// if scripts can't see it.
+func fieldName(f reflect.StructField) (string, string, bool) {
+	if !f.IsExported() || f.Anonymous {
+		return "", "", false
+	}
+	name, options, _ := strings.Cut(f.Tag.Get("lox"), ",")
+	if name == "-" {
+		return "", "", false
+	}
+	if name == "" {
+		name = f.Name
+	}
+	return name, options, true
+}
+
+// declared adds the names of the fields and methods of the struct t points
+// to, and of the structs nested in it, to fields and methods.
+func declared(t reflect.Type, fields, methods map[string]bool, seen map[reflect.Type]bool) {
+	if seen[t] {
+		return
+	}
+	seen[t] = true
+	for i := 0; i < t.NumMethod(); i++ {
+		methods[t.Method(i).Name] = true
+	}
+	for _, f := range reflect.VisibleFields(t.Elem()) {
+		name, _, ok := fieldName(f)
+		if !ok {
+			continue
+		}
+		fields[name] = true
+		switch {
+		case f.Type.Kind() == reflect.Struct:
+			declared(reflect.PointerTo(f.Type), fields, methods, seen)
+		case f.Type.Kind() == reflect.Pointer && f.Type.Elem().Kind() == reflect.Struct:
+			declared(f.Type, fields, methods, seen)
+		}
+	}
+}
+
+// check fails if any of names is not in declared.
+func check(declared map[string]bool, names []string, kind string, t reflect.Type) error {
+	for _, name := range names {
+		if !declared[name] {
+			return fmt.Errorf("%s has no visible %s %s", t, kind, name)
+		}
+	}
+	return nil
+}
+
+// only keeps the entries of m named in names.
+func only[T any](m map[string]T, names []string) map[string]T {
+	visible := make(map[string]T, len(names))
+	for _, name := range names {
+		if entry, ok := m[name]; ok {
+			visible[name] = entry
+		}
+	}
+	return visible
+}
+
+// Get reads the field or bound method name. The error is a Lox runtime
+// error message.
+func (o *Object) Get(name string) (interface{}, error) {
+	if f, ok := o.fields[name]; ok {
+		value, err := o.ptr.Elem().FieldByIndexErr(f.index)
+		if err != nil {
+			// a field promoted through a nil embedded pointer
+			return nil, nil
+		}
+		if nested, ok := o.nested(value, f.readOnly); ok {
+			return nested, nil
+		}
+		return FromGo(value), nil
+	}
+	if method, ok := o.methods[name]; ok {
+		return method, nil
+	}
+	return nil, fmt.Errorf("Undefined property '%s'.", name)
+}
+
+// nested wraps a struct field, or a non-nil pointer to a struct, so that
+// scripts can use it in place. A read-only field makes the nested fields
+// read-only too.
+func (o *Object) nested(value reflect.Value, readOnly bool) (*Object, bool) {
+	switch {
+	case value.Kind() == reflect.Struct && value.CanAddr():
+		value = value.Addr()
+	case value.Kind() == reflect.Pointer && !value.IsNil() && value.Elem().Kind() == reflect.Struct:
+	default:
+		return nil, false
+	}
+	visibility := o.visibility
+	visibility.ReadOnly = visibility.ReadOnly || readOnly
+	return newObject(value, visibility), true
+}
+
+// Set assigns value to the field name. The error is a Lox runtime error
+// message.
+func (o *Object) Set(name string, value interface{}) error {
+	f, ok := o.fields[name]
+	if !ok {
+		if _, isMethod := o.methods[name]; isMethod {
+			return fmt.Errorf("Can't assign to method '%s'.", name)
+		}
+		return fmt.Errorf("Undefined property '%s'.", name)
+	}
+	if f.readOnly {
+		return fmt.Errorf("Property '%s' is read-only.", name)
+	}
+
+	target, err := o.ptr.Elem().FieldByIndexErr(f.index)
+	if err != nil {
+		return fmt.Errorf("Can't set property '%s' through a nil struct.", name)
+	}
+	converted, err := ToGo(value, target.Type())
+	if err != nil {
+		return fmt.Errorf("Property '%s' %s", name, err)
+	}
+	target.Set(converted)
+	return nil
+}
+
+// Value returns the wrapped pointer.
+func (o *Object) Value() interface{} {
+	return o.ptr.Interface()
+}
+
+func (o *Object) String() string {
+	return o.ptr.Elem().Type().Name() + " instance"
+}
+
+func (o *Object) TypeName() string {
+	return "instance"
+}
@@ -0,0 +1,154 @@
+package native_test
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/native"
+	"github.com/stretchr/testify/require"
+)
+
+type Limits struct {
+	Burst int
+}
+
+type Server struct {
+	Host    string
+	Port    int    `lox:"port"`
+	Secret  string `lox:"-"`
+	Version string `lox:",readonly"`
+	*Limits
+	hidden int
+}
+
+func (s *Server) Address() string {
+	return s.Host + ":" + strconv.Itoa(s.Port)
+}
+
+func (s *Server) Restart(force bool) error {
+	if !force {
+		return errors.New("Server is busy.")
+	}
+	return nil
+}
+
+func (s Server) Describe(prefix string, tags ...string) string {
+	return prefix + s.Host
+}
+
+func TestObjectFields(t *testing.T) {
+	server := &Server{Host: "localhost", Port: 8, Secret: "hunter2", Version: "1.0"}
+	object, err := native.NewObject(server, native.Visibility{})
+	require.NoError(t, err)
+	require.Equal(t, "Server instance", object.String())
+	require.Same(t, server, object.Value())
+
+	host, err := object.Get("Host")
+	require.NoError(t, err)
+	require.Equal(t, "localhost", host)
+	port, err := object.Get("port")
+	require.NoError(t, err)
+	require.Equal(t, 8.0, port)
+
+	require.NoError(t, object.Set("port", 9.0))
+	require.Equal(t, 9, server.Port)
+	require.EqualError(t, object.Set("port", 9.5), "Property 'port' must be an integer.")
+	require.EqualError(t, object.Set("Version", "2.0"), "Property 'Version' is read-only.")
+	require.EqualError(t, object.Set("Address", "x"), "Can't assign to method 'Address'.")
+	require.EqualError(t, object.Set("missing", 1.0), "Undefined property 'missing'.")
+
+	for _, name := range []string{"Port", "Secret", "hidden", "Limits"} {
+		_, err := object.Get(name)
+		require.EqualError(t, err, "Undefined property '"+name+"'.", name)
+	}
+
+	// promoted through a nil embedded pointer
+	burst, err := object.Get("Burst")
+	require.NoError(t, err)
+	require.Nil(t, burst)
+	require.Error(t, object.Set("Burst", 1.0))
+	server.Limits = &Limits{}
+	require.NoError(t, object.Set("Burst", 3.0))
+	require.Equal(t, 3, server.Burst)
+}
+
+func TestObjectMethods(t *testing.T) {
+	server := &Server{Host: "localhost", Port: 8}
+	object, err := native.NewObject(server, native.Visibility{})
+	require.NoError(t, err)
+
+	method, err := object.Get("Address")
+	require.NoError(t, err)
+	result, err := method.(*native.Func).Call(nil)
+	require.NoError(t, err)
+	require.Equal(t, "localhost:8", result)
+
+	method, err = object.Get("Restart")
+	require.NoError(t, err)
+	_, err = method.(*native.Func).Call([]interface{}{false})
+	require.EqualError(t, err, "Server is busy.")
+
+	method, err = object.Get("Describe")
+	require.NoError(t, err)
+	result, err = method.(*native.Func).Call([]interface{}{"at ", "a", "b"})
+	require.NoError(t, err)
+	require.Equal(t, "at localhost", result)
+}
+
+func TestObjectVisibility(t *testing.T) {
+	server := &Server{Host: "localhost", Port: 8}
+	object, err := native.NewObject(server, native.Visibility{
+		Fields:   []string{"Host"},
+		Methods:  []string{},
+		ReadOnly: true,
+	})
+	require.NoError(t, err)
+
+	_, err = object.Get("Host")
+	require.NoError(t, err)
+	_, err = object.Get("port")
+	require.Error(t, err)
+	_, err = object.Get("Address")
+	require.Error(t, err)
+	require.EqualError(t, object.Set("Host", "example.com"), "Property 'Host' is read-only.")
+
+	_, err = native.NewObject(server, native.Visibility{Fields: []string{"Secret"}})
+	require.Error(t, err)
+	_, err = native.NewObject(server, native.Visibility{Methods: []string{"Missing"}})
+	require.Error(t, err)
+	_, err = native.NewObject(*server, native.Visibility{})
+	require.Error(t, err)
+}
+
+type Proxy struct {
+	Name     string
+	Backend  Server
+	Fallback *Server
+}
+
+func TestObjectNested(t *testing.T) {
+	proxy := &Proxy{Backend: Server{Host: "localhost"}}
+	object, err := native.NewObject(proxy, native.Visibility{Fields: []string{"Backend", "Fallback", "Host"}})
+	require.NoError(t, err)
+
+	value, err := object.Get("Backend")
+	require.NoError(t, err)
+	backend, ok := value.(*native.Object)
+	require.True(t, ok)
+	require.Same(t, &proxy.Backend, backend.Value())
+	require.NoError(t, backend.Set("Host", "example.com"))
+	require.Equal(t, "example.com", proxy.Backend.Host)
+	// the nested struct shares the Visibility, so port stays hidden
+	_, err = backend.Get("port")
+	require.Error(t, err)
+
+	fallback, err := object.Get("Fallback")
+	require.NoError(t, err)
+	require.Nil(t, fallback)
+
+	proxy.Fallback = &Server{Host: "backup"}
+	fallback, err = object.Get("Fallback")
+	require.NoError(t, err)
+	require.Same(t, proxy.Fallback, fallback.(*native.Object).Value())
+}
@@ -3,9 +3,11 @@ package parser
 import (
 	"errors"
 	"fmt"
+	"os"
 
 	"github.com/mkeesey/craftinginterpreters/pkg/ast"
 	"github.com/mkeesey/craftinginterpreters/pkg/failure"
+	"github.com/mkeesey/craftinginterpreters/pkg/scanner"
 	"github.com/mkeesey/craftinginterpreters/pkg/token"
 )
 
@@ -19,6 +21,19 @@ func NewParser(tokens []*token.Token, reporter *failure.Reporter) *Parser {
 	return &Parser{tokens: tokens, reporter: reporter}
 }
 
+// ParseFile scans and parses the Lox file at path. Scan errors are
+// reported; parse errors are returned like Parse's.
+func ParseFile(path string, reporter *failure.Reporter) ([]ast.Stmt, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tokens := scanner.NewFileScanner(file, path, reporter).ScanTokens()
+	return NewParser(tokens, reporter).Parse()
+}
+
 func (p *Parser) Parse() ([]ast.Stmt, error) {
 	stmts := []ast.Stmt{}
 	allErrs := []error{}
@@ -39,9 +54,14 @@ func (p *Parser) Parse() ([]ast.Stmt, error) {
 func (p *Parser) declaration() (ast.Stmt, error) {
 	var stmt ast.Stmt
 	var err error
-	if p.match(token.VAR) {
+	if p.match(token.EXPORT) {
+		stmt, err = p.exportDeclaration()
+	} else if p.match(token.IMPORT) {
+		stmt, err = p.importDeclaration()
+	} else if p.match(token.VAR) {
 		stmt, err = p.varDeclaration()
-	} else if p.match(token.FUN) {
+	} else if p.check(token.FUN) && !p.checkNext(token.LEFT_PAREN) {
+		p.advance()
 		stmt, err = p.function("function")
 	} else if p.match(token.CLASS) {
 		stmt, err = p.classDeclaration()
@@ -55,6 +75,75 @@ func (p *Parser) declaration() (ast.Stmt, error) {
 	return stmt, err
 }
 
+func (p *Parser) exportDeclaration() (ast.Stmt, error) {
+	keyword := p.previous()
+	var declaration ast.Stmt
+	var err error
+	if p.match(token.VAR) {
+		declaration, err = p.varDeclaration()
+	} else if p.match(token.FUN) {
+		declaration, err = p.function("function")
+	} else if p.match(token.CLASS) {
+		declaration, err = p.classDeclaration()
+	} else {
+		return nil, failure.TokenError(p.peek(), "Expect declaration after 'export'.")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ast.Export{Keyword: keyword, Declaration: declaration}, nil
+}
+
+// importDeclaration parses the forms
+//
+//	import "path";
+//	import "path" as name;
+//	import { name, ... } from "path";
+//
+// 'as' and 'from' are only keywords here.
+func (p *Parser) importDeclaration() (ast.Stmt, error) {
+	stmt := &ast.Import{Keyword: p.previous()}
+	if p.match(token.LEFT_BRACE) {
+		stmt.Names = []*token.Token{}
+		for {
+			name, err := p.consume(token.IDENTIFIER, "Expect name to import.")
+			if err != nil {
+				return nil, err
+			}
+			stmt.Names = append(stmt.Names, name)
+			if !p.match(token.COMMA) {
+				break
+			}
+		}
+		_, err := p.consume(token.RIGHT_BRACE, "Expect '}' after imported names.")
+		if err != nil {
+			return nil, err
+		}
+		if !p.matchWord("from") {
+			return nil, failure.TokenError(p.peek(), "Expect 'from' after imported names.")
+		}
+	}
+
+	path, err := p.consume(token.STRING, "Expect module path.")
+	if err != nil {
+		return nil, err
+	}
+	stmt.Path = path
+
+	if stmt.Names == nil && p.matchWord("as") {
+		stmt.Name, err = p.consume(token.IDENTIFIER, "Expect module name after 'as'.")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = p.consume(token.SEMICOLON, "Expect ';' after import.")
+	if err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
 func (p *Parser) varDeclaration() (ast.Stmt, error) {
 	name, err := p.consume(token.IDENTIFIER, "Expect variable name.")
 	if err != nil {
@@ -86,7 +175,15 @@ func (p *Parser) function(kind string) (ast.Stmt, error) {
 	if err != nil {
 		return nil, err
 	}
+	function, err := p.functionBody(name, kind)
+	if err != nil {
+		return nil, err
+	}
+	return function, nil
+}
 
+// functionBody parses the parameters and body of a function after its '('.
+func (p *Parser) functionBody(name *token.Token, kind string) (*ast.Function, error) {
 	params := []*token.Token{}
 	if !p.check(token.RIGHT_PAREN) {
 		for {
@@ -106,7 +203,7 @@ func (p *Parser) function(kind string) (ast.Stmt, error) {
 		}
 	}
 
-	_, err = p.consume(token.RIGHT_PAREN, "Expect ')' after parameters.")
+	_, err := p.consume(token.RIGHT_PAREN, "Expect ')' after parameters.")
 	if err != nil {
 		return nil, err
 	}
@@ -142,18 +239,14 @@ func (p *Parser) classDeclaration() (ast.Stmt, error) {
 		return nil, err
 	}
 
-	var methods []*ast.Function
+	class := &ast.Class{Name: name, Superclass: superclass}
 	for {
 		if p.check(token.RIGHT_BRACE) || p.isAtEnd() {
 			break
 		}
-		method, err := p.function("method")
-		if err != nil {
+		if err := p.classMember(class); err != nil {
 			return nil, err
 		}
-		if methodFunc, ok := method.(*ast.Function); ok {
-			methods = append(methods, methodFunc)
-		}
 	}
 
 	_, err = p.consume(token.RIGHT_BRACE, "Expect '}' after class body.")
@@ -161,10 +254,58 @@ func (p *Parser) classDeclaration() (ast.Stmt, error) {
 		return nil, err
 	}
 
-	return &ast.Class{Name: name, Methods: methods, Superclass: superclass}, nil
+	return class, nil
+}
+
+// classMember parses a method into the table of class its form selects:
+// 'class name() {}' declares a class method, 'name {}' a getter and
+// 'set name(value) {}' a setter. 'set' is only special before a name, so
+// classes can still have methods called set.
+func (p *Parser) classMember(class *ast.Class) error {
+	if p.match(token.CLASS) {
+		method, err := p.function("method")
+		if err != nil {
+			return err
+		}
+		class.ClassMethods = append(class.ClassMethods, method.(*ast.Function))
+		return nil
+	}
+
+	if p.check(token.IDENTIFIER) && p.checkNext(token.LEFT_BRACE) {
+		name := p.advance()
+		p.advance()
+		body, err := p.block()
+		if err != nil {
+			return err
+		}
+		class.Getters = append(class.Getters, &ast.Function{Name: name, Params: []*token.Token{}, Body: body})
+		return nil
+	}
+
+	if p.check(token.IDENTIFIER) && p.peek().Lexeme == "set" && p.checkNext(token.IDENTIFIER) {
+		p.advance()
+		name := p.peek()
+		setter, err := p.function("setter")
+		if err != nil {
+			return err
+		}
+		if params := setter.(*ast.Function).Params; len(params) != 1 {
+			return failure.TokenError(name, "A setter must have exactly one parameter.")
+		}
+		class.Setters = append(class.Setters, setter.(*ast.Function))
+		return nil
+	}
+
+	method, err := p.function("method")
+	if err != nil {
+		return err
+	}
+	class.Methods = append(class.Methods, method.(*ast.Function))
+	return nil
 }
 
 func (p *Parser) whileStatement() (ast.Stmt, error) {
+	keyword := p.previous()
 	_, err := p.consume(token.LEFT_PAREN, "Expect '(' after 'while'.")
 	if err != nil {
 		return nil, err
@@ -184,11 +325,15 @@ func (p *Parser) whileStatement() (ast.Stmt, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &ast.While{Condition: condition, Body: body}, nil
+	return &ast.While{Keyword: keyword, Condition: condition, Body: body}, nil
 }
 
 func (p *Parser) statement() (ast.Stmt, error) {
-	if p.match(token.FOR) {
+	if p.match(token.BREAK) {
+		return p.breakStatement()
+	} else if p.match(token.CONTINUE) {
+		return p.continueStatement()
+	} else if p.match(token.FOR) {
 		return p.forStatement()
 	} else if p.match(token.IF) {
 		return p.ifStatement()
@@ -196,6 +341,10 @@ func (p *Parser) statement() (ast.Stmt, error) {
 		return p.printStatement()
 	} else if p.match(token.RETURN) {
 		return p.returnStatement()
+	} else if p.match(token.THROW) {
+		return p.throwStatement()
+	} else if p.match(token.TRY) {
+		return p.tryStatement()
 	} else if p.match(token.WHILE) {
 		return p.whileStatement()
 	} else if p.match(token.LEFT_BRACE) {
@@ -209,10 +358,14 @@ func (p *Parser) statement() (ast.Stmt, error) {
 }
 
 func (p *Parser) forStatement() (ast.Stmt, error) {
+	keyword := p.previous()
 	_, err := p.consume(token.LEFT_PAREN, "Expect '(' after 'for'.")
 	if err != nil {
 		return nil, err
 	}
+	if p.check(token.VAR) && p.checkWordAt(2, "in") {
+		return p.forInStatement(keyword)
+	}
 
 	var initializer ast.Stmt
 	if p.match(token.SEMICOLON) {
@@ -252,14 +405,11 @@ func (p *Parser) forStatement() (ast.Stmt, error) {
 		return nil, err
 	}
 
-	if increment != nil {
-		body = &ast.Block{Statements: []ast.Stmt{body, &ast.Expression{Expression: increment}}}
-	}
-
 	if condition == nil {
 		condition = &ast.Literal{Value: true}
 	}
-	body = &ast.While{Condition: condition, Body: body}
+	// the increment stays out of the body so a continue still runs it
+	body = &ast.While{Keyword: keyword, Condition: condition, Body: body, Increment: increment}
 
 	if initializer != nil {
 		body = &ast.Block{Statements: []ast.Stmt{initializer, body}}
@@ -268,6 +418,82 @@ func (p *Parser) forStatement() (ast.Stmt, error) {
 	return body, nil
 }
 
+// forInStatement parses the rest of 'for (var x in xs) body', which
+// becomes a loop over the iterator protocol:
+//
+//	{
+//	  var <iterator> = (xs).iterator();
+//	  while (<iterator>.hasNext()) {
+//	    var x = <iterator>.next();
+//	    body
+//	  }
+//	}
+//
+// so x is a new variable each time around.
+func (p *Parser) forInStatement(keyword *token.Token) (ast.Stmt, error) {
+	p.advance()
+	name, err := p.consume(token.IDENTIFIER, "Expect variable name.")
+	if err != nil {
+		return nil, err
+	}
+	in := p.advance()
+	iterable, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consume(token.RIGHT_PAREN, "Expect ')' after for clauses."); err != nil {
+		return nil, err
+	}
+	body, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+
+	// the space keeps scripts from naming the iterator
+	iterator := synthetic(in, "for iterator")
+	call := func(object ast.Expr, method string) ast.Expr {
+		return &ast.Call{Callee: &ast.Get{Object: object, Name: synthetic(in, method)}, Paren: in, Arguments: []ast.Expr{}}
+	}
+	loop := &ast.While{
+		Keyword:   keyword,
+		Condition: call(&ast.ExprVar{Name: iterator}, "hasNext"),
+		Body: &ast.Block{Statements: []ast.Stmt{
+			&ast.StmtVar{Name: name, Initializer: call(&ast.ExprVar{Name: iterator}, "next")},
+			body,
+		}},
+	}
+	return &ast.Block{Statements: []ast.Stmt{
+		&ast.StmtVar{Name: iterator, Initializer: call(iterable, "iterator")},
+		loop,
+	}}, nil
+}
+
+// synthetic returns an identifier the parser made up, at tok.
+func synthetic(tok *token.Token, lexeme string) *token.Token {
+	name := *tok
+	name.Type = token.IDENTIFIER
+	name.Lexeme = lexeme
+	return &name
+}
+
+func (p *Parser) breakStatement() (ast.Stmt, error) {
+	keyword := p.previous()
+	_, err := p.consume(token.SEMICOLON, "Expect ';' after 'break'.")
+	if err != nil {
+		return nil, err
+	}
+	return &ast.Break{Keyword: keyword}, nil
+}
+
+func (p *Parser) continueStatement() (ast.Stmt, error) {
+	keyword := p.previous()
+	_, err := p.consume(token.SEMICOLON, "Expect ';' after 'continue'.")
+	if err != nil {
+		return nil, err
+	}
+	return &ast.Continue{Keyword: keyword}, nil
+}
+
 func (p *Parser) ifStatement() (ast.Stmt, error) {
 	_, err := p.consume(token.LEFT_PAREN, "Expect '(' after 'if'.")
 	if err != nil {
@@ -301,6 +527,7 @@ func (p *Parser) ifStatement() (ast.Stmt, error) {
 }
 
 func (p *Parser) printStatement() (ast.Stmt, error) {
+	keyword := p.previous()
 	expr, err := p.expression()
 	if err != nil {
 		return nil, err
@@ -311,7 +538,7 @@ func (p *Parser) printStatement() (ast.Stmt, error) {
 		return nil, err
 	}
 
-	return &ast.Print{Expression: expr}, nil
+	return &ast.Print{Keyword: keyword, Expression: expr}, nil
 }
 
 func (p *Parser) returnStatement() (ast.Stmt, error) {
@@ -332,6 +559,71 @@ func (p *Parser) returnStatement() (ast.Stmt, error) {
 	return &ast.Return{Keyword: keyword, Value: value}, nil
 }
 
+func (p *Parser) throwStatement() (ast.Stmt, error) {
+	keyword := p.previous()
+	value, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.consume(token.SEMICOLON, "Expect ';' after thrown value.")
+	if err != nil {
+		return nil, err
+	}
+	return &ast.Throw{Keyword: keyword, Value: value}, nil
+}
+
+func (p *Parser) tryStatement() (ast.Stmt, error) {
+	stmt := &ast.Try{Keyword: p.previous()}
+	_, err := p.consume(token.LEFT_BRACE, "Expect '{' after 'try'.")
+	if err != nil {
+		return nil, err
+	}
+	stmt.Body, err = p.block()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.match(token.CATCH) {
+		_, err = p.consume(token.LEFT_PAREN, "Expect '(' after 'catch'.")
+		if err != nil {
+			return nil, err
+		}
+		stmt.CatchName, err = p.consume(token.IDENTIFIER, "Expect exception variable name.")
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.consume(token.RIGHT_PAREN, "Expect ')' after exception variable.")
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.consume(token.LEFT_BRACE, "Expect '{' before catch body.")
+		if err != nil {
+			return nil, err
+		}
+		stmt.CatchBody, err = p.block()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.match(token.FINALLY) {
+		_, err = p.consume(token.LEFT_BRACE, "Expect '{' after 'finally'.")
+		if err != nil {
+			return nil, err
+		}
+		stmt.FinallyBody, err = p.block()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if stmt.CatchName == nil && stmt.FinallyBody == nil {
+		return nil, failure.TokenError(p.peek(), "Expect 'catch' or 'finally' after try block.")
+	}
+	return stmt, nil
+}
+
 func (p *Parser) expressionStatement() (ast.Stmt, error) {
 	expr, err := p.expression()
 	if err != nil {
@@ -388,6 +680,8 @@ func (p *Parser) assignment() (ast.Expr, error) {
 			return &ast.Assign{Name: name, Value: value}, nil
 		} else if getExpr, ok := expr.(*ast.Get); ok {
 			return &ast.Set{Object: getExpr.Object, Name: getExpr.Name, Value: value}, nil
+		} else if index, ok := expr.(*ast.Index); ok {
+			return &ast.SetIndex{Object: index.Object, Bracket: index.Bracket, Index: index.Index, Value: value}, nil
 		}
 
 		return nil, failure.TokenError(equals, "Invalid assignment target.")
@@ -461,7 +755,7 @@ func (p *Parser) equality() (ast.Expr, error) {
 }
 
 func (p *Parser) comparison() (ast.Expr, error) {
-	expr, err := p.term()
+	expr, err := p.bitOr()
 	if err != nil {
 		return nil, err
 	}
@@ -472,6 +766,97 @@ func (p *Parser) comparison() (ast.Expr, error) {
 		}
 		operator := p.previous()
 		var right ast.Expr
+		right, err = p.bitOr()
+		if err != nil {
+			return nil, err
+		}
+		expr = &ast.Binary{Left: expr, Operator: operator, Right: right}
+	}
+
+	return expr, err
+}
+
+// bitOr and the levels below it order the bitwise operators as C does, but
+// like Python put them all above the comparisons, so x & 1 == 0 means
+// (x & 1) == 0.
+func (p *Parser) bitOr() (ast.Expr, error) {
+	expr, err := p.bitXor()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if !p.match(token.PIPE) {
+			break
+		}
+		operator := p.previous()
+		var right ast.Expr
+		right, err = p.bitXor()
+		if err != nil {
+			return nil, err
+		}
+		expr = &ast.Binary{Left: expr, Operator: operator, Right: right}
+	}
+
+	return expr, err
+}
+
+func (p *Parser) bitXor() (ast.Expr, error) {
+	expr, err := p.bitAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if !p.match(token.CARET) {
+			break
+		}
+		operator := p.previous()
+		var right ast.Expr
+		right, err = p.bitAnd()
+		if err != nil {
+			return nil, err
+		}
+		expr = &ast.Binary{Left: expr, Operator: operator, Right: right}
+	}
+
+	return expr, err
+}
+
+func (p *Parser) bitAnd() (ast.Expr, error) {
+	expr, err := p.shift()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if !p.match(token.AMPERSAND) {
+			break
+		}
+		operator := p.previous()
+		var right ast.Expr
+		right, err = p.shift()
+		if err != nil {
+			return nil, err
+		}
+		expr = &ast.Binary{Left: expr, Operator: operator, Right: right}
+	}
+
+	return expr, err
+}
+
+func (p *Parser) shift() (ast.Expr, error) {
+	expr, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if !p.match(token.LESS_LESS, token.GREATER_GREATER) {
+			break
+		}
+		operator := p.previous()
+		var right ast.Expr
 		right, err = p.term()
 		if err != nil {
 			return nil, err
@@ -511,7 +896,7 @@ func (p *Parser) factor() (ast.Expr, error) {
 	}
 
 	for {
-		if !p.match(token.SLASH, token.STAR) {
+		if !p.match(token.SLASH, token.SLASH_SLASH, token.STAR, token.PERCENT) {
 			break
 		}
 		operator := p.previous()
@@ -528,7 +913,7 @@ func (p *Parser) factor() (ast.Expr, error) {
 
 func (p *Parser) unary() (ast.Expr, error) {
 	for {
-		if !p.match(token.BANG, token.MINUS) {
+		if !p.match(token.BANG, token.MINUS, token.TILDE) {
 			break
 		}
 		operator := p.previous()
@@ -539,7 +924,27 @@ func (p *Parser) unary() (ast.Expr, error) {
 		return &ast.Unary{Operator: operator, Right: right}, nil
 	}
 
-	return p.call()
+	return p.power()
+}
+
+// power parses **, which is right-associative and binds tighter than a
+// unary operator on its left, so -2 ** 2 is -4, but not one on its right.
+func (p *Parser) power() (ast.Expr, error) {
+	expr, err := p.call()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.match(token.STAR_STAR) {
+		operator := p.previous()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &ast.Binary{Left: expr, Operator: operator, Right: right}, nil
+	}
+
+	return expr, nil
 }
 
 func (p *Parser) call() (ast.Expr, error) {
@@ -560,6 +965,17 @@ func (p *Parser) call() (ast.Expr, error) {
 				return nil, err
 			}
 			expr = &ast.Get{Object: expr, Name: name}
+		} else if p.match(token.LEFT_BRACKET) {
+			bracket := p.previous()
+			index, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			_, err = p.consume(token.RIGHT_BRACKET, "Expect ']' after index.")
+			if err != nil {
+				return nil, err
+			}
+			expr = &ast.Index{Object: expr, Bracket: bracket, Index: index}
 		} else {
 			break
 		}
@@ -630,11 +1046,117 @@ func (p *Parser) primary() (ast.Expr, error) {
 			return nil, err
 		}
 		return &ast.Grouping{Expression: expr}, nil
+	} else if p.match(token.INTERPOLATION) {
+		return p.interpolation()
+	} else if p.match(token.FUN) {
+		return p.lambda()
+	} else if p.match(token.LEFT_BRACKET) {
+		return p.list()
+	} else if p.match(token.LEFT_BRACE) {
+		return p.mapLiteral()
 	}
 
 	return nil, failure.TokenError(p.peek(), "Expect expression.")
 }
 
+// interpolation parses a string literal with ${...} expressions in it,
+// from the text before the first expression.
+func (p *Parser) interpolation() (ast.Expr, error) {
+	start := p.previous()
+	parts := []ast.Expr{}
+	for {
+		if text := p.previous().Literal.(string); text != "" {
+			parts = append(parts, &ast.Literal{Value: text})
+		}
+		expr, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, expr)
+
+		if p.match(token.INTERPOLATION) {
+			continue
+		}
+		end, err := p.consume(token.STRING, "Expect '}' after interpolated expression.")
+		if err != nil {
+			return nil, err
+		}
+		if text := end.Literal.(string); text != "" {
+			parts = append(parts, &ast.Literal{Value: text})
+		}
+		return &ast.Interpolation{Start: start, Parts: parts}, nil
+	}
+}
+
+// lambda parses an anonymous function. Its name records where it was
+// written, since that's all there is to tell lambdas apart in stack traces.
+func (p *Parser) lambda() (ast.Expr, error) {
+	keyword := p.previous()
+	if _, err := p.consume(token.LEFT_PAREN, "Expect '(' after 'fun'."); err != nil {
+		return nil, err
+	}
+
+	name := synthetic(keyword, fmt.Sprintf("anonymous@line %d", keyword.Line))
+	function, err := p.functionBody(name, "function")
+	if err != nil {
+		return nil, err
+	}
+	return &ast.Lambda{Keyword: keyword, Function: function}, nil
+}
+
+func (p *Parser) list() (ast.Expr, error) {
+	bracket := p.previous()
+	elements := []ast.Expr{}
+	for !p.check(token.RIGHT_BRACKET) {
+		element, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+		if !p.match(token.COMMA) {
+			break
+		}
+	}
+
+	_, err := p.consume(token.RIGHT_BRACKET, "Expect ']' after list elements.")
+	if err != nil {
+		return nil, err
+	}
+	return &ast.List{Bracket: bracket, Elements: elements}, nil
+}
+
+// mapLiteral parses the entries of a map literal. A statement starting with
+// '{' is a block, so map literals only appear where an expression is
+// expected.
+func (p *Parser) mapLiteral() (ast.Expr, error) {
+	brace := p.previous()
+	keys, values := []ast.Expr{}, []ast.Expr{}
+	for !p.check(token.RIGHT_BRACE) {
+		key, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		_, err = p.consume(token.COLON, "Expect ':' after map key.")
+		if err != nil {
+			return nil, err
+		}
+		value, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		keys, values = append(keys, key), append(values, value)
+		if !p.match(token.COMMA) {
+			break
+		}
+	}
+
+	_, err := p.consume(token.RIGHT_BRACE, "Expect '}' after map entries.")
+	if err != nil {
+		return nil, err
+	}
+	return &ast.Map{Brace: brace, Keys: keys, Values: values}, nil
+}
+
 func (p *Parser) consume(t token.TokenType, message string) (*token.Token, error) {
 	if p.check(t) {
 		return p.advance(), nil
@@ -652,6 +1174,16 @@ func (p *Parser) match(types ...token.TokenType) bool {
 
 	return false
 }
+
+// matchWord matches an identifier that is a keyword only in context.
+func (p *Parser) matchWord(word string) bool {
+	if p.check(token.IDENTIFIER) && p.peek().Lexeme == word {
+		p.advance()
+		return true
+	}
+	return false
+}
+
 func (p *Parser) check(t token.TokenType) bool {
 	if p.isAtEnd() {
 		return false
@@ -660,6 +1192,24 @@ func (p *Parser) check(t token.TokenType) bool {
 	return p.tokens[p.current].Type == t
 }
 
+// checkWordAt reports whether the token distance ahead of the current one
+// is the identifier word.
+func (p *Parser) checkWordAt(distance int, word string) bool {
+	if p.current+distance >= len(p.tokens) {
+		return false
+	}
+	tok := p.tokens[p.current+distance]
+	return tok.Type == token.IDENTIFIER && tok.Lexeme == word
+}
+
+// checkNext reports whether the token after the current one is of type t.
+func (p *Parser) checkNext(t token.TokenType) bool {
+	if p.isAtEnd() {
+		return false
+	}
+	return p.tokens[p.current+1].Type == t
+}
+
 func (p *Parser) isAtEnd() bool {
 	return p.peek().Type == token.EOF
 }
@@ -688,7 +1238,8 @@ func (p *Parser) synchronize() {
 		}
 
 		switch p.peek().Type {
-		case token.CLASS, token.FUN, token.VAR, token.FOR, token.IF, token.WHILE, token.PRINT, token.RETURN:
+		case token.CLASS, token.FUN, token.VAR, token.FOR, token.IF, token.WHILE, token.PRINT, token.RETURN, token.THROW, token.TRY,
+			token.IMPORT, token.EXPORT:
 			return
 		default:
 			p.advance()
@@ -0,0 +1,111 @@
+package scanner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// EscapeError is a bad escape sequence found Offset bytes into the text
+// of a string literal.
+type EscapeError struct {
+	Offset  int
+	Message string
+}
+
+func (e *EscapeError) Error() string {
+	return e.Message
+}
+
+// Unescape returns the value of the text between a string literal's quotes,
+// replacing each escape sequence with the character it stands for.
+func Unescape(text string) (string, error) {
+	if !strings.ContainsRune(text, '\\') {
+		return text, nil
+	}
+
+	var value strings.Builder
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if r != '\\' {
+			value.WriteRune(r)
+			i += size
+			continue
+		}
+
+		escaped, length, err := unescapeAt(text, i)
+		if err != nil {
+			return "", err
+		}
+		value.WriteRune(escaped)
+		i += length
+	}
+	return value.String(), nil
+}
+
+// unescapeAt decodes the escape sequence starting with the backslash at
+// text[start], returning the character and how many bytes it spans.
+func unescapeAt(text string, start int) (rune, int, error) {
+	if start+1 >= len(text) {
+		return 0, 0, &EscapeError{Offset: start, Message: "Unfinished escape sequence."}
+	}
+
+	r, size := utf8.DecodeRuneInString(text[start+1:])
+	switch r {
+	case 'n':
+		return '\n', 2, nil
+	case 't':
+		return '\t', 2, nil
+	case 'r':
+		return '\r', 2, nil
+	case '0':
+		return 0, 2, nil
+	case '"', '\\', '$':
+		return r, 2, nil
+	case 'u':
+		return unicodeEscape(text, start)
+	}
+	return 0, 0, &EscapeError{
+		Offset:  start,
+		Message: fmt.Sprintf("Invalid escape sequence '\\%s'.", text[start+1:start+1+size]),
+	}
+}
+
+// unicodeEscape decodes a \u{...} escape, which holds one to six hex digits
+// naming a Unicode code point.
+func unicodeEscape(text string, start int) (rune, int, error) {
+	invalid := &EscapeError{Offset: start, Message: "Invalid unicode escape sequence."}
+
+	open := start + 2
+	if open >= len(text) || text[open] != '{' {
+		return 0, 0, invalid
+	}
+	end := strings.IndexByte(text[open:], '}')
+	if end < 0 {
+		return 0, 0, invalid
+	}
+	digits := text[open+1 : open+end]
+	if len(digits) == 0 || len(digits) > 6 {
+		return 0, 0, invalid
+	}
+	code, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		return 0, 0, invalid
+	}
+	return rune(code), open + end + 1 - start, nil
+}
+
+// Position returns the line and column of the byte at offset in text, given
+// that text starts at line and column.
+func Position(text string, offset int, line int, column int) (int, int) {
+	for _, r := range text[:offset] {
+		if r == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return line, column
+}
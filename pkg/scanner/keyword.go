@@ -4,21 +4,29 @@ import "github.com/mkeesey/craftinginterpreters/pkg/token"
 
 var (
 	keywords = map[string]token.TokenType{
-		"and":    token.AND,
-		"class":  token.CLASS,
-		"else":   token.ELSE,
-		"false":  token.FALSE,
-		"for":    token.FOR,
-		"fun":    token.FUN,
-		"if":     token.IF,
-		"nil":    token.NIL,
-		"or":     token.OR,
-		"print":  token.PRINT,
-		"return": token.RETURN,
-		"super":  token.SUPER,
-		"this":   token.THIS,
-		"true":   token.TRUE,
-		"var":    token.VAR,
-		"while":  token.WHILE,
+		"and":      token.AND,
+		"break":    token.BREAK,
+		"catch":    token.CATCH,
+		"class":    token.CLASS,
+		"continue": token.CONTINUE,
+		"else":     token.ELSE,
+		"export":   token.EXPORT,
+		"false":    token.FALSE,
+		"finally":  token.FINALLY,
+		"for":      token.FOR,
+		"fun":      token.FUN,
+		"if":       token.IF,
+		"import":   token.IMPORT,
+		"nil":      token.NIL,
+		"or":       token.OR,
+		"print":    token.PRINT,
+		"return":   token.RETURN,
+		"super":    token.SUPER,
+		"this":     token.THIS,
+		"throw":    token.THROW,
+		"true":     token.TRUE,
+		"try":      token.TRY,
+		"var":      token.VAR,
+		"while":    token.WHILE,
 	}
 )
@@ -0,0 +1,41 @@
+package scanner
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ParseNumber returns the value of a number literal: decimal, with an
+// optional fraction, hexadecimal after 0x or binary after 0b. Underscores
+// may separate digits.
+func ParseNumber(lexeme string) (float64, error) {
+	if isRadixPrefix(lexeme) {
+		n, err := strconv.ParseUint(lexeme, 0, 64)
+		if err != nil {
+			return 0, numberError(err)
+		}
+		return float64(n), nil
+	}
+
+	n, err := strconv.ParseFloat(lexeme, 64)
+	if err != nil {
+		return 0, numberError(err)
+	}
+	return n, nil
+}
+
+func numberError(err error) error {
+	if errors.Is(err, strconv.ErrRange) {
+		return errors.New("Number literal is too large.")
+	}
+	return errors.New("Invalid number literal.")
+}
+
+// isRadixPrefix reports whether a number literal starts with 0x or 0b.
+func isRadixPrefix(lexeme string) bool {
+	return len(lexeme) >= 2 && lexeme[0] == '0' && isRadix(lexeme[1])
+}
+
+func isRadix(c byte) bool {
+	return c == 'x' || c == 'X' || c == 'b' || c == 'B'
+}
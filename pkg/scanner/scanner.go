@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"errors"
 	"io"
-	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -19,14 +18,27 @@ type Scanner struct {
 	currLexeme strings.Builder
 
 	line int
+	// column is the column of the last rune read on line, starting at 1
+	column int
+	file   string
+	// interpolations holds, for each ${...} being scanned, innermost last,
+	// how many braces are open inside it, so the scanner knows which '}'
+	// ends it and carries on with the string
+	interpolations []int
 
 	reporter *failure.Reporter
 }
 
 func NewScanner(reader io.Reader, reporter *failure.Reporter) *Scanner {
+	return NewFileScanner(reader, "", reporter)
+}
+
+// NewFileScanner returns a Scanner for source read from file, which the
+// tokens and errors it reports name.
+func NewFileScanner(reader io.Reader, file string, reporter *failure.Reporter) *Scanner {
 	read := bufio.NewReader(reader)
 	buf := strings.Builder{}
-	return &Scanner{reader: read, currLexeme: buf, reporter: reporter, line: 1}
+	return &Scanner{reader: read, currLexeme: buf, reporter: reporter, line: 1, file: file}
 }
 
 func (s *Scanner) ScanTokens() []*token.Token {
@@ -42,12 +54,15 @@ func (s *Scanner) ScanTokens() []*token.Token {
 		}
 	}
 
-	s.tokens = append(s.tokens, token.NewToken(token.EOF, "", nil, s.line))
+	if len(s.interpolations) > 0 {
+		s.reporter.FileError(s.file, s.line, "Unterminated string interpolation.")
+	}
+	s.addTokenLiteral(token.EOF, nil)
 	return s.tokens
 }
 
 func (s *Scanner) scanToken() error {
-	rune, _, err := s.reader.ReadRune()
+	rune, err := s.readRune()
 	if err != nil {
 		return err
 	}
@@ -59,11 +74,29 @@ func (s *Scanner) scanToken() error {
 	case ')':
 		s.addToken(token.RIGHT_PAREN)
 	case '{':
+		if n := len(s.interpolations); n > 0 {
+			s.interpolations[n-1]++
+		}
 		s.addToken(token.LEFT_BRACE)
 	case '}':
+		n := len(s.interpolations)
+		if n > 0 && s.interpolations[n-1] == 0 {
+			s.interpolations = s.interpolations[:n-1]
+			err = s.stringToken()
+			break
+		}
+		if n > 0 {
+			s.interpolations[n-1]--
+		}
 		s.addToken(token.RIGHT_BRACE)
+	case '[':
+		s.addToken(token.LEFT_BRACKET)
+	case ']':
+		s.addToken(token.RIGHT_BRACKET)
 	case ',':
 		s.addToken(token.COMMA)
+	case ':':
+		s.addToken(token.COLON)
 	case '.':
 		s.addToken(token.DOT)
 	case '-':
@@ -73,7 +106,21 @@ func (s *Scanner) scanToken() error {
 	case ';':
 		s.addToken(token.SEMICOLON)
 	case '*':
-		s.addToken(token.STAR)
+		if s.match('*') {
+			s.addToken(token.STAR_STAR)
+		} else {
+			s.addToken(token.STAR)
+		}
+	case '%':
+		s.addToken(token.PERCENT)
+	case '&':
+		s.addToken(token.AMPERSAND)
+	case '|':
+		s.addToken(token.PIPE)
+	case '^':
+		s.addToken(token.CARET)
+	case '~':
+		s.addToken(token.TILDE)
 	case '!':
 		if s.match('=') {
 			s.addToken(token.BANG_EQUAL)
@@ -89,46 +136,55 @@ func (s *Scanner) scanToken() error {
 	case '<':
 		if s.match('=') {
 			s.addToken(token.LESS_EQUAL)
+		} else if s.match('<') {
+			s.addToken(token.LESS_LESS)
 		} else {
 			s.addToken(token.LESS)
 		}
 	case '>':
 		if s.match('=') {
 			s.addToken(token.GREATER_EQUAL)
+		} else if s.match('>') {
+			s.addToken(token.GREATER_GREATER)
 		} else {
 			s.addToken(token.GREATER)
 		}
 	case '/':
 		if s.match('/') {
-			for {
-				bytes, err := s.reader.Peek(1)
-				if err != nil {
-					if errors.Is(err, io.EOF) {
-						break
-					}
-					s.reporter.Panic(s.line, err)
-				}
-				if bytes[0] == '\n' {
+			s.addToken(token.SLASH_SLASH)
+		} else {
+			s.addToken(token.SLASH)
+		}
+	case '#':
+		// a comment runs to the end of the line, since // is integer division
+		for {
+			bytes, err := s.reader.Peek(1)
+			if err != nil {
+				if errors.Is(err, io.EOF) {
 					break
 				}
-				s.reader.Discard(1)
+				s.reporter.Panic(s.line, err)
 			}
-		} else {
-			s.addToken(token.SLASH)
+			if bytes[0] == '\n' {
+				break
+			}
+			s.discard(1)
 		}
 	case ' ', '\r', '\t':
 		// ignore whitespace
 	case '\n':
-		s.line++
+		s.newline()
 	case '"':
 		err = s.stringToken()
 	default:
-		if isNumber(rune) {
+		if rune == 'r' && s.match('"') {
+			err = s.rawStringToken()
+		} else if isNumber(rune) {
 			s.numberToken()
 		} else if isAlpha(rune) {
 			err = s.identifierToken()
 		} else {
-			s.reporter.Error(s.line, "Unexpected character.")
+			s.reporter.FileError(s.file, s.line, "Unexpected character.")
 		}
 	}
 	return err
@@ -139,7 +195,39 @@ func (s *Scanner) addToken(tokenType token.TokenType) {
 }
 
 func (s *Scanner) addTokenLiteral(tokenType token.TokenType, literal interface{}) {
-	s.tokens = append(s.tokens, token.NewToken(tokenType, s.currLexeme.String(), literal, s.line))
+	s.addTokenAt(tokenType, literal, s.line)
+}
+
+// addTokenAt adds a token starting on line, which for a string spanning
+// lines is before the current one.
+func (s *Scanner) addTokenAt(tokenType token.TokenType, literal interface{}, line int) {
+	tok := token.NewToken(tokenType, s.currLexeme.String(), literal, line)
+	tok.File = s.file
+	s.tokens = append(s.tokens, tok)
+}
+
+func (s *Scanner) readRune() (rune, error) {
+	rune, _, err := s.reader.ReadRune()
+	if err == nil {
+		s.column++
+	}
+	return rune, err
+}
+
+func (s *Scanner) unreadRune() {
+	s.reader.UnreadRune()
+	s.column--
+}
+
+// discard skips n bytes, which must be ASCII characters other than newline.
+func (s *Scanner) discard(n int) {
+	s.reader.Discard(n)
+	s.column += n
+}
+
+func (s *Scanner) newline() {
+	s.line++
+	s.column = 0
 }
 
 func (s *Scanner) match(expected rune) bool {
@@ -153,69 +241,145 @@ func (s *Scanner) match(expected rune) bool {
 		return false
 	}
 	s.currLexeme.WriteRune(seen)
-	s.reader.Discard(runeLength)
+	s.discard(runeLength)
 	return true
 }
 
+// stringToken scans the rest of a string literal, after its opening quote
+// or the '}' ending an interpolated expression. A "${" ends the token early
+// as an INTERPOLATION, leaving the expression to be scanned as tokens.
 func (s *Scanner) stringToken() error {
 	s.currLexeme.Reset() // remove leading quote
+	line, column := s.line, s.column+1
 	for {
 		bytes, err := s.reader.Peek(1)
 		if err != nil {
 			if errors.Is(err, io.EOF) {
-				s.reporter.Error(s.line, "Unterminated string.")
+				s.reporter.FileError(s.file, line, "Unterminated string.")
 				return nil
 			}
 			s.reporter.Panic(s.line, err)
 		}
 		if bytes[0] == '"' {
-			s.reader.Discard(1) // skip closing quote
+			s.discard(1) // skip closing quote
 			break
 		}
-
-		if bytes[0] == '\n' {
-			s.line++
+		if bytes[0] == '$' {
+			if next, err := s.reader.Peek(2); err == nil && next[1] == '{' {
+				s.discard(2)
+				s.interpolations = append(s.interpolations, 0)
+				s.addStringToken(token.INTERPOLATION, line, column)
+				return nil
+			}
+		}
+		if bytes[0] == '\\' {
+			// Keep the escaped character from ending the string or
+			// starting an interpolation; Unescape decodes it later.
+			s.stringRune()
+			if _, err := s.reader.Peek(1); err == nil {
+				s.stringRune()
+			}
+			continue
 		}
-		rune, _, err := s.reader.ReadRune()
+		s.stringRune()
+	}
+
+	s.addStringToken(token.STRING, line, column)
+
+	return nil
+}
+
+// rawStringToken scans the rest of a raw string literal, r"...", after its
+// opening quote. Its value is the text between the quotes, unescaped.
+func (s *Scanner) rawStringToken() error {
+	s.currLexeme.Reset() // remove leading r"
+	line := s.line
+	for {
+		bytes, err := s.reader.Peek(1)
 		if err != nil {
+			if errors.Is(err, io.EOF) {
+				s.reporter.FileError(s.file, line, "Unterminated string.")
+				return nil
+			}
 			s.reporter.Panic(s.line, err)
 		}
-		s.currLexeme.WriteRune(rune)
+		if bytes[0] == '"' {
+			s.discard(1) // skip closing quote
+			break
+		}
+		s.stringRune()
 	}
 
-	s.addTokenLiteral(token.STRING, s.currLexeme.String())
-
+	s.addTokenAt(token.STRING, s.currLexeme.String(), line)
 	return nil
 }
 
-func (s *Scanner) numberToken() error {
-	err := s.consumeDigits()
+// stringRune adds the next rune of a string literal to its lexeme.
+func (s *Scanner) stringRune() {
+	rune, err := s.readRune()
 	if err != nil {
-		return err
+		s.reporter.Panic(s.line, err)
+	}
+	if rune == '\n' {
+		s.newline()
 	}
+	s.currLexeme.WriteRune(rune)
+}
+
+// addStringToken adds a token for the string text scanned so far, which
+// began at line and column, reporting any bad escape sequences in it.
+func (s *Scanner) addStringToken(tokenType token.TokenType, line int, column int) {
+	text := s.currLexeme.String()
+	value, err := Unescape(text)
+	if err != nil {
+		escapeErr := err.(*EscapeError)
+		errLine, errColumn := Position(text, escapeErr.Offset, line, column)
+		s.reporter.ColumnError(s.file, errLine, errColumn, escapeErr.Message)
+		value = text
+	}
+	s.addTokenAt(tokenType, value, line)
+}
+
+func (s *Scanner) numberToken() error {
+	if s.currLexeme.String() == "0" {
+		if bytes, err := s.reader.Peek(1); err == nil && isRadix(bytes[0]) {
+			prefix := bytes[0]
+			s.discard(1)
+			s.currLexeme.WriteByte(prefix)
+			// take any letters too, so 0xFG is one bad literal
+			// rather than 0xF followed by G
+			s.consumeDigits(isByteAlphaNumeric)
+			return s.addNumberToken()
+		}
+	}
+
+	s.consumeDigits(isByteDigit)
 
 	bytes, err := s.reader.Peek(2)
 	if err == nil {
 		if bytes[0] == '.' && isByteNumber(bytes[1]) {
-			s.reader.Discard(1)
+			s.discard(1)
 			s.currLexeme.WriteRune('.')
-			err = s.consumeDigits()
-			if err != nil {
-				return err
-			}
+			s.consumeDigits(isByteDigit)
 		}
 	}
 
-	literal, err := strconv.ParseFloat(s.currLexeme.String(), 64)
+	return s.addNumberToken()
+}
+
+func (s *Scanner) addNumberToken() error {
+	literal, err := ParseNumber(s.currLexeme.String())
 	if err != nil {
-		s.reporter.Panic(s.line, err)
+		s.reporter.FileError(s.file, s.line, err.Error())
 	}
 
 	s.addTokenLiteral(token.NUMBER, literal)
 	return nil
 }
 
-func (s *Scanner) consumeDigits() error {
+// consumeDigits adds the bytes following a number's first digit that
+// isDigit accepts to its lexeme.
+func (s *Scanner) consumeDigits(isDigit func(byte) bool) {
 	for {
 		bytes, err := s.reader.Peek(1)
 		if err != nil {
@@ -224,21 +388,20 @@ func (s *Scanner) consumeDigits() error {
 			}
 			s.reporter.Panic(s.line, err)
 		}
-		if !isByteNumber(bytes[0]) {
+		if !isDigit(bytes[0]) {
 			break
 		}
-		rune, _, err := s.reader.ReadRune()
+		rune, err := s.readRune()
 		if err != nil {
 			s.reporter.Panic(s.line, err)
 		}
 		s.currLexeme.WriteRune(rune)
 	}
-	return nil
 }
 
 func (s *Scanner) identifierToken() error {
 	for {
-		rune, _, err := s.reader.ReadRune()
+		rune, err := s.readRune()
 		if err != nil {
 			if errors.Is(err, io.EOF) {
 				break
@@ -246,7 +409,7 @@ func (s *Scanner) identifierToken() error {
 			return failure.Wrap(s.line, "err consuming identifier rune", err)
 		}
 		if !isAlphaNumeric(rune) {
-			s.reader.UnreadRune()
+			s.unreadRune()
 			break
 		}
 		s.currLexeme.WriteRune(rune)
@@ -271,6 +434,16 @@ func isByteNumber(val byte) bool {
 	return val >= '0' && val <= '9'
 }
 
+// isByteDigit accepts the digits of a decimal number, which underscores
+// may separate.
+func isByteDigit(val byte) bool {
+	return isByteNumber(val) || val == '_'
+}
+
+func isByteAlphaNumeric(val byte) bool {
+	return isByteDigit(val) || (val >= 'a' && val <= 'z') || (val >= 'A' && val <= 'Z')
+}
+
 func isAlpha(rune rune) bool {
 	return unicode.IsLetter(rune) || rune == '_'
 }
@@ -20,6 +20,51 @@ func TestScanner(t *testing.T) {
 		require.Equal(t, token.NewToken(token.LEFT_PAREN, "(", nil, 1), tokens[2])
 		require.Equal(t, token.NewToken(token.EOF, "", nil, 1), tokens[3])
 	})
+	t.Run("brackets", func(t *testing.T) {
+		reporter := &failure.Reporter{}
+		scanner := NewScanner(strings.NewReader("a[1]"), reporter)
+		tokens := scanner.ScanTokens()
+		require.False(t, reporter.HasFailed())
+		require.Len(t, tokens, 5)
+		require.Equal(t, token.NewToken(token.IDENTIFIER, "a", nil, 1), tokens[0])
+		require.Equal(t, token.NewToken(token.LEFT_BRACKET, "[", nil, 1), tokens[1])
+		require.Equal(t, token.NewToken(token.NUMBER, "1", 1.0, 1), tokens[2])
+		require.Equal(t, token.NewToken(token.RIGHT_BRACKET, "]", nil, 1), tokens[3])
+		require.Equal(t, token.NewToken(token.EOF, "", nil, 1), tokens[4])
+	})
+	t.Run("colon", func(t *testing.T) {
+		reporter := &failure.Reporter{}
+		scanner := NewScanner(strings.NewReader("{a:1}"), reporter)
+		tokens := scanner.ScanTokens()
+		require.False(t, reporter.HasFailed())
+		require.Len(t, tokens, 6)
+		require.Equal(t, token.NewToken(token.LEFT_BRACE, "{", nil, 1), tokens[0])
+		require.Equal(t, token.NewToken(token.IDENTIFIER, "a", nil, 1), tokens[1])
+		require.Equal(t, token.NewToken(token.COLON, ":", nil, 1), tokens[2])
+		require.Equal(t, token.NewToken(token.NUMBER, "1", 1.0, 1), tokens[3])
+		require.Equal(t, token.NewToken(token.RIGHT_BRACE, "}", nil, 1), tokens[4])
+		require.Equal(t, token.NewToken(token.EOF, "", nil, 1), tokens[5])
+	})
+	t.Run("interpolation", func(t *testing.T) {
+		reporter := &failure.Reporter{}
+		scanner := NewScanner(strings.NewReader(`"a${ {}["b"] }c"`), reporter)
+		tokens := scanner.ScanTokens()
+		require.False(t, reporter.HasFailed())
+		require.Len(t, tokens, 8)
+		require.Equal(t, token.NewToken(token.INTERPOLATION, "a", "a", 1), tokens[0])
+		require.Equal(t, token.NewToken(token.LEFT_BRACE, "{", nil, 1), tokens[1])
+		require.Equal(t, token.NewToken(token.RIGHT_BRACE, "}", nil, 1), tokens[2])
+		require.Equal(t, token.NewToken(token.LEFT_BRACKET, "[", nil, 1), tokens[3])
+		require.Equal(t, token.NewToken(token.STRING, "b", "b", 1), tokens[4])
+		require.Equal(t, token.NewToken(token.RIGHT_BRACKET, "]", nil, 1), tokens[5])
+		require.Equal(t, token.NewToken(token.STRING, "c", "c", 1), tokens[6])
+		require.Equal(t, token.NewToken(token.EOF, "", nil, 1), tokens[7])
+	})
+	t.Run("unterminated interpolation", func(t *testing.T) {
+		reporter := &failure.Reporter{}
+		NewScanner(strings.NewReader(`"a${b`), reporter).ScanTokens()
+		require.True(t, reporter.HasFailed())
+	})
 	t.Run("unknown char", func(t *testing.T) {
 		reporter := &failure.Reporter{}
 		scanner := NewScanner(strings.NewReader("*$-"), reporter)
@@ -72,7 +117,7 @@ func TestScanner(t *testing.T) {
 			},
 			{
 				title: "single line comment",
-				input: " * //this is a comment",
+				input: " * #this is a comment",
 				output: []*token.Token{
 					token.NewToken(token.STAR, "*", nil, 1),
 					token.NewToken(token.EOF, "", nil, 1),
@@ -80,15 +125,62 @@ func TestScanner(t *testing.T) {
 			},
 			{
 				title: "single line comment without text",
-				input: " * //",
+				input: " * #",
 				output: []*token.Token{
 					token.NewToken(token.STAR, "*", nil, 1),
 					token.NewToken(token.EOF, "", nil, 1),
 				},
 			},
+			{
+				title: "comment after a paren",
+				input: "(a) # note",
+				output: []*token.Token{
+					token.NewToken(token.LEFT_PAREN, "(", nil, 1),
+					token.NewToken(token.IDENTIFIER, "a", nil, 1),
+					token.NewToken(token.RIGHT_PAREN, ")", nil, 1),
+					token.NewToken(token.EOF, "", nil, 1),
+				},
+			},
+			{
+				title: "comment after an identifier",
+				input: "a # note",
+				output: []*token.Token{
+					token.NewToken(token.IDENTIFIER, "a", nil, 1),
+					token.NewToken(token.EOF, "", nil, 1),
+				},
+			},
+			{
+				title: "comment after a number",
+				input: "2 # note",
+				output: []*token.Token{
+					token.NewToken(token.NUMBER, "2", 2.0, 1),
+					token.NewToken(token.EOF, "", nil, 1),
+				},
+			},
+			{
+				title: "integer division",
+				input: "a // 2 ~ /",
+				output: []*token.Token{
+					token.NewToken(token.IDENTIFIER, "a", nil, 1),
+					token.NewToken(token.SLASH_SLASH, "//", nil, 1),
+					token.NewToken(token.NUMBER, "2", 2.0, 1),
+					token.NewToken(token.TILDE, "~", nil, 1),
+					token.NewToken(token.SLASH, "/", nil, 1),
+					token.NewToken(token.EOF, "", nil, 1),
+				},
+			},
+			{
+				title: "comment after a statement",
+				input: "a; # 2",
+				output: []*token.Token{
+					token.NewToken(token.IDENTIFIER, "a", nil, 1),
+					token.NewToken(token.SEMICOLON, ";", nil, 1),
+					token.NewToken(token.EOF, "", nil, 1),
+				},
+			},
 			{
 				title: "multi line comment",
-				input: "* //this is a comment\n (",
+				input: "* #this is a comment\n (",
 				output: []*token.Token{
 					token.NewToken(token.STAR, "*", nil, 1),
 					token.NewToken(token.LEFT_PAREN, "(", nil, 2),
@@ -132,7 +224,7 @@ func TestScanner(t *testing.T) {
 world"`,
 				expectError: false,
 				output: []*token.Token{
-					token.NewToken(token.STRING, "hello\nworld", "hello\nworld", 2),
+					token.NewToken(token.STRING, "hello\nworld", "hello\nworld", 1),
 					token.NewToken(token.EOF, "", nil, 2),
 				},
 			},
@@ -141,6 +233,50 @@ world"`,
 				input:       `"hello`,
 				expectError: true,
 			},
+			{
+				title:       "escapes",
+				input:       `"a\tb\n\"c\"\\\${d}\u{1F600}\u{e9}"`,
+				expectError: false,
+				output: []*token.Token{
+					token.NewToken(token.STRING, `a\tb\n\"c\"\\\${d}\u{1F600}\u{e9}`, "a\tb\n\"c\"\\${d}\U0001F600\u00e9", 1),
+					token.NewToken(token.EOF, "", nil, 1),
+				},
+			},
+			{
+				title:       "escaped newline in multi-line string",
+				input:       "\"a\\n\nb\"\nc",
+				expectError: false,
+				output: []*token.Token{
+					token.NewToken(token.STRING, "a\\n\nb", "a\n\nb", 1),
+					token.NewToken(token.IDENTIFIER, "c", nil, 3),
+					token.NewToken(token.EOF, "", nil, 3),
+				},
+			},
+			{
+				title: "raw string",
+				input: `r"a\n${b}
+\"`,
+				expectError: false,
+				output: []*token.Token{
+					token.NewToken(token.STRING, "a\\n${b}\n\\", "a\\n${b}\n\\", 1),
+					token.NewToken(token.EOF, "", nil, 2),
+				},
+			},
+			{
+				title:       "invalid escape",
+				input:       `"\q"`,
+				expectError: true,
+			},
+			{
+				title:       "invalid unicode escape",
+				input:       `"\u{110000}"`,
+				expectError: true,
+			},
+			{
+				title:       "unclosed unicode escape",
+				input:       `"\u{1F600"`,
+				expectError: true,
+			},
 		}
 
 		for _, testcase := range testcases {
@@ -153,6 +289,36 @@ world"`,
 		}
 	})
 
+	t.Run("operators", func(t *testing.T) {
+		reporter := &failure.Reporter{}
+		tokens := NewScanner(strings.NewReader("% ** * & | ^ ~ << <= < >> >= >"), reporter).ScanTokens()
+		require.False(t, reporter.HasFailed())
+		validateTokens(t, tokens, []*token.Token{
+			token.NewToken(token.PERCENT, "%", nil, 1),
+			token.NewToken(token.STAR_STAR, "**", nil, 1),
+			token.NewToken(token.STAR, "*", nil, 1),
+			token.NewToken(token.AMPERSAND, "&", nil, 1),
+			token.NewToken(token.PIPE, "|", nil, 1),
+			token.NewToken(token.CARET, "^", nil, 1),
+			token.NewToken(token.TILDE, "~", nil, 1),
+			token.NewToken(token.LESS_LESS, "<<", nil, 1),
+			token.NewToken(token.LESS_EQUAL, "<=", nil, 1),
+			token.NewToken(token.LESS, "<", nil, 1),
+			token.NewToken(token.GREATER_GREATER, ">>", nil, 1),
+			token.NewToken(token.GREATER_EQUAL, ">=", nil, 1),
+			token.NewToken(token.GREATER, ">", nil, 1),
+			token.NewToken(token.EOF, "", nil, 1),
+		})
+	})
+
+	t.Run("escape error location", func(t *testing.T) {
+		var out strings.Builder
+		reporter := failure.NewReporter(&out)
+		NewScanner(strings.NewReader("print 1;\nprint \"ok\nnot \\x ok\";"), reporter).ScanTokens()
+		require.True(t, reporter.HasFailed())
+		require.Equal(t, "[line 3] Error at column 5: Invalid escape sequence '\\x'.\n", out.String())
+	})
+
 	t.Run("numbers", func(t *testing.T) {
 		type testcase struct {
 			title       string
@@ -189,6 +355,64 @@ world"`,
 					token.NewToken(token.EOF, "", nil, 1),
 				},
 			},
+			{
+				title:       "underscores",
+				input:       "1_000_000.000_5",
+				expectError: false,
+				output: []*token.Token{
+					token.NewToken(token.NUMBER, "1_000_000.000_5", 1000000.0005, 1),
+					token.NewToken(token.EOF, "", nil, 1),
+				},
+			},
+			{
+				title:       "hex",
+				input:       "0xFF_ff",
+				expectError: false,
+				output: []*token.Token{
+					token.NewToken(token.NUMBER, "0xFF_ff", 65535.0, 1),
+					token.NewToken(token.EOF, "", nil, 1),
+				},
+			},
+			{
+				title:       "binary",
+				input:       "0b1010 0B1",
+				expectError: false,
+				output: []*token.Token{
+					token.NewToken(token.NUMBER, "0b1010", 10.0, 1),
+					token.NewToken(token.NUMBER, "0B1", 1.0, 1),
+					token.NewToken(token.EOF, "", nil, 1),
+				},
+			},
+			{
+				title:       "bad hex digit",
+				input:       "0xFG",
+				expectError: true,
+			},
+			{
+				title:       "bad binary digit",
+				input:       "0b102",
+				expectError: true,
+			},
+			{
+				title:       "prefix without digits",
+				input:       "0x",
+				expectError: true,
+			},
+			{
+				title:       "trailing underscore",
+				input:       "1_",
+				expectError: true,
+			},
+			{
+				title:       "doubled underscore",
+				input:       "1__0",
+				expectError: true,
+			},
+			{
+				title:       "hex too large",
+				input:       "0x1_0000_0000_0000_0000",
+				expectError: true,
+			},
 			{
 				title:       "trailing dot",
 				input:       "123.",
@@ -0,0 +1,197 @@
+// Package stdlib is the standard library of natives shared by every
+// backend. Each function is a plain Go function adapted by pkg/native, so a
+// backend only needs a DefineNative method to install it.
+package stdlib
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Definer is implemented by each backend's interpreter.
+type Definer interface {
+	DefineNative(name string, fn interface{}) error
+}
+
+// Typed is implemented by backend values that type() reports as something
+// other than a number, string, boolean or nil, such as "function", "class"
+// or "instance".
+type Typed interface {
+	TypeName() string
+}
+
+// Listless is implemented by backends that have no lists, such as the
+// bytecode VM. Install leaves out the functions that return lists, such as
+// split.
+type Listless interface {
+	Listless()
+}
+
+// Install defines every standard library function in d. Each call gets its
+// own random number generator, seeded from the clock until a script calls
+// seed.
+func Install(d Definer) error {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	_, listless := d.(Listless)
+	natives := []struct {
+		name string
+		fn   interface{}
+	}{
+		// strings and conversion
+		{"len", length},
+		{"substr", substr},
+		{"indexOf", indexOf},
+		{"split", strings.Split},
+		{"upper", strings.ToUpper},
+		{"lower", strings.ToLower},
+		{"trim", strings.TrimSpace},
+		{"str", str},
+		{"num", num},
+		{"type", typeOf},
+		// math
+		{"floor", math.Floor},
+		{"ceil", math.Ceil},
+		{"sqrt", math.Sqrt},
+		{"pow", math.Pow},
+		{"abs", math.Abs},
+		{"min", minimum},
+		{"max", maximum},
+		{"random", random.Float64},
+		{"seed", random.Seed},
+	}
+	for _, n := range natives {
+		if listless && returnsList(n.fn) {
+			continue
+		}
+		if err := d.DefineNative(n.name, n.fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returnsList reports whether fn returns a slice, which backends convert to
+// a list.
+func returnsList(fn interface{}) bool {
+	t := reflect.TypeOf(fn)
+	for i := 0; i < t.NumOut(); i++ {
+		if kind := t.Out(i).Kind(); kind == reflect.Slice || kind == reflect.Array {
+			return true
+		}
+	}
+	return false
+}
+
+// Lengther is implemented by backend collections such as lists.
+type Lengther interface {
+	Len() int
+}
+
+// length counts the characters of a string or the elements of a
+// collection.
+func length(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case string:
+		return float64(utf8.RuneCountInString(v)), nil
+	case Lengther:
+		return float64(v.Len()), nil
+	}
+	return 0, fmt.Errorf("Can't take the length of %s.", describe(value))
+}
+
+// substr returns length characters of s from start, or every character from
+// start if length is left out.
+func substr(s string, start int, length ...int) (string, error) {
+	if len(length) > 1 {
+		return "", fmt.Errorf("Expected at most 3 arguments but got %d.", len(length)+2)
+	}
+	runes := []rune(s)
+	end := len(runes)
+	if len(length) == 1 {
+		end = start + length[0]
+	}
+	if start < 0 || start > len(runes) || end < start || end > len(runes) {
+		return "", fmt.Errorf("Substring out of range.")
+	}
+	return string(runes[start:end]), nil
+}
+
+// indexOf is the character index of the first sub in s, or -1.
+func indexOf(s, sub string) float64 {
+	i := strings.Index(s, sub)
+	if i < 0 {
+		return -1
+	}
+	return float64(utf8.RuneCountInString(s[:i]))
+}
+
+// str formats a value as print would.
+func str(value interface{}) string {
+	if value == nil {
+		return "nil"
+	}
+	return fmt.Sprint(value)
+}
+
+// num parses a number, giving nil if s isn't one. Numbers are returned as
+// they are.
+func num(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, nil
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("Can't convert %s to a number.", describe(value))
+}
+
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case Typed:
+		return v.TypeName()
+	}
+	return "object"
+}
+
+func minimum(first float64, rest ...float64) float64 {
+	for _, n := range rest {
+		first = math.Min(first, n)
+	}
+	return first
+}
+
+func maximum(first float64, rest ...float64) float64 {
+	for _, n := range rest {
+		first = math.Max(first, n)
+	}
+	return first
+}
+
+func describe(value interface{}) string {
+	switch kind := typeOf(value); kind {
+	case "nil":
+		return kind
+	case "instance":
+		return "an instance"
+	default:
+		return "a " + kind
+	}
+}
@@ -0,0 +1,160 @@
+package stdlib_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/mkeesey/craftinginterpreters/pkg/lox"
+	"github.com/stretchr/testify/require"
+)
+
+var backends = []lox.Backend{lox.TreeWalk, lox.Closures, lox.Bytecode}
+
+// eval runs src on every backend, requiring each to give the same result.
+func eval(t *testing.T, src string) interface{} {
+	t.Helper()
+	var results []interface{}
+	for _, backend := range backends {
+		var stderr bytes.Buffer
+		l := lox.New(lox.Options{Backend: backend, Stderr: &stderr})
+		result, err := l.Eval(context.Background(), src)
+		require.NoError(t, err, "%s: %s", backend, stderr.String())
+		results = append(results, result)
+	}
+	for i := 1; i < len(results); i++ {
+		require.Equal(t, results[0], results[i], "%s and %s disagree on %s", backends[0], backends[i], src)
+	}
+	return results[0]
+}
+
+// evalError runs src on every backend, requiring each to fail with message.
+func evalError(t *testing.T, src string, message string) {
+	t.Helper()
+	for _, backend := range backends {
+		var stderr bytes.Buffer
+		l := lox.New(lox.Options{Backend: backend, Stderr: &stderr})
+		_, err := l.Eval(context.Background(), src)
+		require.ErrorIs(t, err, lox.ErrRuntime, backend.String())
+		require.Contains(t, stderr.String(), message, backend.String())
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		src    string
+		result interface{}
+	}{
+		{`len("waffles");`, 7.0},
+		{`len("");`, 0.0},
+		{`len("héllo");`, 5.0},
+		{`substr("waffles", 1, 3);`, "aff"},
+		{`substr("waffles", 3);`, "fles"},
+		{`substr("waffles", 7);`, ""},
+		{`indexOf("waffles", "fle");`, 3.0},
+		{`indexOf("héllo", "l");`, 2.0},
+		{`indexOf("waffles", "x");`, -1.0},
+		{`upper("Taco");`, "TACO"},
+		{`lower("Taco");`, "taco"},
+		{`trim("  taco  ");`, "taco"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.result, eval(t, tt.src), tt.src)
+	}
+
+	// the VM has no lists or maps
+	for _, backend := range backends[:2] {
+		l := lox.New(lox.Options{Backend: backend})
+		result, err := l.Eval(context.Background(), `var parts = split("a,b,c", ","); str(parts) + str(len(parts));`)
+		require.NoError(t, err)
+		require.Equal(t, `["a", "b", "c"]3`, result)
+
+		result, err = l.Eval(context.Background(), `type([1, 2]) + type({}) + str(len({"a": 1}));`)
+		require.NoError(t, err)
+		require.Equal(t, "listmap1", result)
+	}
+
+	// so it isn't given split, which returns one
+	var stderr bytes.Buffer
+	l := lox.New(lox.Options{Backend: lox.Bytecode, Stderr: &stderr})
+	_, err := l.Eval(context.Background(), `split("a,b,c", ",");`)
+	require.ErrorIs(t, err, lox.ErrRuntime)
+	require.Contains(t, stderr.String(), "Undefined variable 'split'.")
+
+	evalError(t, `substr("taco", 2, 5);`, "Substring out of range.")
+	evalError(t, `substr("taco", -1);`, "Substring out of range.")
+	evalError(t, `substr("taco", 1.5);`, "Argument 2 to 'substr' must be an integer.")
+	evalError(t, `len(12);`, "Can't take the length of a number.")
+	evalError(t, `upper(nil);`, "Argument 1 to 'upper' must be a string.")
+}
+
+func TestConversion(t *testing.T) {
+	tests := []struct {
+		src    string
+		result interface{}
+	}{
+		{`str(12);`, "12"},
+		{`str(1.5);`, "1.5"},
+		{`str(true);`, "true"},
+		{`str(nil);`, "nil"},
+		{`str("taco");`, "taco"},
+		{`class Taco {} str(Taco());`, "Taco instance"},
+		{`fun f() {} str(f);`, "<fn f>"},
+		{`num("12.5");`, 12.5},
+		{`num(" 7 ");`, 7.0},
+		{`num("taco");`, nil},
+		{`num(3);`, 3.0},
+		{`type(1);`, "number"},
+		{`type("a");`, "string"},
+		{`type(false);`, "boolean"},
+		{`type(nil);`, "nil"},
+		{`fun f() {} type(f);`, "function"},
+		{`type(clock);`, "function"},
+		{`class Taco { eat() {} } type(Taco);`, "class"},
+		{`class Taco { eat() {} } type(Taco());`, "instance"},
+		{`class Taco { eat() {} } type(Taco().eat);`, "function"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.result, eval(t, tt.src), tt.src)
+	}
+
+	evalError(t, `num(true);`, "Can't convert a boolean to a number.")
+}
+
+func TestMath(t *testing.T) {
+	tests := []struct {
+		src    string
+		result interface{}
+	}{
+		{`floor(1.5);`, 1.0},
+		{`floor(-1.5);`, -2.0},
+		{`ceil(1.2);`, 2.0},
+		{`sqrt(16);`, 4.0},
+		{`pow(2, 10);`, 1024.0},
+		{`abs(-3);`, 3.0},
+		{`min(3, 1, 2);`, 1.0},
+		{`min(3);`, 3.0},
+		{`max(3, 1, 2);`, 3.0},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.result, eval(t, tt.src), tt.src)
+	}
+
+	evalError(t, `max();`, "Expected at least 1 arguments but got 0.")
+	evalError(t, `sqrt("4");`, "Argument 1 to 'sqrt' must be a number.")
+}
+
+func TestRandom(t *testing.T) {
+	// the same seed gives the same sequence on every backend
+	first := eval(t, `seed(42); var a = random(); a + random();`)
+	require.Equal(t, first, eval(t, `seed(42); var a = random(); a + random();`))
+
+	for _, backend := range backends {
+		l := lox.New(lox.Options{Backend: backend})
+		n, err := l.Eval(context.Background(), `random();`)
+		require.NoError(t, err)
+		require.True(t, n.(float64) >= 0 && n.(float64) < 1)
+	}
+
+	evalError(t, `seed(1.5);`, "Argument 1 to 'seed' must be an integer.")
+}
@@ -7,6 +7,9 @@ type Token struct {
 	Lexeme  string
 	Literal interface{}
 	Line    int
+	// File is the file the token was scanned from, or empty for source that
+	// didn't come from a file
+	File string
 }
 
 func NewToken(tokenType TokenType, lexeme string, literal interface{}, line int) *Token {
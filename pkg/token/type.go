@@ -10,13 +10,21 @@ const (
 	RIGHT_PAREN
 	LEFT_BRACE
 	RIGHT_BRACE
+	LEFT_BRACKET
+	RIGHT_BRACKET
 	COMMA
+	COLON
 	DOT
 	MINUS
 	PLUS
 	SEMICOLON
 	SLASH
 	STAR
+	PERCENT
+	AMPERSAND
+	PIPE
+	CARET
+	TILDE
 
 	// One or two character tokens.
 	BANG
@@ -25,29 +33,45 @@ const (
 	EQUAL_EQUAL
 	GREATER
 	GREATER_EQUAL
+	GREATER_GREATER
 	LESS
 	LESS_EQUAL
+	LESS_LESS
+	SLASH_SLASH
+	STAR_STAR
 
 	// Literals.
 	IDENTIFIER
 	STRING
+	// INTERPOLATION is the part of a string literal before a ${...}
+	// expression. The string continues after the expression, in another
+	// INTERPOLATION or the closing STRING.
+	INTERPOLATION
 	NUMBER
 
 	// Keywords.
 	AND
+	BREAK
+	CATCH
 	CLASS
+	CONTINUE
 	ELSE
+	EXPORT
 	FALSE
+	FINALLY
 	FUN
 	FOR
 	IF
+	IMPORT
 	NIL
 	OR
 	PRINT
 	RETURN
 	SUPER
 	THIS
+	THROW
 	TRUE
+	TRY
 	VAR
 	WHILE
 
@@ -64,8 +88,14 @@ func (t TokenType) String() string {
 		return "LEFT_BRACE"
 	case RIGHT_BRACE:
 		return "RIGHT_BRACE"
+	case LEFT_BRACKET:
+		return "LEFT_BRACKET"
+	case RIGHT_BRACKET:
+		return "RIGHT_BRACKET"
 	case COMMA:
 		return "COMMA"
+	case COLON:
+		return "COLON"
 	case DOT:
 		return "DOT"
 	case MINUS:
@@ -78,6 +108,16 @@ func (t TokenType) String() string {
 		return "SLASH"
 	case STAR:
 		return "STAR"
+	case PERCENT:
+		return "PERCENT"
+	case AMPERSAND:
+		return "AMPERSAND"
+	case PIPE:
+		return "PIPE"
+	case CARET:
+		return "CARET"
+	case TILDE:
+		return "TILDE"
 	case BANG:
 		return "BANG"
 	case BANG_EQUAL:
@@ -90,30 +130,52 @@ func (t TokenType) String() string {
 		return "GREATER"
 	case GREATER_EQUAL:
 		return "GREATER_EQUAL"
+	case GREATER_GREATER:
+		return "GREATER_GREATER"
 	case LESS:
 		return "LESS"
 	case LESS_EQUAL:
 		return "LESS_EQUAL"
+	case LESS_LESS:
+		return "LESS_LESS"
+	case SLASH_SLASH:
+		return "SLASH_SLASH"
+	case STAR_STAR:
+		return "STAR_STAR"
 	case IDENTIFIER:
 		return "IDENTIFIER"
 	case STRING:
 		return "STRING"
+	case INTERPOLATION:
+		return "INTERPOLATION"
 	case NUMBER:
 		return "NUMBER"
 	case AND:
 		return "AND"
+	case BREAK:
+		return "BREAK"
+	case CATCH:
+		return "CATCH"
 	case CLASS:
 		return "CLASS"
+	case CONTINUE:
+		return "CONTINUE"
 	case ELSE:
 		return "ELSE"
+	case EXPORT:
+		return "EXPORT"
 	case FALSE:
 		return "FALSE"
+	case FINALLY:
+		return "FINALLY"
 	case FUN:
 		return "FUN"
 	case FOR:
 		return "FOR"
 	case IF:
 		return "IF"
+	case IMPORT:
+		return "IMPORT"
 	case NIL:
 		return "NIL"
 	case OR:
@@ -126,8 +188,12 @@ func (t TokenType) String() string {
 		return "SUPER"
 	case THIS:
 		return "THIS"
+	case THROW:
+		return "THROW"
 	case TRUE:
 		return "TRUE"
+	case TRY:
+		return "TRY"
 	case VAR:
 		return "VAR"
 	case WHILE: